@@ -72,10 +72,25 @@ func DeleteSession(sessionID string) {
 	delete(sessionStore, sessionID)
 }
 
+const defaultSessionSecret = "default-secret-change-in-production"
+
+// Init checks the session secret. In production an unset secret, the built-in
+// default or the placeholder from env.example is refused.
+func Init(production bool) error {
+	if !production {
+		return nil
+	}
+	switch os.Getenv("SESSION_SECRET") {
+	case "", defaultSessionSecret, "your_random_session_secret_here":
+		return fmt.Errorf("SESSION_SECRET must be set to a random value in production")
+	}
+	return nil
+}
+
 func GetSessionSecret() string {
 	secret := os.Getenv("SESSION_SECRET")
 	if secret == "" {
-		return "default-secret-change-in-production"
+		return defaultSessionSecret
 	}
 	return secret
 }
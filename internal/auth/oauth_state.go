@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"helpdesk/internal/db"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OAuthStateTTL is how long a user has to complete an OAuth consent screen.
+const OAuthStateTTL = 10 * time.Minute
+
+var ErrInvalidOAuthState = errors.New("invalid OAuth state")
+
+func signState(payload, sessionID string) string {
+	mac := hmac.New(sha256.New, []byte(GetSessionSecret()))
+	mac.Write([]byte(payload))
+	mac.Write([]byte{0})
+	mac.Write([]byte(sessionID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// NewOAuthState returns a state parameter for an OAuth redirect started by
+// the given session on behalf of orgID. It is signed with the session secret,
+// bound to the session, expires after OAuthStateTTL and can be used once.
+func NewOAuthState(sessionID string, orgID int) (string, error) {
+	nonce, err := GenerateSessionID()
+	if err != nil {
+		return "", err
+	}
+	expires := time.Now().Add(OAuthStateTTL)
+
+	if err := db.DeleteExpiredOAuthStates(time.Now()); err != nil {
+		log.Printf("Error deleting expired OAuth states: %v", err)
+	}
+	if err := db.CreateOAuthState(nonce, expires); err != nil {
+		return "", err
+	}
+
+	payload := fmt.Sprintf("%d.%d.%s", orgID, expires.Unix(), nonce)
+	return payload + "." + signState(payload, sessionID), nil
+}
+
+// VerifyOAuthState checks a state returned by the OAuth provider against the
+// session that completes the flow and returns the organization it was issued for.
+func VerifyOAuthState(state, sessionID string) (int, error) {
+	i := strings.LastIndex(state, ".")
+	if i < 0 {
+		return 0, ErrInvalidOAuthState
+	}
+	payload, sig := state[:i], state[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(signState(payload, sessionID))) {
+		return 0, ErrInvalidOAuthState
+	}
+
+	parts := strings.Split(payload, ".")
+	if len(parts) != 3 {
+		return 0, ErrInvalidOAuthState
+	}
+	orgID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, ErrInvalidOAuthState
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().After(time.Unix(expires, 0)) {
+		return 0, fmt.Errorf("%w: expired", ErrInvalidOAuthState)
+	}
+
+	ok, err := db.UseOAuthState(parts[2], time.Now())
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, fmt.Errorf("%w: already used", ErrInvalidOAuthState)
+	}
+
+	return orgID, nil
+}
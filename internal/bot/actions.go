@@ -0,0 +1,209 @@
+package bot
+
+import (
+	"fmt"
+	"helpdesk/internal/db"
+	"helpdesk/internal/i18n"
+	"helpdesk/internal/models"
+	"helpdesk/internal/richtext"
+	"helpdesk/internal/tickets"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Inline buttons on operator messages send "ticket_<action>_<id>[_<arg>]".
+
+// ticketKeyboard offers the actions that make sense in the ticket's current state.
+func ticketKeyboard(ticket *models.Ticket, lang string) tgbotapi.InlineKeyboardMarkup {
+	button := func(label, action string) tgbotapi.InlineKeyboardButton {
+		return tgbotapi.NewInlineKeyboardButtonData(i18n.T(lang, label), fmt.Sprintf("ticket_%s_%d", action, ticket.ID))
+	}
+
+	base := tickets.BaseStatus(ticket.OrganizationID, ticket.Status)
+
+	var status []tgbotapi.InlineKeyboardButton
+	switch base {
+	case tickets.StatusResolved:
+		status = append(status, button("bot.button.reopen", "reopen"), button("bot.button.close", "close"))
+	case tickets.StatusClosed:
+		status = append(status, button("bot.button.reopen", "reopen"))
+	default:
+		status = append(status, button("bot.button.resolve", "resolve"), button("bot.button.close", "close"))
+	}
+
+	first := tgbotapi.NewInlineKeyboardRow(button("bot.button.reply", "reply"))
+	if base != tickets.StatusClosed {
+		first = append([]tgbotapi.InlineKeyboardButton{button("bot.button.assign", "assign")}, first...)
+	}
+
+	return tgbotapi.NewInlineKeyboardMarkup(
+		first,
+		status,
+		tgbotapi.NewInlineKeyboardRow(button("bot.button.priority", "priority")),
+	)
+}
+
+// priorityKeyboard lets the operator pick a new priority.
+func priorityKeyboard(ticket *models.Ticket, lang string) tgbotapi.InlineKeyboardMarkup {
+	var row []tgbotapi.InlineKeyboardButton
+	for _, p := range models.TicketPriorities {
+		label := tickets.PriorityLabel(p, lang)
+		if p == ticket.Priority {
+			label = "• " + label
+		}
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("ticket_setprio_%d_%s", ticket.ID, p)))
+	}
+
+	return tgbotapi.NewInlineKeyboardMarkup(
+		row,
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(i18n.T(lang, "bot.button.back"), fmt.Sprintf("ticket_back_%d", ticket.ID)),
+		),
+	)
+}
+
+// ticketViewText describes the ticket with its last messages for operators.
+func ticketViewText(ticket *models.Ticket, lang string) (richtext.HTML, error) {
+	messages, err := db.GetMessagesByTicket(ticket.ID)
+	if err != nil {
+		return "", err
+	}
+
+	st := tickets.StatusLabel(ticket.OrganizationID, ticket.Status, lang)
+
+	assignee := i18n.T(lang, "bot.card.unassigned")
+	if ticket.AssignedAgentID != nil {
+		if agent, err := db.GetUserByID(*ticket.AssignedAgentID); err == nil && agent != nil {
+			assignee = displayName(agent)
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(string(html(lang, "bot.card.header", ticket.ID, st, tickets.PriorityLabel(ticket.Priority, lang), assignee, richtext.Bold(ticket.Title))) + "\n")
+
+	if ticket.CategoryID != nil {
+		if category, err := db.GetTicketCategory(ticket.OrganizationID, *ticket.CategoryID); err == nil && category != nil {
+			sb.WriteString(string(html(lang, "bot.card.category", category.Name)) + "\n")
+		}
+	}
+	fields, err := db.GetTicketFields(ticket.ID)
+	if err != nil {
+		return "", err
+	}
+	sb.WriteString(string(fieldsText(fields)))
+	sb.WriteString("\n")
+
+	// Last 5 messages
+	start := 0
+	if len(messages) > 5 {
+		start = len(messages) - 5
+		sb.WriteString(string(html(lang, "bot.card.last_messages", 5, len(messages))) + "\n\n")
+	}
+	for _, m := range messages[start:] {
+		from := html(lang, "bot.card.from_customer")
+		content := richtext.Escape(truncate(m.Content, 100))
+		if m.IsSystem {
+			from = html(lang, "bot.card.from_system")
+		} else if !m.IsFromCustomer {
+			from = html(lang, "bot.card.from_operator")
+			content = richtext.Markdown(truncate(m.Content, 100))
+		}
+		sb.WriteString(fmt.Sprintf("[%s] %s: %s\n", m.CreatedAt.Format("02.01 15:04"), from, content))
+	}
+
+	return richtext.HTML(sb.String()), nil
+}
+
+func displayName(user *models.User) string {
+	switch {
+	case user.FullName != nil && *user.FullName != "":
+		return *user.FullName
+	case user.Username != nil && *user.Username != "":
+		return "@" + *user.Username
+	case user.Email != nil:
+		return *user.Email
+	}
+	return fmt.Sprintf("#%d", user.ID)
+}
+
+// handleTicketAction runs an action from a ticket's inline keyboard and
+// returns the toast to show; alert asks Telegram to show it as a dialog.
+// A successful change redraws the message with the ticket's new state.
+func handleTicketAction(action string, ticketID int, args []string, chatID int64, callback *tgbotapi.CallbackQuery) (toast string, alert bool) {
+	// In the operators' group the chat is not the operator
+	if !isOperator(callback.From.ID) {
+		return i18n.T(chatLanguage(callback.From.ID), "bot.error.operators_only"), false
+	}
+
+	user, err := telegramUser(callback.From)
+	if err != nil {
+		return i18n.T(chatLanguage(callback.From.ID), "bot.error.generic"), false
+	}
+	lang := language(user)
+
+	var changed bool
+	switch action {
+	case "assign":
+		toast, changed = assignTicket(ticketID, user)
+	case "resolve":
+		toast, changed = setTicketStatus(ticketID, tickets.StatusResolved, user)
+	case "close":
+		toast, changed = setTicketStatus(ticketID, tickets.StatusClosed, user)
+	case "reopen":
+		toast, changed = setTicketStatus(ticketID, tickets.StatusOpen, user)
+	case "setprio":
+		if len(args) == 0 {
+			return "", false
+		}
+		toast, changed = setTicketPriority(ticketID, args[0], user)
+	case "priority", "back":
+		ticket, err := db.GetTicketByID(ticketID)
+		if err != nil || ticket == nil {
+			return i18n.T(lang, "bot.error.ticket_not_found"), false
+		}
+		// The buttons are in the language of the chat they are in
+		chatLang := chatLanguage(chatID)
+		keyboard := ticketKeyboard(ticket, chatLang)
+		if action == "priority" {
+			keyboard = priorityKeyboard(ticket, chatLang)
+		}
+		edit := tgbotapi.NewEditMessageReplyMarkup(chatID, callback.Message.MessageID, keyboard)
+		if _, err := BotAPI.Request(edit); err != nil {
+			log.Printf("Error editing keyboard of message %d in %d: %v", callback.Message.MessageID, chatID, err)
+		}
+		return "", false
+	case "reply":
+		if !callback.Message.Chat.IsPrivate() {
+			return i18n.T(lang, "bot.reply.in_topic"), true
+		}
+		startReplyMode(chatID, ticketID, lang)
+		return "", false
+	default:
+		return "", false
+	}
+
+	if changed {
+		refreshTicketMessage(chatID, callback.Message.MessageID, ticketID)
+	}
+	return toast, !changed
+}
+
+// refreshTicketMessage redraws an operator message about the ticket with its
+// current state and actions.
+func refreshTicketMessage(chatID int64, messageID int, ticketID int) {
+	ticket, err := db.GetTicketByID(ticketID)
+	if err != nil || ticket == nil {
+		return
+	}
+
+	lang := chatLanguage(chatID)
+	text, err := ticketViewText(ticket, lang)
+	if err != nil {
+		log.Printf("Error rendering ticket #%d: %v", ticketID, err)
+		return
+	}
+
+	editMessageWithKeyboard(chatID, messageID, text, ticketKeyboard(ticket, lang))
+}
@@ -1,13 +1,20 @@
 package bot
 
 import (
+	"errors"
 	"fmt"
 	"helpdesk/internal/db"
+	"helpdesk/internal/i18n"
 	"helpdesk/internal/models"
+	"helpdesk/internal/richtext"
+	"helpdesk/internal/schedule"
+	"helpdesk/internal/tickets"
 	"log"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -16,6 +23,30 @@ var BotAPI *tgbotapi.BotAPI
 var adminIDs map[int64]bool
 var operatorIDs map[int64]bool
 
+// threadWindow is how long after the last activity a customer's plain message
+// is attached to their active ticket instead of opening a new one. Zero disables threading.
+var threadWindow = 24 * time.Hour
+
+// bookingSlot is the length of appointments customers book with /book.
+var bookingSlot = time.Hour
+
+// pendingMessages holds customer messages waiting for the customer to choose
+// which ticket they belong to, keyed by chat ID, in the order they were sent.
+var pendingMessages = struct {
+	sync.Mutex
+	m map[int64][]*tgbotapi.Message
+}{m: make(map[int64][]*tgbotapi.Message)}
+
+// queuePendingMessage adds a message to the chat's pending ones and reports
+// whether the customer is already being asked to choose a ticket.
+func queuePendingMessage(chatID int64, message *tgbotapi.Message) bool {
+	pendingMessages.Lock()
+	defer pendingMessages.Unlock()
+	waiting := len(pendingMessages.m[chatID]) > 0
+	pendingMessages.m[chatID] = append(pendingMessages.m[chatID], message)
+	return waiting
+}
+
 func Init() error {
 	token := os.Getenv("TELEGRAM_BOT_TOKEN")
 	if token == "" {
@@ -31,6 +62,22 @@ func Init() error {
 	adminIDs = parseIDList(os.Getenv("TELEGRAM_ADMIN_IDS"))
 	operatorIDs = parseIDList(os.Getenv("TELEGRAM_OPERATOR_IDS"))
 
+	if v := os.Getenv("TICKET_THREAD_WINDOW"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid TICKET_THREAD_WINDOW: %w", err)
+		}
+		threadWindow = d
+	}
+
+	if v := os.Getenv("BOOKING_SLOT_DURATION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid BOOKING_SLOT_DURATION %q", v)
+		}
+		bookingSlot = d
+	}
+
 	log.Printf("Authorized on account %s", BotAPI.Self.UserName)
 	return nil
 }
@@ -77,37 +124,16 @@ func Start() {
 func handleMessage(message *tgbotapi.Message) {
 	chatID := message.Chat.ID
 
-	user, err := db.GetUserByTelegramID(chatID)
-	if err != nil {
-		log.Printf("Error getting user: %v", err)
+	if !message.Chat.IsPrivate() {
+		handleGroupMessage(message)
 		return
 	}
 
-	if user == nil {
-		org, err := db.GetOrganizationByID(1)
-		if err != nil {
-			log.Printf("Error getting organization: %v", err)
-			return
-		}
-
-		username := message.From.UserName
-		fullName := strings.TrimSpace(fmt.Sprintf("%s %s", message.From.FirstName, message.From.LastName))
-		role := roleForTelegramID(chatID)
-
-		user = &models.User{
-			OrganizationID: org.ID,
-			TelegramID:     &chatID,
-			Username:       &username,
-			Role:           role,
-			FullName:       &fullName,
-			IsActive:       true,
-		}
-
-		if err := db.CreateUser(user); err != nil {
-			log.Printf("Error creating user: %v", err)
-			sendMessage(chatID, "Произошла ошибка. Попробуйте позже.")
-			return
-		}
+	user, err := telegramUser(message.From)
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		sendMessage(chatID, html(i18n.Pick(i18n.Normalize(message.From.LanguageCode)), "bot.error.generic"))
+		return
 	}
 
 	if strings.HasPrefix(message.Text, "/") {
@@ -121,7 +147,15 @@ func handleMessage(message *tgbotapi.Message) {
 
 	// Operators don't create tickets by plain text
 	if isOperator(chatID) {
-		sendMessage(chatID, "Используйте команды для работы с тикетами. /help — список команд.")
+		handleOperatorMessage(message, user)
+		return
+	}
+
+	if handleIntakeMessage(message, user) {
+		return
+	}
+
+	if handleRatingComment(message, user) {
 		return
 	}
 
@@ -130,7 +164,54 @@ func handleMessage(message *tgbotapi.Message) {
 		return
 	}
 
-	createTicketFromMessage(message, user)
+	handleCustomerFollowUp(message, user)
+}
+
+// telegramUser returns the helpdesk user of a Telegram account, registering
+// it in the default organization on first contact. Users who never chose a
+// language get the one of their Telegram app if the helpdesk speaks it.
+func telegramUser(from *tgbotapi.User) (*models.User, error) {
+	telegramID := from.ID
+	appLanguage := i18n.Normalize(from.LanguageCode)
+
+	user, err := db.GetUserByTelegramID(telegramID)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		if user.Language == nil && appLanguage != "" {
+			if err := db.UpdateUserLanguage(user.ID, &appLanguage); err != nil {
+				log.Printf("Error saving language of user %d: %v", user.ID, err)
+			} else {
+				user.Language = &appLanguage
+			}
+		}
+		return user, nil
+	}
+
+	org, err := db.GetOrganizationByID(1)
+	if err != nil {
+		return nil, err
+	}
+
+	username := from.UserName
+	fullName := strings.TrimSpace(fmt.Sprintf("%s %s", from.FirstName, from.LastName))
+
+	user = &models.User{
+		OrganizationID: org.ID,
+		TelegramID:     &telegramID,
+		Username:       &username,
+		Role:           roleForTelegramID(telegramID),
+		FullName:       &fullName,
+		IsActive:       true,
+	}
+	if appLanguage != "" {
+		user.Language = &appLanguage
+	}
+	if err := db.CreateUser(user); err != nil {
+		return nil, err
+	}
+	return user, nil
 }
 
 // ─── Customer commands ────────────────────────────────────────────────────────
@@ -138,57 +219,203 @@ func handleMessage(message *tgbotapi.Message) {
 func handleCustomerCommand(message *tgbotapi.Message, user *models.User) {
 	chatID := message.Chat.ID
 	text := message.Text
+	lang := language(user)
 
 	switch {
 	case text == "/start":
-		sendMessage(chatID, "Добро пожаловать! Отправьте сообщение, чтобы создать обращение.")
+		if !startIntake(chatID, user) {
+			sendMessage(chatID, html(lang, "bot.customer.welcome"))
+		}
+	case text == "/new":
+		if !startIntake(chatID, user) {
+			sendMessage(chatID, html(lang, "bot.customer.describe"))
+		}
+	case text == "/cancel":
+		cancelIntake(chatID, lang)
 	case text == "/help":
-		sendMessage(chatID, "Отправьте сообщение — будет создано обращение.\nОтветьте на сообщение бота, чтобы добавить комментарий.")
+		sendMessage(chatID, html(lang, "bot.customer.help"))
+	case text == "/language":
+		handleLanguageCommand(chatID, user)
 	case strings.HasPrefix(text, "/status"):
 		handleStatusCommand(message, user)
+	case strings.HasPrefix(text, "/book"):
+		handleBookCommand(message, user)
+	case text == "/mytickets":
+		handleCustomerTickets(chatID, user)
+	case strings.HasPrefix(text, "/history"):
+		handleHistoryCommand(message, user)
+	case strings.HasPrefix(text, "/close"):
+		handleCustomerStatusCommand(message, user, tickets.StatusClosed, "bot.customer.usage.close")
+	case strings.HasPrefix(text, "/reopen"):
+		handleCustomerStatusCommand(message, user, tickets.StatusOpen, "bot.customer.usage.reopen")
 	default:
-		sendMessage(chatID, "Неизвестная команда. Используйте /help.")
+		sendMessage(chatID, html(lang, "bot.customer.unknown_command"))
 	}
 }
 
 func handleStatusCommand(message *tgbotapi.Message, user *models.User) {
 	chatID := message.Chat.ID
 	parts := strings.Fields(message.Text)
+	lang := language(user)
 
 	if len(parts) < 2 {
-		sendMessage(chatID, "Использование: /status <номер_тикета>")
+		sendMessage(chatID, html(lang, "bot.usage.status"))
 		return
 	}
 
 	ticketID, err := strconv.Atoi(parts[1])
 	if err != nil {
-		sendMessage(chatID, "Неверный номер тикета.")
+		sendMessage(chatID, html(lang, "bot.error.bad_ticket_id"))
 		return
 	}
 
 	ticket, err := db.GetTicketByID(ticketID)
 	if err != nil || ticket == nil {
-		sendMessage(chatID, "Тикет не найден.")
+		sendMessage(chatID, html(lang, "bot.error.ticket_not_found"))
 		return
 	}
 
 	if ticket.CustomerID == nil || *ticket.CustomerID != user.ID {
-		sendMessage(chatID, "У вас нет доступа к этому тикету.")
+		sendMessage(chatID, html(lang, "bot.error.no_access"))
+		return
+	}
+
+	status := tickets.StatusLabel(ticket.OrganizationID, ticket.Status, lang)
+
+	sendMessage(chatID, html(lang, "bot.customer.status", ticket.ID, status, tickets.PriorityLabel(ticket.Priority, lang)))
+}
+
+// handleBookCommand offers the customer free appointment slots for their
+// ticket: the one given as argument or their only active ticket.
+func handleBookCommand(message *tgbotapi.Message, user *models.User) {
+	chatID := message.Chat.ID
+	parts := strings.Fields(message.Text)
+	lang := language(user)
+
+	var ticket *models.Ticket
+	if len(parts) > 1 {
+		ticketID, err := strconv.Atoi(parts[1])
+		if err != nil {
+			sendMessage(chatID, html(lang, "bot.error.bad_ticket_id"))
+			return
+		}
+		ticket, err = db.GetTicketByID(ticketID)
+		if err != nil || ticket == nil || ticket.CustomerID == nil || *ticket.CustomerID != user.ID {
+			sendMessage(chatID, html(lang, "bot.error.request_not_found"))
+			return
+		}
+	} else {
+		list, err := db.GetActiveTicketsByCustomer(user.ID, time.Time{})
+		if err != nil {
+			log.Printf("Error getting active tickets: %v", err)
+			sendMessage(chatID, html(lang, "bot.error.generic"))
+			return
+		}
+		switch len(list) {
+		case 0:
+			sendMessage(chatID, html(lang, "bot.book.no_tickets"))
+			return
+		case 1:
+			ticket = list[0]
+		default:
+			var sb strings.Builder
+			sb.WriteString(string(html(lang, "bot.book.choose_ticket")) + "\n\n")
+			for _, t := range list {
+				sb.WriteString(fmt.Sprintf("#%d — %s\n", t.ID, richtext.Escape(truncate(t.Title, 40))))
+			}
+			sendMessage(chatID, richtext.HTML(sb.String()))
+			return
+		}
+	}
+
+	if base := tickets.BaseStatus(ticket.OrganizationID, ticket.Status); base == tickets.StatusResolved || base == tickets.StatusClosed {
+		sendMessage(chatID, html(lang, "bot.book.already_resolved", ticket.ID))
+		return
+	}
+
+	slots, err := tickets.FreeSlots(ticket.OrganizationID, bookingSlot, 7, 8)
+	if err != nil {
+		log.Printf("Error getting free slots for ticket #%d: %v", ticket.ID, err)
+		sendMessage(chatID, html(lang, "bot.book.unavailable"))
+		return
+	}
+	if len(slots) == 0 {
+		sendMessage(chatID, html(lang, "bot.book.no_slots"))
+		return
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, slot := range slots {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(
+				slotLabel(slot, lang),
+				fmt.Sprintf("book_%d_%d", ticket.ID, slot.Unix()),
+			),
+		))
+	}
+
+	sendWithKeyboard(chatID, html(lang, "bot.book.choose_slot", ticket.ID), tgbotapi.NewInlineKeyboardMarkup(rows...))
+}
+
+// slotLabel formats a slot in its own timezone, e.g. "Ср 21.10 14:00–15:00".
+func slotLabel(start time.Time, lang string) string {
+	return fmt.Sprintf("%s %s–%s", weekday(start, lang), start.Format("02.01 15:04"), start.Add(bookingSlot).Format("15:04"))
+}
+
+// weekday is the short name of the day of t, e.g. "Ср".
+func weekday(t time.Time, lang string) string {
+	return i18n.T(lang, fmt.Sprintf("weekday.short.%d", t.Weekday()))
+}
+
+// handleBookSlot books the slot the customer picked.
+func handleBookSlot(callback *tgbotapi.CallbackQuery) {
+	chatID := callback.Message.Chat.ID
+	messageID := callback.Message.MessageID
+
+	parts := strings.Split(callback.Data, "_")
+	if len(parts) != 3 {
+		return
+	}
+	ticketID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return
+	}
+	unix, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return
+	}
+
+	user, err := db.GetUserByTelegramID(chatID)
+	if err != nil || user == nil {
 		return
 	}
+	lang := language(user)
 
-	statusText := map[string]string{
-		"open":        "Открыт",
-		"in_progress": "В работе",
-		"resolved":    "Решён",
-		"closed":      "Закрыт",
+	ticket, err := db.GetTicketByID(ticketID)
+	if err != nil || ticket == nil || ticket.CustomerID == nil || *ticket.CustomerID != user.ID {
+		editMessage(chatID, messageID, html(lang, "bot.error.request_not_found"))
+		return
 	}
-	status := statusText[ticket.Status]
-	if status == "" {
-		status = ticket.Status
+
+	event, err := tickets.BookSlot(ticket, tickets.AppointmentVisit, time.Unix(unix, 0), bookingSlot, botActor(user))
+	if err != nil {
+		if errors.Is(err, tickets.ErrSlotUnavailable) {
+			editMessage(chatID, messageID, html(lang, "bot.book.slot_taken"))
+			return
+		}
+		if errors.Is(err, tickets.ErrTicketResolved) {
+			editMessage(chatID, messageID, html(lang, "bot.book.already_resolved", ticketID))
+			return
+		}
+		log.Printf("Error booking slot for ticket #%d: %v", ticketID, err)
+		editMessage(chatID, messageID, html(lang, "bot.book.failed"))
+		return
 	}
 
-	sendMessage(chatID, fmt.Sprintf("Тикет #%d\nСтатус: %s\nПриоритет: %s", ticket.ID, status, ticket.Priority))
+	summary := tickets.AppointmentSummary(event)
+	editMessage(chatID, messageID, html(lang, "bot.book.booked", summary, ticketID))
+	notifyOperatorsAboutTicket(ticket, i18n.M("bot.book.operator_notice", ticketID, summary, richtext.Bold(ticket.Title)))
+	mirrorToGroup(ticket, i18n.M("bot.book.group_notice", summary))
 }
 
 // ─── Operator / Admin commands ────────────────────────────────────────────────
@@ -198,240 +425,194 @@ func handleOperatorCommand(message *tgbotapi.Message, user *models.User) {
 	text := message.Text
 	parts := strings.Fields(text)
 	cmd := parts[0]
+	lang := language(user)
+
+	// ticketArg parses the ticket ID of commands taking at least n arguments
+	ticketArg := func(n int, usage string) (int, bool) {
+		if len(parts) <= n {
+			sendMessage(chatID, html(lang, usage))
+			return 0, false
+		}
+		id, err := strconv.Atoi(parts[1])
+		if err != nil {
+			sendMessage(chatID, html(lang, "bot.error.bad_ticket_id"))
+			return 0, false
+		}
+		return id, true
+	}
 
 	switch cmd {
 	case "/start":
-		role := "Оператор"
+		role := i18n.T(lang, "bot.operator.role.agent")
 		if isAdmin(chatID) {
-			role = "Администратор"
+			role = i18n.T(lang, "bot.operator.role.admin")
 		}
-		sendMessage(chatID, fmt.Sprintf("Вы вошли как %s.\n\n/help — список команд.", role))
+		sendMessage(chatID, html(lang, "bot.operator.welcome", role))
 
 	case "/help":
-		sendMessage(chatID, operatorHelp())
+		sendMessage(chatID, html(lang, "bot.operator.help"))
+
+	case "/language":
+		handleLanguageCommand(chatID, user)
 
 	case "/tickets":
-		handleListTickets(chatID, parts)
+		handleListTickets(chatID, parts, lang)
 
 	case "/mytickets":
 		handleMyTickets(chatID, user)
 
+	case "/digest":
+		handleDigestCommand(chatID, parts, user)
+
 	case "/ticket":
-		if len(parts) < 2 {
-			sendMessage(chatID, "Использование: /ticket <id>")
-			return
+		if id, ok := ticketArg(1, "bot.usage.ticket"); ok {
+			handleViewTicket(chatID, id, lang)
 		}
-		id, err := strconv.Atoi(parts[1])
-		if err != nil {
-			sendMessage(chatID, "Неверный ID тикета.")
-			return
-		}
-		handleViewTicket(chatID, id)
 
 	case "/reply":
-		if len(parts) < 3 {
-			sendMessage(chatID, "Использование: /reply <id> <текст ответа>")
+		id, ok := ticketArg(1, "bot.usage.reply")
+		if !ok {
 			return
 		}
-		id, err := strconv.Atoi(parts[1])
-		if err != nil {
-			sendMessage(chatID, "Неверный ID тикета.")
+		// Keep the line breaks and formatting of the answer
+		replyText := entitiesMarkdown(text, message.Entities)
+		replyText = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(replyText, cmd)), parts[1]))
+		if replyText == "" {
+			startReplyMode(chatID, id, lang)
 			return
 		}
-		replyText := strings.Join(parts[2:], " ")
 		handleReplyToCustomer(chatID, id, user, replyText)
 
+	case "/cancel":
+		cancelReplyMode(chatID, lang)
+
 	case "/assign":
-		if len(parts) < 2 {
-			sendMessage(chatID, "Использование: /assign <id>")
-			return
-		}
-		id, err := strconv.Atoi(parts[1])
-		if err != nil {
-			sendMessage(chatID, "Неверный ID тикета.")
-			return
+		if id, ok := ticketArg(1, "bot.usage.assign"); ok {
+			handleAssign(chatID, id, user)
 		}
-		handleAssign(chatID, id, user)
 
 	case "/resolve":
-		if len(parts) < 2 {
-			sendMessage(chatID, "Использование: /resolve <id>")
-			return
-		}
-		id, err := strconv.Atoi(parts[1])
-		if err != nil {
-			sendMessage(chatID, "Неверный ID тикета.")
-			return
+		if id, ok := ticketArg(1, "bot.usage.resolve"); ok {
+			handleSetStatus(chatID, id, tickets.StatusResolved, user)
 		}
-		handleSetStatus(chatID, id, "resolved", "Решён")
 
 	case "/close":
-		if len(parts) < 2 {
-			sendMessage(chatID, "Использование: /close <id>")
-			return
+		if id, ok := ticketArg(1, "bot.usage.close"); ok {
+			handleSetStatus(chatID, id, tickets.StatusClosed, user)
 		}
-		id, err := strconv.Atoi(parts[1])
-		if err != nil {
-			sendMessage(chatID, "Неверный ID тикета.")
-			return
+
+	case "/setstatus":
+		if id, ok := ticketArg(2, "bot.usage.setstatus"); ok {
+			handleSetStatus(chatID, id, parts[2], user)
 		}
-		handleSetStatus(chatID, id, "closed", "Закрыт")
 
-	case "/reopen":
-		if len(parts) < 2 {
-			sendMessage(chatID, "Использование: /reopen <id>")
-			return
+	case "/priority":
+		if id, ok := ticketArg(2, "bot.usage.priority"); ok {
+			handleSetPriority(chatID, id, strings.ToLower(parts[2]), user)
 		}
-		id, err := strconv.Atoi(parts[1])
-		if err != nil {
-			sendMessage(chatID, "Неверный ID тикета.")
+
+	case "/schedule":
+		id, ok := ticketArg(4, "bot.usage.schedule")
+		if !ok {
 			return
 		}
-		handleSetStatus(chatID, id, "open", "Открыт")
+		kind := tickets.AppointmentVisit
+		if len(parts) > 5 {
+			kind = strings.ToLower(parts[5])
+		}
+		handleSchedule(chatID, id, parts[2], parts[3], parts[4], kind, user)
+
+	case "/reopen":
+		if id, ok := ticketArg(1, "bot.usage.reopen"); ok {
+			handleSetStatus(chatID, id, tickets.StatusOpen, user)
+		}
 
 	default:
-		sendMessage(chatID, "Неизвестная команда. /help — список команд.")
+		sendMessage(chatID, html(lang, "bot.operator.unknown_command"))
 	}
 }
 
-func operatorHelp() string {
-	return `Команды оператора:
-
-/tickets [open|in_progress|resolved|all] — список тикетов
-/mytickets — мои тикеты
-/ticket <id> — просмотр тикета
-/reply <id> <текст> — ответить клиенту
-/assign <id> — взять тикет себе
-/resolve <id> — пометить как решённый
-/close <id> — закрыть тикет
-/reopen <id> — переоткрыть тикет`
-}
-
-func handleListTickets(chatID int64, parts []string) {
+func handleListTickets(chatID int64, parts []string, lang string) {
 	statusFilter := "open"
 	if len(parts) >= 2 {
 		statusFilter = parts[1]
 	}
 
-	tickets, err := db.GetTicketsByOrganization(1, statusFilter)
+	list, err := db.GetTicketsByOrganization(1, statusFilter)
 	if err != nil {
-		sendMessage(chatID, "Ошибка при получении тикетов.")
+		sendMessage(chatID, html(lang, "bot.error.tickets"))
 		return
 	}
 
-	if len(tickets) == 0 {
-		sendMessage(chatID, "Тикетов нет.")
+	if len(list) == 0 {
+		sendMessage(chatID, html(lang, "bot.operator.no_tickets"))
 		return
 	}
 
-	// Show up to 10 tickets
-	if len(tickets) > 10 {
-		tickets = tickets[:10]
-	}
-
-	statusLabel := map[string]string{
-		"open":        "Открыт",
-		"in_progress": "В работе",
-		"resolved":    "Решён",
-		"closed":      "Закрыт",
+	// Show up to 10 list
+	if len(list) > 10 {
+		list = list[:10]
 	}
 
 	var sb strings.Builder
-	sb.WriteString(fmt.Sprintf("Тикеты (%s):\n\n", statusFilter))
-	for _, t := range tickets {
-		st := statusLabel[t.Status]
-		if st == "" {
-			st = t.Status
-		}
-		sb.WriteString(fmt.Sprintf("#%d [%s] %s\n", t.ID, st, truncate(t.Title, 50)))
+	sb.WriteString(string(html(lang, "bot.operator.tickets", statusFilter)) + "\n\n")
+	for _, t := range list {
+		st := tickets.StatusLabel(t.OrganizationID, t.Status, lang)
+		sb.WriteString(fmt.Sprintf("%s#%d [%s] %s\n", priorityMark(t.Priority), t.ID, richtext.Escape(st), richtext.Escape(truncate(t.Title, 50))))
 	}
-	sb.WriteString("\n/ticket <id> — подробнее")
+	sb.WriteString("\n" + string(html(lang, "bot.operator.tickets_hint")))
 
-	sendMessage(chatID, sb.String())
+	sendMessage(chatID, richtext.HTML(sb.String()))
 }
 
 func handleMyTickets(chatID int64, user *models.User) {
-	tickets, err := db.GetTicketsByAgent(user.ID)
+	lang := language(user)
+
+	list, err := db.GetTicketsByAgent(user.ID)
 	if err != nil {
-		sendMessage(chatID, "Ошибка при получении тикетов.")
+		sendMessage(chatID, html(lang, "bot.error.tickets"))
 		return
 	}
 
-	if len(tickets) == 0 {
-		sendMessage(chatID, "У вас нет назначенных тикетов.")
+	if len(list) == 0 {
+		sendMessage(chatID, html(lang, "bot.operator.no_my_tickets"))
 		return
 	}
 
-	statusLabel := map[string]string{
-		"open":        "Открыт",
-		"in_progress": "В работе",
-		"resolved":    "Решён",
-		"closed":      "Закрыт",
-	}
-
 	var sb strings.Builder
-	sb.WriteString("Мои тикеты:\n\n")
-	for _, t := range tickets {
-		st := statusLabel[t.Status]
-		if st == "" {
-			st = t.Status
-		}
-		sb.WriteString(fmt.Sprintf("#%d [%s] %s\n", t.ID, st, truncate(t.Title, 50)))
+	sb.WriteString(string(html(lang, "bot.operator.my_tickets")) + "\n\n")
+	for _, t := range list {
+		st := tickets.StatusLabel(t.OrganizationID, t.Status, lang)
+		sb.WriteString(fmt.Sprintf("%s#%d [%s] %s\n", priorityMark(t.Priority), t.ID, richtext.Escape(st), richtext.Escape(truncate(t.Title, 50))))
 	}
 
-	sendMessage(chatID, sb.String())
+	sendMessage(chatID, richtext.HTML(sb.String()))
 }
 
-func handleViewTicket(chatID int64, ticketID int) {
+func handleViewTicket(chatID int64, ticketID int, lang string) {
 	ticket, err := db.GetTicketByID(ticketID)
 	if err != nil || ticket == nil {
-		sendMessage(chatID, "Тикет не найден.")
+		sendMessage(chatID, html(lang, "bot.error.ticket_not_found"))
 		return
 	}
 
-	messages, err := db.GetMessagesByTicket(ticketID)
+	text, err := ticketViewText(ticket, lang)
 	if err != nil {
-		sendMessage(chatID, "Ошибка при получении сообщений.")
+		sendMessage(chatID, html(lang, "bot.error.messages"))
 		return
 	}
 
-	statusLabel := map[string]string{
-		"open":        "Открыт",
-		"in_progress": "В работе",
-		"resolved":    "Решён",
-		"closed":      "Закрыт",
-	}
-	st := statusLabel[ticket.Status]
-	if st == "" {
-		st = ticket.Status
-	}
-
-	var sb strings.Builder
-	sb.WriteString(fmt.Sprintf("Тикет #%d\nСтатус: %s | Приоритет: %s\nТема: %s\n\n", ticket.ID, st, ticket.Priority, ticket.Title))
-
-	// Last 5 messages
-	start := 0
-	if len(messages) > 5 {
-		start = len(messages) - 5
-		sb.WriteString(fmt.Sprintf("(показаны последние %d из %d сообщений)\n\n", 5, len(messages)))
-	}
-	for _, m := range messages[start:] {
-		from := "Клиент"
-		if !m.IsFromCustomer {
-			from = "Оператор"
-		}
-		sb.WriteString(fmt.Sprintf("[%s] %s: %s\n", m.CreatedAt.Format("02.01 15:04"), from, truncate(m.Content, 100)))
+	if sent := sendWithKeyboard(chatID, text, ticketKeyboard(ticket, lang)); sent != nil {
+		linkMessage(chatID, sent.MessageID, ticket.ID)
 	}
-
-	sb.WriteString(fmt.Sprintf("\n/reply %d <текст> — ответить\n/assign %d — взять себе\n/resolve %d — решить", ticket.ID, ticket.ID, ticket.ID))
-
-	sendMessage(chatID, sb.String())
 }
 
 func handleReplyToCustomer(chatID int64, ticketID int, agent *models.User, text string) {
+	lang := language(agent)
+
 	ticket, err := db.GetTicketByID(ticketID)
 	if err != nil || ticket == nil {
-		sendMessage(chatID, "Тикет не найден.")
+		sendMessage(chatID, html(lang, "bot.error.ticket_not_found"))
 		return
 	}
 
@@ -442,107 +623,376 @@ func handleReplyToCustomer(chatID int64, ticketID int, agent *models.User, text
 		IsFromCustomer: false,
 	}
 
-	if err := db.CreateMessage(msg); err != nil {
+	if err := tickets.AddMessage(ticket, msg, botActor(agent)); err != nil {
 		log.Printf("Error creating message: %v", err)
-		sendMessage(chatID, "Ошибка при отправке ответа.")
+		sendMessage(chatID, html(lang, "bot.error.reply"))
 		return
 	}
 
 	// Update ticket status if open
-	if ticket.Status == "open" {
-		db.UpdateTicketStatus(ticketID, "in_progress")
+	if err := tickets.StartWork(ticket, botActor(agent)); err != nil {
+		log.Printf("Error updating ticket status: %v", err)
 	}
 
+	mirrorToGroup(ticket, i18n.M("bot.group.agent_message", displayName(agent), richtext.Markdown(text)))
+
 	// Send to customer's Telegram if available
-	if ticket.TelegramChatID != nil {
-		customerMsg := fmt.Sprintf("Ответ по тикету #%d:\n\n%s", ticketID, text)
-		sendMessage(*ticket.TelegramChatID, customerMsg)
+	if sent := notifyCustomer(ticket, i18n.M("bot.reply.to_customer", ticketID, richtext.Markdown(text))); sent != nil {
+		linkMessage(sent.Chat.ID, sent.MessageID, ticketID)
 	}
 
-	sendMessage(chatID, fmt.Sprintf("Ответ отправлен в тикет #%d.", ticketID))
+	sendMessage(chatID, html(lang, "bot.reply.sent", ticketID))
 }
 
 func handleAssign(chatID int64, ticketID int, user *models.User) {
+	text, _ := assignTicket(ticketID, user)
+	sendMessage(chatID, richtext.Escape(text))
+}
+
+// assignTicket assigns the ticket to the operator and tells the customer. It
+// returns the result for the operator and whether the ticket was changed.
+func assignTicket(ticketID int, user *models.User) (string, bool) {
+	lang := language(user)
+
 	ticket, err := db.GetTicketByID(ticketID)
 	if err != nil || ticket == nil {
-		sendMessage(chatID, "Тикет не найден.")
-		return
+		return i18n.T(lang, "bot.error.ticket_not_found"), false
 	}
 
-	if err := db.AssignTicket(ticketID, user.ID); err != nil {
+	if err := tickets.Assign(ticket, user.ID, botActor(user)); err != nil {
 		log.Printf("Error assigning ticket: %v", err)
-		sendMessage(chatID, "Ошибка при назначении тикета.")
-		return
+		return i18n.T(lang, "bot.error.assign"), false
 	}
 
-	sendMessage(chatID, fmt.Sprintf("Тикет #%d назначен вам.", ticketID))
+	NotifyCustomer(ticket, i18n.M("bot.customer.assigned", ticketID))
+
+	return i18n.T(lang, "bot.operator.assigned", ticketID), true
+}
+
+func handleSetStatus(chatID int64, ticketID int, status string, user *models.User) {
+	text, _ := setTicketStatus(ticketID, status, user)
+	sendMessage(chatID, richtext.Escape(text))
+}
+
+// setTicketStatus changes the ticket status and tells the customer when the
+// ticket was closed or reopened. Resolved tickets ask for a rating instead,
+// see RequestRating.
+func setTicketStatus(ticketID int, status string, user *models.User) (string, bool) {
+	lang := language(user)
+
+	ticket, err := db.GetTicketByID(ticketID)
+	if err != nil || ticket == nil {
+		return i18n.T(lang, "bot.error.ticket_not_found"), false
+	}
+
+	fromBase := tickets.BaseStatus(ticket.OrganizationID, ticket.Status)
+	if err := tickets.ChangeStatus(ticket, status, botActor(user)); err != nil {
+		switch {
+		case errors.Is(err, tickets.ErrUnknownStatus):
+			return i18n.T(lang, "bot.operator.unknown_status", status), false
+		case errors.Is(err, tickets.ErrInvalidTransition):
+			return i18n.T(lang, "bot.operator.invalid_transition", ticketID,
+				tickets.StatusLabel(ticket.OrganizationID, ticket.Status, lang), tickets.StatusLabel(ticket.OrganizationID, status, lang)), false
+		default:
+			log.Printf("Error updating ticket status: %v", err)
+			return i18n.T(lang, "bot.error.status"), false
+		}
+	}
 
-	// Notify customer
-	if ticket.TelegramChatID != nil {
-		sendMessage(*ticket.TelegramChatID, fmt.Sprintf("Ваше обращение #%d взято в работу.", ticketID))
+	toBase := tickets.BaseStatus(ticket.OrganizationID, status)
+	if fromBase != toBase {
+		switch toBase {
+		case tickets.StatusClosed, tickets.StatusOpen:
+			NotifyCustomer(ticket, i18n.M("bot.customer.status_"+toBase, ticketID))
+		}
 	}
+
+	return i18n.T(lang, "bot.operator.status_changed", ticketID, tickets.StatusLabel(ticket.OrganizationID, status, lang)), true
+}
+
+func handleSetPriority(chatID int64, ticketID int, priority string, user *models.User) {
+	text, _ := setTicketPriority(ticketID, priority, user)
+	sendMessage(chatID, richtext.Escape(text))
 }
 
-func handleSetStatus(chatID int64, ticketID int, status, label string) {
+func setTicketPriority(ticketID int, priority string, user *models.User) (string, bool) {
+	lang := language(user)
+
+	if !models.IsValidPriority(priority) {
+		return i18n.T(lang, "bot.operator.invalid_priority"), false
+	}
+
+	ticket, err := db.GetTicketByID(ticketID)
+	if err != nil || ticket == nil {
+		return i18n.T(lang, "bot.error.ticket_not_found"), false
+	}
+
+	if err := tickets.ChangePriority(ticket, priority, botActor(user)); err != nil {
+		log.Printf("Error updating ticket priority: %v", err)
+		return i18n.T(lang, "bot.error.priority"), false
+	}
+
+	return i18n.T(lang, "bot.operator.priority_changed", ticketID, tickets.PriorityLabel(priority, lang)), true
+}
+
+// parseDuration accepts minutes ("90") or a Go duration ("1h30m").
+func parseDuration(s string) (time.Duration, error) {
+	if minutes, err := strconv.Atoi(s); err == nil {
+		return time.Duration(minutes) * time.Minute, nil
+	}
+	return time.ParseDuration(s)
+}
+
+func handleSchedule(chatID int64, ticketID int, date, clock, duration, kind string, user *models.User) {
+	lang := language(user)
+
 	ticket, err := db.GetTicketByID(ticketID)
 	if err != nil || ticket == nil {
-		sendMessage(chatID, "Тикет не найден.")
+		sendMessage(chatID, html(lang, "bot.error.ticket_not_found"))
 		return
 	}
 
-	if err := db.UpdateTicketStatus(ticketID, status); err != nil {
-		log.Printf("Error updating ticket status: %v", err)
-		sendMessage(chatID, "Ошибка при обновлении статуса.")
+	d, err := parseDuration(duration)
+	if err != nil || d <= 0 {
+		sendMessage(chatID, html(lang, "bot.schedule.bad_duration"))
 		return
 	}
 
-	sendMessage(chatID, fmt.Sprintf("Тикет #%d: статус изменён на «%s».", ticketID, label))
+	start, err := tickets.ParseAppointmentTime(ticket.OrganizationID, date, clock)
+	if err != nil {
+		sendMessage(chatID, html(lang, "bot.schedule.bad_time"))
+		return
+	}
 
-	// Notify customer
-	if ticket.TelegramChatID != nil {
-		statusMsg := map[string]string{
-			"resolved": fmt.Sprintf("Ваше обращение #%d отмечено как решённое. Если проблема осталась — напишите нам.", ticketID),
-			"closed":   fmt.Sprintf("Ваше обращение #%d закрыто.", ticketID),
-			"open":     fmt.Sprintf("Ваше обращение #%d переоткрыто.", ticketID),
-		}
-		if text, ok := statusMsg[status]; ok {
-			sendMessage(*ticket.TelegramChatID, text)
+	event, err := tickets.ScheduleAppointment(ticket, kind, start, d, botActor(user))
+	if err != nil {
+		if errors.Is(err, tickets.ErrInvalidAppointment) {
+			sendMessage(chatID, html(lang, "bot.schedule.invalid"))
+			return
 		}
+		log.Printf("Error scheduling appointment for ticket #%d: %v", ticketID, err)
+		sendMessage(chatID, html(lang, "bot.schedule.failed"))
+		return
 	}
+
+	summary := tickets.AppointmentSummary(event)
+	sendMessage(chatID, html(lang, "bot.schedule.done", ticketID, summary))
+	NotifyCustomer(ticket, i18n.M("bot.customer.appointment_scheduled", ticketID, summary))
 }
 
 // ─── Customer ticket creation ─────────────────────────────────────────────────
 
-func createTicketFromMessage(message *tgbotapi.Message, user *models.User) {
+// handleCustomerFollowUp routes a plain customer message either to their
+// recently active ticket, to a resolved one its organization has not
+// auto-closed yet, reopening it, or to a new one.
+// When several tickets are active the customer is asked to pick one with
+// inline buttons.
+func handleCustomerFollowUp(message *tgbotapi.Message, user *models.User) {
 	chatID := message.Chat.ID
+
+	if threadWindow <= 0 || message.Text == "" {
+		createTicketFromMessage(message, user)
+		return
+	}
+
+	lang := language(user)
+
+	// The customer has yet to choose the ticket of earlier messages
+	pendingMessages.Lock()
+	waiting := len(pendingMessages.m[chatID]) > 0
+	if waiting {
+		pendingMessages.m[chatID] = append(pendingMessages.m[chatID], message)
+	}
+	pendingMessages.Unlock()
+	if waiting {
+		sendMessage(chatID, html(lang, "bot.thread.queued"))
+		return
+	}
+
+	now := time.Now()
+	list, err := db.GetFollowUpTicketsByCustomer(user.ID, now.Add(-threadWindow), now)
+	if err != nil {
+		log.Printf("Error getting active list: %v", err)
+		createTicketFromMessage(message, user)
+		return
+	}
+
+	switch len(list) {
+	case 0:
+		createTicketFromMessage(message, user)
+	case 1:
+		if err := appendCustomerMessage(message, user, list[0]); err != nil {
+			log.Printf("Error creating message: %v", err)
+			sendMessage(chatID, html(lang, "bot.error.add_message"))
+			return
+		}
+		sendMessage(chatID, html(lang, "bot.customer.message_added", list[0].ID))
+	default:
+		// Offer at most three of the most recent list
+		if len(list) > 3 {
+			list = list[:3]
+		}
+
+		var rows [][]tgbotapi.InlineKeyboardButton
+		for _, t := range list {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(
+					i18n.T(lang, "bot.thread.add_to", t.ID, truncate(t.Title, 30)),
+					fmt.Sprintf("thread_add_%d", t.ID),
+				),
+			))
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(i18n.T(lang, "bot.thread.new"), "thread_new"),
+		))
+
+		if queuePendingMessage(chatID, message) {
+			sendMessage(chatID, html(lang, "bot.thread.queued"))
+			return
+		}
+		sendWithKeyboard(chatID, html(lang, "bot.thread.choose"), tgbotapi.NewInlineKeyboardMarkup(rows...))
+	}
+}
+
+// handleThreadChoice resolves a pending customer message after the customer
+// picked an existing ticket or asked for a new one.
+func handleThreadChoice(callback *tgbotapi.CallbackQuery) {
+	chatID := callback.Message.Chat.ID
+
+	user, err := db.GetUserByTelegramID(chatID)
+	if err != nil || user == nil {
+		return
+	}
+	lang := language(user)
+
+	pendingMessages.Lock()
+	queued := pendingMessages.m[chatID]
+	delete(pendingMessages.m, chatID)
+	pendingMessages.Unlock()
+
+	if len(queued) == 0 {
+		editMessage(chatID, callback.Message.MessageID, html(lang, "bot.thread.already_handled"))
+		return
+	}
+
+	if callback.Data == "thread_new" {
+		editMessage(chatID, callback.Message.MessageID, html(lang, "bot.thread.creating"))
+		createTicketFromMessage(joinMessages(queued), user)
+		return
+	}
+
+	ticketID, err := strconv.Atoi(strings.TrimPrefix(callback.Data, "thread_add_"))
+	if err != nil {
+		return
+	}
+
+	ticket, err := db.GetTicketByID(ticketID)
+	if err != nil || ticket == nil || ticket.CustomerID == nil || *ticket.CustomerID != user.ID {
+		editMessage(chatID, callback.Message.MessageID, html(lang, "bot.error.request_not_found"))
+		return
+	}
+
+	// The ticket may have been closed while the customer was choosing
+	if tickets.BaseStatus(ticket.OrganizationID, ticket.Status) == tickets.StatusClosed {
+		editMessage(chatID, callback.Message.MessageID, html(lang, "bot.thread.closed_new", ticket.ID))
+		createTicketFromMessage(joinMessages(queued), user)
+		return
+	}
+
+	for _, message := range queued {
+		if err := appendCustomerMessage(message, user, ticket); err != nil {
+			log.Printf("Error creating message: %v", err)
+			editMessage(chatID, callback.Message.MessageID, html(lang, "bot.error.add_message"))
+			return
+		}
+	}
+
+	editMessage(chatID, callback.Message.MessageID, html(lang, "bot.customer.message_added", ticket.ID))
+}
+
+// joinMessages merges pending messages into the first one to open a single
+// ticket with all of them.
+func joinMessages(queued []*tgbotapi.Message) *tgbotapi.Message {
+	if len(queued) == 1 {
+		return queued[0]
+	}
+	joined := *queued[0]
+	texts := make([]string, len(queued))
+	for i, m := range queued {
+		texts[i] = m.Text
+	}
+	joined.Text = strings.Join(texts, "\n\n")
+	return &joined
+}
+
+// appendCustomerMessage stores a customer message on an existing ticket and
+// lets operators know about it.
+func appendCustomerMessage(message *tgbotapi.Message, user *models.User, ticket *models.Ticket) error {
+	msg := &models.Message{
+		TicketID:       ticket.ID,
+		UserID:         &user.ID,
+		Content:        message.Text,
+		IsFromCustomer: user.Role == "customer",
+	}
+	if message.MessageID != 0 {
+		msgID := int(message.MessageID)
+		msg.TelegramMessageID = &msgID
+	}
+
+	if err := tickets.AddMessage(ticket, msg, botActor(user)); err != nil {
+		return err
+	}
+
+	notifyOperatorsAboutTicket(ticket, i18n.M("bot.operator.new_message", ticket.ID, userName(message.From), truncate(message.Text, 200)))
+	mirrorToGroup(ticket, i18n.M("bot.group.customer_message", userName(message.From), message.Text))
+	return nil
+}
+
+func createTicketFromMessage(message *tgbotapi.Message, user *models.User) {
 	text := message.Text
 
 	if text == "" {
-		sendMessage(chatID, "Пожалуйста, отправьте текстовое сообщение.")
+		sendMessage(message.Chat.ID, html(language(user), "bot.customer.text_only"))
 		return
 	}
 
-	ticket := &models.Ticket{
-		OrganizationID: user.OrganizationID,
-		CustomerID:     &user.ID,
-		Title:          truncate(text, 100),
-		Description:    &text,
-		Status:         "open",
-		Priority:       "medium",
-		TelegramChatID: &chatID,
-	}
+	openTicket(message, user, &models.Ticket{
+		Title:       truncate(text, 100),
+		Description: &text,
+		Priority:    "medium",
+	}, nil)
+}
+
+// openTicket creates the customer's ticket with the message as its first
+// message and the intake answers as its fields, then lets the customer and
+// the operators know.
+func openTicket(message *tgbotapi.Message, user *models.User, ticket *models.Ticket, fields []*models.TicketField) {
+	chatID := message.Chat.ID
+	text := message.Text
+	lang := language(user)
+
+	ticket.OrganizationID = user.OrganizationID
+	ticket.CustomerID = &user.ID
+	ticket.Status = "open"
+	ticket.TelegramChatID = &chatID
 
 	if message.MessageID != 0 {
 		msgID := int(message.MessageID)
 		ticket.TelegramMessageID = &msgID
 	}
 
-	if err := db.CreateTicket(ticket); err != nil {
+	if err := tickets.Create(ticket, botActor(user)); err != nil {
 		log.Printf("Error creating ticket: %v", err)
-		sendMessage(chatID, "Произошла ошибка при создании обращения.")
+		sendMessage(chatID, html(lang, "bot.error.create_ticket"))
 		return
 	}
 
+	if len(fields) > 0 {
+		if err := db.SaveTicketFields(ticket.ID, fields); err != nil {
+			log.Printf("Error saving fields of ticket #%d: %v", ticket.ID, err)
+		}
+	}
+
 	msg := &models.Message{
 		TicketID:       ticket.ID,
 		UserID:         &user.ID,
@@ -553,23 +1003,46 @@ func createTicketFromMessage(message *tgbotapi.Message, user *models.User) {
 		msgID := int(message.MessageID)
 		msg.TelegramMessageID = &msgID
 	}
-	db.CreateMessage(msg)
+	if err := tickets.AddMessage(ticket, msg, botActor(user)); err != nil {
+		log.Printf("Error creating message: %v", err)
+	}
 
-	sentMsg := sendMessage(chatID, fmt.Sprintf("Обращение #%d создано. Мы ответим вам в ближайшее время.", ticket.ID))
-	if sentMsg != nil && sentMsg.MessageID != 0 {
-		msgID := int(sentMsg.MessageID)
-		ticket.TelegramMessageID = &msgID
+	if sentMsg := sendMessage(chatID, ticketCreatedText(ticket, lang)); sentMsg != nil {
+		linkMessage(chatID, sentMsg.MessageID, ticket.ID)
 	}
 
 	// Notify all operators
-	NotifyOperators(fmt.Sprintf("Новое обращение #%d от %s:\n\n%s", ticket.ID, userName(message.From), truncate(text, 200)))
+	notifyOperatorsAboutTicket(ticket, i18n.M("bot.operator.new_ticket",
+		ticket.ID, userName(message.From), richtext.Bold(ticket.Title), fieldsText(fields), truncate(text, 200)))
+	postTicketToGroup(ticket)
 
 	log.Printf("New ticket #%d created by user %d", ticket.ID, user.ID)
 }
 
+// ticketCreatedText confirms a new ticket, telling customers who write outside
+// working hours when to expect an answer.
+func ticketCreatedText(ticket *models.Ticket, lang string) richtext.HTML {
+	text := html(lang, "bot.customer.ticket_created", ticket.ID)
+
+	sched, err := schedule.ForOrganization(ticket.OrganizationID)
+	if err != nil {
+		log.Printf("Error loading schedule: %v", err)
+		return text
+	}
+
+	now := time.Now()
+	if sched.IsOpen(now) {
+		return text
+	}
+
+	next := sched.NextOpen(now).In(sched.Location)
+	return html(lang, "bot.customer.ticket_created_after_hours", ticket.ID, weekday(next, lang), next.Format("02.01 15:04"))
+}
+
 func handleReplyToTicket(message *tgbotapi.Message, user *models.User) {
 	chatID := message.Chat.ID
 	text := message.Text
+	lang := language(user)
 
 	if text == "" {
 		return
@@ -577,43 +1050,42 @@ func handleReplyToTicket(message *tgbotapi.Message, user *models.User) {
 
 	repliedMsgID := message.ReplyToMessage.MessageID
 
-	tickets, err := db.GetTicketsByOrganization(user.OrganizationID, "")
+	var ticket *models.Ticket
+	ticketID, err := db.GetLinkedTicketID(chatID, repliedMsgID)
 	if err != nil {
-		log.Printf("Error getting tickets: %v", err)
-		return
+		log.Printf("Error looking up message link: %v", err)
 	}
-
-	var ticket *models.Ticket
-	for _, t := range tickets {
-		if t.TelegramMessageID != nil && *t.TelegramMessageID == repliedMsgID {
+	if ticketID != 0 {
+		if t, err := db.GetTicketByID(ticketID); err == nil && t != nil && t.CustomerID != nil && *t.CustomerID == user.ID {
 			ticket = t
-			break
+		}
+	} else {
+		// Tickets created before message links were recorded
+		list, err := db.GetTicketsByOrganization(user.OrganizationID, "")
+		if err != nil {
+			log.Printf("Error getting list: %v", err)
+			return
+		}
+		for _, t := range list {
+			if t.TelegramMessageID != nil && *t.TelegramMessageID == repliedMsgID {
+				ticket = t
+				break
+			}
 		}
 	}
 
 	if ticket == nil {
-		sendMessage(chatID, "Не удалось найти тикет для этого сообщения.")
+		sendMessage(chatID, html(lang, "bot.customer.reply_no_ticket"))
 		return
 	}
 
-	msg := &models.Message{
-		TicketID:       ticket.ID,
-		UserID:         &user.ID,
-		Content:        text,
-		IsFromCustomer: user.Role == "customer",
-	}
-	if message.MessageID != 0 {
-		msgID := int(message.MessageID)
-		msg.TelegramMessageID = &msgID
-	}
-
-	if err := db.CreateMessage(msg); err != nil {
+	if err := appendCustomerMessage(message, user, ticket); err != nil {
 		log.Printf("Error creating message: %v", err)
-		sendMessage(chatID, "Ошибка при добавлении сообщения.")
+		sendMessage(chatID, html(lang, "bot.error.add_message"))
 		return
 	}
 
-	sendMessage(chatID, fmt.Sprintf("Сообщение добавлено к обращению #%d.", ticket.ID))
+	sendMessage(chatID, html(lang, "bot.customer.message_added", ticket.ID))
 }
 
 // ─── Callbacks ────────────────────────────────────────────────────────────────
@@ -622,75 +1094,169 @@ func handleCallback(callback *tgbotapi.CallbackQuery) {
 	chatID := callback.Message.Chat.ID
 	data := callback.Data
 
-	if strings.HasPrefix(data, "ticket_") {
+	answer := tgbotapi.NewCallback(callback.ID, "")
+	if strings.HasPrefix(data, "thread_") {
+		handleThreadChoice(callback)
+	} else if strings.HasPrefix(data, "intake_") {
+		handleIntakeCallback(callback)
+	} else if strings.HasPrefix(data, "book_") {
+		handleBookSlot(callback)
+	} else if strings.HasPrefix(data, "lang_") {
+		handleLanguageCallback(callback)
+	} else if strings.HasPrefix(data, "my_") {
+		answer.Text = handleCustomerTicketCallback(callback)
+	} else if strings.HasPrefix(data, "csat_") {
+		answer.Text = handleRatingCallback(callback)
+	} else if strings.HasPrefix(data, "ticket_") {
 		parts := strings.Split(data, "_")
 		if len(parts) >= 3 {
 			action := parts[1]
 			ticketID, err := strconv.Atoi(parts[2])
 			if err == nil {
-				handleTicketAction(action, ticketID, chatID, callback)
+				answer.Text, answer.ShowAlert = handleTicketAction(action, ticketID, parts[3:], chatID, callback)
 			}
 		}
 	}
 
-	BotAPI.Request(tgbotapi.NewCallback(callback.ID, ""))
+	if _, err := BotAPI.Request(answer); err != nil {
+		log.Printf("Error answering callback: %v", err)
+	}
 }
 
-func handleTicketAction(action string, ticketID int, chatID int64, callback *tgbotapi.CallbackQuery) {
-	if !isOperator(chatID) {
-		return
-	}
+// ─── Public helpers ───────────────────────────────────────────────────────────
 
-	user, err := db.GetUserByTelegramID(chatID)
-	if err != nil || user == nil {
-		return
-	}
+// NotifyOperators sends a message to all configured admin and operator
+// Telegram IDs, each in their own language.
+func NotifyOperators(text i18n.Message) {
+	notifyOperators(text, nil)
+}
 
-	switch action {
-	case "assign":
-		handleAssign(chatID, ticketID, user)
-	case "resolve":
-		handleSetStatus(chatID, ticketID, "resolved", "Решён")
+// notifyOperatorsAboutTicket notifies operators with the ticket's action buttons.
+func notifyOperatorsAboutTicket(ticket *models.Ticket, text i18n.Message) {
+	for _, sent := range notifyOperators(text, ticket) {
+		linkMessage(sent.Chat.ID, sent.MessageID, ticket.ID)
 	}
 }
 
-// ─── Public helpers ───────────────────────────────────────────────────────────
-
-// NotifyOperators sends a message to all configured admin and operator Telegram IDs.
-func NotifyOperators(text string) {
+// notifyOperators adds the ticket's action buttons if ticket is not nil. It
+// returns the messages sent.
+func notifyOperators(text i18n.Message, ticket *models.Ticket) []*tgbotapi.Message {
 	if BotAPI == nil {
-		return
+		return nil
 	}
+	var sent []*tgbotapi.Message
 	notified := make(map[int64]bool)
-	for id := range adminIDs {
-		if !notified[id] {
-			sendMessage(id, text)
+	for _, ids := range []map[int64]bool{adminIDs, operatorIDs} {
+		for id := range ids {
+			if notified[id] {
+				continue
+			}
+			lang := chatLanguage(id)
+			var msg *tgbotapi.Message
+			if ticket != nil {
+				msg = sendWithKeyboard(id, htmlMessage(text, lang), ticketKeyboard(ticket, lang))
+			} else {
+				msg = sendMessage(id, htmlMessage(text, lang))
+			}
+			if msg != nil {
+				sent = append(sent, msg)
+			}
 			notified[id] = true
 		}
 	}
-	for id := range operatorIDs {
-		if !notified[id] {
-			sendMessage(id, text)
-			notified[id] = true
-		}
+	return sent
+}
+
+// NotifyCustomer sends text to the ticket's customer in their language if the
+// ticket came from Telegram.
+func NotifyCustomer(ticket *models.Ticket, text i18n.Message) {
+	notifyCustomer(ticket, text)
+}
+
+// notifyCustomer returns the message sent, nil if none was.
+func notifyCustomer(ticket *models.Ticket, text i18n.Message) *tgbotapi.Message {
+	if BotAPI == nil || ticket.TelegramChatID == nil {
+		return nil
+	}
+	return sendMessage(*ticket.TelegramChatID, htmlMessage(text, customerLanguage(ticket)))
+}
+
+// NotifyAdmins sends a message to the configured admin Telegram IDs.
+func NotifyAdmins(text i18n.Message) {
+	if BotAPI == nil {
+		return
+	}
+	for id := range adminIDs {
+		sendMessage(id, htmlMessage(text, chatLanguage(id)))
 	}
 }
 
 func SendTicketNotification(chatID int64, ticket *models.Ticket, message string) {
-	text := fmt.Sprintf("Новое сообщение в обращении #%d:\n\n%s", ticket.ID, message)
-	sendMessage(chatID, text)
+	sendMessage(chatID, html(chatLanguage(chatID), "bot.operator.new_message_short", ticket.ID, message))
 }
 
-func sendMessage(chatID int64, text string) *tgbotapi.Message {
-	msg := tgbotapi.NewMessage(chatID, text)
-	sentMsg, err := BotAPI.Send(msg)
-	if err != nil {
-		log.Printf("Error sending message to %d: %v", chatID, err)
-		return nil
+func sendMessage(chatID int64, text richtext.HTML) *tgbotapi.Message {
+	return send(chatID, text, nil)
+}
+
+func sendWithKeyboard(chatID int64, text richtext.HTML, keyboard tgbotapi.InlineKeyboardMarkup) *tgbotapi.Message {
+	return send(chatID, text, keyboard)
+}
+
+// send sends text in HTML parse mode, as several messages if it is too long
+// for one. The reply markup goes with the last message, which is returned.
+func send(chatID int64, text richtext.HTML, replyMarkup interface{}) *tgbotapi.Message {
+	parts := richtext.Split(text, messageLimit)
+	var sentMsg tgbotapi.Message
+	for i, part := range parts {
+		msg := tgbotapi.NewMessage(chatID, string(part))
+		msg.ParseMode = tgbotapi.ModeHTML
+		if i == len(parts)-1 {
+			msg.ReplyMarkup = replyMarkup
+		}
+		var err error
+		if sentMsg, err = BotAPI.Send(msg); err != nil {
+			log.Printf("Error sending message to %d: %v", chatID, err)
+			return nil
+		}
 	}
 	return &sentMsg
 }
 
+// botActor describes a Telegram user as the author of a ticket change.
+func botActor(user *models.User) tickets.Actor {
+	return tickets.Actor{UserID: &user.ID, Role: user.Role, Channel: tickets.ChannelTelegram}
+}
+
+// priorityMark prefixes high and urgent tickets in lists.
+func priorityMark(priority string) string {
+	switch priority {
+	case "urgent":
+		return "‼️ "
+	case "high":
+		return "❗ "
+	}
+	return ""
+}
+
+// editMessage replaces the text of a bot message. An edit cannot add
+// messages, so a text too long for one is cut.
+func editMessage(chatID int64, messageID int, text richtext.HTML) {
+	edit := tgbotapi.NewEditMessageText(chatID, messageID, string(richtext.Split(text, messageLimit)[0]))
+	edit.ParseMode = tgbotapi.ModeHTML
+	if _, err := BotAPI.Send(edit); err != nil {
+		log.Printf("Error editing message %d in %d: %v", messageID, chatID, err)
+	}
+}
+
+func editMessageWithKeyboard(chatID int64, messageID int, text richtext.HTML, keyboard tgbotapi.InlineKeyboardMarkup) {
+	edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, string(richtext.Split(text, messageLimit)[0]), keyboard)
+	edit.ParseMode = tgbotapi.ModeHTML
+	if _, err := BotAPI.Send(edit); err != nil {
+		log.Printf("Error editing message %d in %d: %v", messageID, chatID, err)
+	}
+}
+
 func truncate(s string, n int) string {
 	if len([]rune(s)) <= n {
 		return s
@@ -700,7 +1266,7 @@ func truncate(s string, n int) string {
 
 func userName(from *tgbotapi.User) string {
 	if from == nil {
-		return "неизвестный"
+		return "—"
 	}
 	name := strings.TrimSpace(fmt.Sprintf("%s %s", from.FirstName, from.LastName))
 	if from.UserName != "" {
@@ -0,0 +1,221 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"helpdesk/internal/db"
+	"helpdesk/internal/i18n"
+	"helpdesk/internal/models"
+	"helpdesk/internal/richtext"
+	"helpdesk/internal/tickets"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ratingCommentTTL is how long the bot waits for a comment to a rating.
+const ratingCommentTTL = 30 * time.Minute
+
+type ratingComment struct {
+	ticketID  int
+	messageID int  // the rating message
+	asked     bool // the customer pressed the comment button
+	since     time.Time
+}
+
+// ratingComments holds the ticket each customer has just rated, keyed by chat
+// ID. A reply to the rating message, or the next message after the comment
+// button, is stored as the rating's comment.
+var ratingComments = struct {
+	sync.Mutex
+	m map[int64]ratingComment
+}{m: make(map[int64]ratingComment)}
+
+// takeRatingComment returns and ends the wait for a comment if a message
+// replying to replyTo (0 for none) is the comment, 0 otherwise.
+func takeRatingComment(chatID int64, replyTo int) int {
+	ratingComments.Lock()
+	defer ratingComments.Unlock()
+
+	wait, ok := ratingComments.m[chatID]
+	if !ok {
+		return 0
+	}
+	if time.Since(wait.since) > ratingCommentTTL {
+		delete(ratingComments.m, chatID)
+		return 0
+	}
+	if replyTo != wait.messageID && !(wait.asked && replyTo == 0) {
+		return 0
+	}
+	delete(ratingComments.m, chatID)
+	return wait.ticketID
+}
+
+// askRatingComment marks the wait for a comment to the ticket's rating as
+// asked for. It reports whether the customer has just rated the ticket.
+func askRatingComment(chatID int64, ticketID int) bool {
+	ratingComments.Lock()
+	defer ratingComments.Unlock()
+
+	wait, ok := ratingComments.m[chatID]
+	if !ok || wait.ticketID != ticketID || time.Since(wait.since) > ratingCommentTTL {
+		return false
+	}
+	wait.asked = true
+	wait.since = time.Now()
+	ratingComments.m[chatID] = wait
+	return true
+}
+
+// forgetRatingComment ends the wait for a comment.
+func forgetRatingComment(chatID int64) {
+	ratingComments.Lock()
+	delete(ratingComments.m, chatID)
+	ratingComments.Unlock()
+}
+
+// skipKeyboard has the single button to skip the rating's comment.
+func skipKeyboard(ticketID int, lang string) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(i18n.T(lang, "bot.button.skip"), fmt.Sprintf("csat_%d_skip", ticketID)),
+	))
+}
+
+// ratingKeyboard offers the scores 1 to 5 and to reopen the ticket instead.
+func ratingKeyboard(ticketID int, lang string) tgbotapi.InlineKeyboardMarkup {
+	var scores []tgbotapi.InlineKeyboardButton
+	for score := 1; score <= 5; score++ {
+		scores = append(scores, tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d ⭐", score), fmt.Sprintf("csat_%d_%d", ticketID, score)))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(
+		scores,
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(i18n.T(lang, "bot.button.reopen"), fmt.Sprintf("my_reopen_%d", ticketID))),
+	)
+}
+
+// RequestRating tells the customer that the ticket is resolved and asks them
+// to rate the support they got.
+func RequestRating(ticket *models.Ticket) {
+	if BotAPI == nil || ticket.TelegramChatID == nil {
+		return
+	}
+	chatID := *ticket.TelegramChatID
+	lang := customerLanguage(ticket)
+
+	text := html(lang, "bot.csat.request", ticket.ID, richtext.Bold(ticket.Title))
+	if sent := sendWithKeyboard(chatID, text, ratingKeyboard(ticket.ID, lang)); sent != nil {
+		linkMessage(chatID, sent.MessageID, ticket.ID)
+	}
+}
+
+// handleRatingCallback handles the score, comment and skip buttons and
+// returns the text for the callback answer.
+func handleRatingCallback(callback *tgbotapi.CallbackQuery) string {
+	chatID := callback.Message.Chat.ID
+	messageID := callback.Message.MessageID
+
+	parts := strings.Split(callback.Data, "_")
+	if len(parts) != 3 {
+		return ""
+	}
+	ticketID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return ""
+	}
+
+	user, err := db.GetUserByTelegramID(callback.From.ID)
+	if err != nil || user == nil {
+		return ""
+	}
+	lang := language(user)
+
+	ticket := ownTicket(ticketID, user)
+	if ticket == nil {
+		return i18n.T(lang, "bot.error.request_not_found")
+	}
+
+	switch parts[2] {
+	case "skip":
+		forgetRatingComment(chatID)
+		editMessage(chatID, messageID, html(lang, "bot.csat.done"))
+		return ""
+	case "comment":
+		if !askRatingComment(chatID, ticket.ID) {
+			editMessage(chatID, messageID, html(lang, "bot.csat.done"))
+			return ""
+		}
+		editMessageWithKeyboard(chatID, messageID, html(lang, "bot.csat.comment_prompt"), skipKeyboard(ticket.ID, lang))
+		return ""
+	}
+
+	score, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return ""
+	}
+	closed, err := tickets.Rate(ticket, score, botActor(user))
+	if err != nil {
+		if errors.Is(err, tickets.ErrNotResolved) {
+			editMessage(chatID, messageID, html(lang, "bot.csat.not_resolved", ticket.ID))
+			return ""
+		}
+		log.Printf("Error rating ticket #%d: %v", ticket.ID, err)
+		return i18n.T(lang, "bot.error.generic")
+	}
+
+	ratingComments.Lock()
+	ratingComments.m[chatID] = ratingComment{ticketID: ticket.ID, messageID: messageID, since: time.Now()}
+	ratingComments.Unlock()
+
+	text := html(lang, "bot.csat.thanks", score)
+	notice := i18n.M("bot.group.rated", displayName(user), score)
+	if closed {
+		text = html(lang, "bot.customer.status_closed", ticket.ID) + "\n\n" + text
+		notice = i18n.M("bot.group.rated_closed", displayName(user), score)
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(i18n.T(lang, "bot.button.comment"), fmt.Sprintf("csat_%d_comment", ticket.ID)),
+		tgbotapi.NewInlineKeyboardButtonData(i18n.T(lang, "bot.button.skip"), fmt.Sprintf("csat_%d_skip", ticket.ID)),
+	))
+	editMessageWithKeyboard(chatID, messageID, text, keyboard)
+	mirrorToGroup(ticket, notice)
+	return ""
+}
+
+// handleRatingComment stores a customer's message as the comment of the
+// rating they have just given, when they asked to comment or replied to the
+// rating message. It reports whether the message was one.
+func handleRatingComment(message *tgbotapi.Message, user *models.User) bool {
+	chatID := message.Chat.ID
+	if message.Text == "" {
+		return false
+	}
+	replyTo := 0
+	if message.ReplyToMessage != nil {
+		replyTo = message.ReplyToMessage.MessageID
+	}
+	ticketID := takeRatingComment(chatID, replyTo)
+	if ticketID == 0 {
+		return false
+	}
+	ticket := ownTicket(ticketID, user)
+	if ticket == nil {
+		return false
+	}
+	lang := language(user)
+
+	comment := strings.TrimSpace(message.Text)
+	if err := tickets.CommentRating(ticket, comment); err != nil {
+		log.Printf("Error saving rating comment of ticket #%d: %v", ticket.ID, err)
+		sendMessage(chatID, html(lang, "bot.error.generic"))
+		return true
+	}
+
+	sendMessage(chatID, html(lang, "bot.csat.comment_saved"))
+	mirrorToGroup(ticket, i18n.M("bot.group.rating_comment", displayName(user), comment))
+	return true
+}
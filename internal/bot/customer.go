@@ -0,0 +1,333 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"helpdesk/internal/db"
+	"helpdesk/internal/i18n"
+	"helpdesk/internal/models"
+	"helpdesk/internal/richtext"
+	"helpdesk/internal/tickets"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// customerPageSize is how many tickets /mytickets shows at a time.
+const customerPageSize = 5
+
+// historyLength is how many of the last messages /history shows.
+const historyLength = 20
+
+// customerTicketArg returns the customer's ticket given as the command's
+// argument or, without one, their only ticket among the candidates. It tells
+// the customer what is wrong and returns nil otherwise.
+func customerTicketArg(chatID int64, parts []string, user *models.User, usage string, candidates func(*models.User) ([]*models.Ticket, error)) *models.Ticket {
+	lang := language(user)
+
+	if len(parts) < 2 {
+		list, err := candidates(user)
+		if err != nil {
+			log.Printf("Error getting customer tickets: %v", err)
+			sendMessage(chatID, html(lang, "bot.error.generic"))
+			return nil
+		}
+		if len(list) != 1 {
+			sendMessage(chatID, html(lang, usage))
+			return nil
+		}
+		return list[0]
+	}
+
+	ticketID, err := strconv.Atoi(strings.TrimPrefix(parts[1], "#"))
+	if err != nil {
+		sendMessage(chatID, html(lang, "bot.error.bad_ticket_id"))
+		return nil
+	}
+	ticket := ownTicket(ticketID, user)
+	if ticket == nil {
+		sendMessage(chatID, html(lang, "bot.error.request_not_found"))
+	}
+	return ticket
+}
+
+// activeTickets returns the customer's open and in progress tickets.
+func activeTickets(user *models.User) ([]*models.Ticket, error) {
+	return db.GetActiveTicketsByCustomer(user.ID, time.Time{})
+}
+
+// resolvedTickets returns the customer's resolved tickets, the ones /reopen
+// can apply to.
+func resolvedTickets(user *models.User) ([]*models.Ticket, error) {
+	list, err := db.GetUnclosedTicketsByCustomer(user.ID, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	var resolved []*models.Ticket
+	for _, ticket := range list {
+		if tickets.BaseStatus(ticket.OrganizationID, ticket.Status) == tickets.StatusResolved {
+			resolved = append(resolved, ticket)
+		}
+	}
+	return resolved, nil
+}
+
+// ownTicket returns the ticket if it belongs to the customer, nil otherwise.
+func ownTicket(ticketID int, user *models.User) *models.Ticket {
+	ticket, err := db.GetTicketByID(ticketID)
+	if err != nil || ticket == nil || ticket.CustomerID == nil || *ticket.CustomerID != user.ID {
+		return nil
+	}
+	return ticket
+}
+
+// customerTickets lists a page of the customer's tickets, newest first, with
+// a button per ticket and buttons to the neighbouring pages.
+func customerTickets(user *models.User, offset int) (richtext.HTML, *tgbotapi.InlineKeyboardMarkup, error) {
+	lang := language(user)
+
+	// One more than shown tells whether there is a next page
+	list, err := db.GetTicketsByCustomer(user.ID, customerPageSize+1, offset)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(list) == 0 {
+		if offset > 0 {
+			return customerTickets(user, 0)
+		}
+		return html(lang, "bot.customer.no_tickets"), nil, nil
+	}
+	more := len(list) > customerPageSize
+	if more {
+		list = list[:customerPageSize]
+	}
+
+	var sb strings.Builder
+	sb.WriteString(string(html(lang, "bot.customer.tickets", offset+1, offset+len(list))) + "\n\n")
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, t := range list {
+		st := tickets.StatusLabel(t.OrganizationID, t.Status, lang)
+		sb.WriteString(fmt.Sprintf("#%d [%s] %s\n", t.ID, richtext.Escape(st), richtext.Escape(truncate(t.Title, 50))))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("#%d %s", t.ID, truncate(t.Title, 30)), fmt.Sprintf("my_view_%d", t.ID)),
+		))
+	}
+
+	var paging []tgbotapi.InlineKeyboardButton
+	if offset > 0 {
+		prev := offset - customerPageSize
+		if prev < 0 {
+			prev = 0
+		}
+		paging = append(paging, tgbotapi.NewInlineKeyboardButtonData(i18n.T(lang, "bot.button.newer"), fmt.Sprintf("my_page_%d", prev)))
+	}
+	if more {
+		paging = append(paging, tgbotapi.NewInlineKeyboardButtonData(i18n.T(lang, "bot.button.older"), fmt.Sprintf("my_page_%d", offset+customerPageSize)))
+	}
+	if paging != nil {
+		rows = append(rows, paging)
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return richtext.HTML(sb.String()), &keyboard, nil
+}
+
+func handleCustomerTickets(chatID int64, user *models.User) {
+	text, keyboard, err := customerTickets(user, 0)
+	if err != nil {
+		log.Printf("Error getting tickets of customer %d: %v", user.ID, err)
+		sendMessage(chatID, html(language(user), "bot.error.tickets"))
+		return
+	}
+	if keyboard == nil {
+		sendMessage(chatID, text)
+		return
+	}
+	sendWithKeyboard(chatID, text, *keyboard)
+}
+
+// customerHistory shows the ticket's conversation to its customer.
+func customerHistory(ticket *models.Ticket, lang string) (richtext.HTML, error) {
+	messages, err := db.GetMessagesByTicket(ticket.ID)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	st := tickets.StatusLabel(ticket.OrganizationID, ticket.Status, lang)
+	sb.WriteString(string(html(lang, "bot.customer.history", ticket.ID, richtext.Bold(ticket.Title), st)) + "\n\n")
+
+	start := 0
+	if len(messages) > historyLength {
+		start = len(messages) - historyLength
+		sb.WriteString(string(html(lang, "bot.card.last_messages", historyLength, len(messages))) + "\n\n")
+	}
+	for _, m := range messages[start:] {
+		var from, content richtext.HTML
+		switch {
+		case m.IsSystem:
+			from, content = html(lang, "bot.card.from_system"), "<i>"+richtext.Escape(m.Content)+"</i>"
+		case m.IsFromCustomer:
+			from, content = html(lang, "bot.customer.from_you"), richtext.Escape(m.Content)
+		default:
+			from, content = html(lang, "bot.customer.from_support"), richtext.Markdown(m.Content)
+		}
+		sb.WriteString(fmt.Sprintf("[%s] <b>%s:</b> %s\n\n", m.CreatedAt.Format("02.01 15:04"), from, content))
+	}
+	if len(messages) == 0 {
+		sb.WriteString(string(html(lang, "bot.customer.no_messages")))
+	}
+
+	return richtext.HTML(sb.String()), nil
+}
+
+// customerTicketKeyboard offers the customer to close an active ticket and to
+// reopen or close a resolved one.
+func customerTicketKeyboard(ticket *models.Ticket, lang string) tgbotapi.InlineKeyboardMarkup {
+	var row []tgbotapi.InlineKeyboardButton
+	switch tickets.BaseStatus(ticket.OrganizationID, ticket.Status) {
+	case tickets.StatusResolved:
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(i18n.T(lang, "bot.button.reopen"), fmt.Sprintf("my_reopen_%d", ticket.ID)))
+		fallthrough
+	case tickets.StatusOpen, tickets.StatusInProgress:
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(i18n.T(lang, "bot.button.close"), fmt.Sprintf("my_close_%d", ticket.ID)))
+	}
+	rows := [][]tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(i18n.T(lang, "bot.button.my_tickets"), "my_page_0")),
+	}
+	if row != nil {
+		rows = append([][]tgbotapi.InlineKeyboardButton{row}, rows...)
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func showCustomerHistory(chatID int64, ticket *models.Ticket, lang string) {
+	text, err := customerHistory(ticket, lang)
+	if err != nil {
+		log.Printf("Error getting messages of ticket #%d: %v", ticket.ID, err)
+		sendMessage(chatID, html(lang, "bot.error.messages"))
+		return
+	}
+	if sent := sendWithKeyboard(chatID, text, customerTicketKeyboard(ticket, lang)); sent != nil {
+		// Replies to the history go to the ticket
+		linkMessage(chatID, sent.MessageID, ticket.ID)
+	}
+}
+
+// setOwnTicketStatus closes or reopens the customer's ticket and lets the
+// operators know. It returns the result for the customer and whether the
+// ticket was changed.
+func setOwnTicketStatus(ticket *models.Ticket, status string, user *models.User) (richtext.HTML, bool) {
+	lang := language(user)
+
+	base := tickets.BaseStatus(ticket.OrganizationID, ticket.Status)
+	switch {
+	case status == tickets.StatusClosed && base == tickets.StatusClosed:
+		return html(lang, "bot.customer.already_closed", ticket.ID), false
+	case status == tickets.StatusOpen && (base == tickets.StatusOpen || base == tickets.StatusInProgress):
+		return html(lang, "bot.customer.already_active", ticket.ID), false
+	}
+
+	if err := tickets.ChangeStatus(ticket, status, botActor(user)); err != nil {
+		if errors.Is(err, tickets.ErrInvalidTransition) {
+			return html(lang, "bot.customer.cannot_reopen", ticket.ID), false
+		}
+		log.Printf("Error updating ticket status: %v", err)
+		return html(lang, "bot.error.status"), false
+	}
+
+	notice := i18n.M("bot.operator.customer_closed", displayName(user), ticket.ID, richtext.Bold(ticket.Title))
+	if status == tickets.StatusOpen {
+		notice = i18n.M("bot.operator.customer_reopened", displayName(user), ticket.ID, richtext.Bold(ticket.Title))
+	}
+	notifyOperatorsAboutTicket(ticket, notice)
+	mirrorToGroup(ticket, notice)
+
+	return html(lang, "bot.customer.status_"+status, ticket.ID), true
+}
+
+func handleCustomerStatusCommand(message *tgbotapi.Message, user *models.User, status, usage string) {
+	chatID := message.Chat.ID
+	candidates := activeTickets
+	if status == tickets.StatusOpen {
+		candidates = resolvedTickets
+	}
+	ticket := customerTicketArg(chatID, strings.Fields(message.Text), user, usage, candidates)
+	if ticket == nil {
+		return
+	}
+	text, _ := setOwnTicketStatus(ticket, status, user)
+	sendMessage(chatID, text)
+}
+
+func handleHistoryCommand(message *tgbotapi.Message, user *models.User) {
+	chatID := message.Chat.ID
+	ticket := customerTicketArg(chatID, strings.Fields(message.Text), user, "bot.customer.usage.history", activeTickets)
+	if ticket == nil {
+		return
+	}
+	showCustomerHistory(chatID, ticket, language(user))
+}
+
+// handleCustomerTicketCallback handles the buttons of /mytickets and
+// /history and returns the text for the callback answer.
+func handleCustomerTicketCallback(callback *tgbotapi.CallbackQuery) string {
+	chatID := callback.Message.Chat.ID
+	messageID := callback.Message.MessageID
+
+	parts := strings.Split(callback.Data, "_")
+	if len(parts) != 3 {
+		return ""
+	}
+	arg, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return ""
+	}
+
+	user, err := db.GetUserByTelegramID(callback.From.ID)
+	if err != nil || user == nil {
+		return ""
+	}
+	lang := language(user)
+
+	if parts[1] == "page" {
+		text, keyboard, err := customerTickets(user, arg)
+		if err != nil {
+			log.Printf("Error getting tickets of customer %d: %v", user.ID, err)
+			return i18n.T(lang, "bot.error.tickets")
+		}
+		if keyboard == nil {
+			editMessage(chatID, messageID, text)
+		} else {
+			editMessageWithKeyboard(chatID, messageID, text, *keyboard)
+		}
+		return ""
+	}
+
+	ticket := ownTicket(arg, user)
+	if ticket == nil {
+		return i18n.T(lang, "bot.error.request_not_found")
+	}
+
+	switch parts[1] {
+	case "view":
+		showCustomerHistory(chatID, ticket, lang)
+	case "close", "reopen":
+		status := tickets.StatusClosed
+		if parts[1] == "reopen" {
+			status = tickets.StatusOpen
+		}
+		text, changed := setOwnTicketStatus(ticket, status, user)
+		if changed {
+			edit := tgbotapi.NewEditMessageReplyMarkup(chatID, messageID, customerTicketKeyboard(ticket, lang))
+			if _, err := BotAPI.Request(edit); err != nil {
+				log.Printf("Error editing keyboard of message %d in %d: %v", messageID, chatID, err)
+			}
+		}
+		sendMessage(chatID, text)
+	}
+	return ""
+}
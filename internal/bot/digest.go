@@ -0,0 +1,126 @@
+package bot
+
+import (
+	"fmt"
+	"helpdesk/internal/db"
+	"helpdesk/internal/digest"
+	"helpdesk/internal/i18n"
+	"helpdesk/internal/models"
+	"helpdesk/internal/richtext"
+	"helpdesk/internal/tickets"
+	"log"
+	"strings"
+	"time"
+)
+
+// digestListLimit is how many tickets a section of a digest message lists.
+const digestListLimit = 10
+
+// SendDigest sends the digest to the operator's private chat and reports
+// whether it was sent.
+func SendDigest(user *models.User, d *models.Digest) bool {
+	if BotAPI == nil || user.TelegramID == nil {
+		return false
+	}
+	return sendMessage(*user.TelegramID, digestText(d, language(user))) != nil
+}
+
+// handleDigestCommand sends the digest right away: the weekly one with the
+// "week" argument, with the sections the operator chose on the web.
+func handleDigestCommand(chatID int64, parts []string, user *models.User) {
+	lang := language(user)
+
+	settings, err := db.GetDigestSettings(user.ID)
+	if err != nil {
+		log.Printf("Error loading digest settings of user %d: %v", user.ID, err)
+	}
+	if settings == nil {
+		settings = digest.DefaultSettings(user.ID)
+	}
+	weekly := len(parts) > 1 && parts[1] == "week"
+
+	d, err := digest.Build(user.OrganizationID, settings.Sections, weekly, time.Now())
+	if err != nil {
+		log.Printf("Error building digest for user %d: %v", user.ID, err)
+		sendMessage(chatID, html(lang, "bot.error.digest"))
+		return
+	}
+	sendMessage(chatID, digestText(d, lang))
+}
+
+func digestText(d *models.Digest, lang string) richtext.HTML {
+	var sb strings.Builder
+	title := "bot.digest.title.daily"
+	if d.Weekly {
+		title = "bot.digest.title.weekly"
+	}
+	sb.WriteString(string(html(lang, title, d.GeneratedAt.Format("02.01.2006 15:04"))))
+
+	section := func(key string, count int) {
+		sb.WriteString("\n\n" + string(richtext.Bold(i18n.T(lang, key))))
+		if count >= 0 {
+			sb.WriteString(fmt.Sprintf(" (%d)", count))
+		}
+		sb.WriteString("\n")
+	}
+	list := func(ts []*models.Ticket) {
+		if len(ts) == 0 {
+			sb.WriteString(string(html(lang, "bot.digest.none")))
+			return
+		}
+		var lines []string
+		for i, t := range ts {
+			if i == digestListLimit {
+				lines = append(lines, string(html(lang, "bot.digest.more", len(ts)-i)))
+				break
+			}
+			lines = append(lines, digestTicketLine(t, lang))
+		}
+		sb.WriteString(strings.Join(lines, "\n"))
+	}
+
+	for _, s := range d.Sections {
+		switch s {
+		case digest.SectionAge:
+			total := 0
+			var ages []string
+			for i, n := range d.Ages {
+				total += n
+				ages = append(ages, fmt.Sprintf("%s: %d", richtext.Escape(i18n.T(lang, fmt.Sprintf("digest.age.%d", i))), n))
+			}
+			section("digest.section.age", total)
+			sb.WriteString(strings.Join(ages, " · "))
+			if len(d.Oldest) > 0 {
+				sb.WriteString("\n" + string(html(lang, "bot.digest.oldest")) + "\n")
+				list(d.Oldest)
+			}
+		case digest.SectionUnassigned:
+			section("digest.section.unassigned", len(d.Unassigned))
+			list(d.Unassigned)
+		case digest.SectionSLA:
+			section("digest.section.sla", len(d.Breached))
+			list(d.Breached)
+		case digest.SectionWaiting:
+			section("digest.section.waiting", len(d.Waiting))
+			list(d.Waiting)
+		case digest.SectionResolved:
+			key := "digest.resolved.daily"
+			if d.Weekly {
+				key = "digest.resolved.weekly"
+			}
+			section("digest.section.resolved", -1)
+			sb.WriteString(string(html(lang, key, d.Resolved)))
+		}
+	}
+
+	sb.WriteString("\n\n" + string(html(lang, "bot.digest.footer")))
+	return richtext.HTML(sb.String())
+}
+
+// digestTicketLine lists a ticket with its status and age in days.
+func digestTicketLine(t *models.Ticket, lang string) string {
+	st := tickets.StatusLabel(t.OrganizationID, t.Status, lang)
+	days := int(time.Since(t.CreatedAt).Hours() / 24)
+	return fmt.Sprintf("%s#%d [%s] %s — %s", priorityMark(t.Priority), t.ID, richtext.Escape(st),
+		richtext.Escape(truncate(t.Title, 50)), html(lang, "bot.digest.age_days", days))
+}
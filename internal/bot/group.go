@@ -0,0 +1,222 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"helpdesk/internal/db"
+	"helpdesk/internal/i18n"
+	"helpdesk/internal/models"
+	"helpdesk/internal/richtext"
+	"log"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// The operators' group is a Telegram supergroup connected to the organization
+// with /connect (organizations.telegram_chat_id). Every ticket gets its own
+// forum topic there: customer messages are mirrored into it and operator
+// messages in the topic are sent to the customer. Without topics enabled the
+// tickets are posted to the group itself.
+
+// Forum topics are not covered by the Telegram library in use, so these calls
+// go through MakeRequest.
+
+func createForumTopic(chatID int64, name string) (int, error) {
+	params := tgbotapi.Params{}
+	params.AddNonZero64("chat_id", chatID)
+	params.AddNonEmpty("name", name)
+
+	resp, err := BotAPI.MakeRequest("createForumTopic", params)
+	if err != nil {
+		return 0, err
+	}
+
+	var topic struct {
+		MessageThreadID int `json:"message_thread_id"`
+	}
+	if err := json.Unmarshal(resp.Result, &topic); err != nil {
+		return 0, err
+	}
+	return topic.MessageThreadID, nil
+}
+
+// sendToTopic posts text into a forum topic like send; thread 0 is the group itself.
+func sendToTopic(chatID int64, threadID int, text richtext.HTML, keyboard *tgbotapi.InlineKeyboardMarkup) *tgbotapi.Message {
+	parts := richtext.Split(text, messageLimit)
+	var msg tgbotapi.Message
+	for i, part := range parts {
+		params := tgbotapi.Params{}
+		params.AddNonZero64("chat_id", chatID)
+		params.AddNonZero("message_thread_id", threadID)
+		params.AddNonEmpty("text", string(part))
+		params.AddNonEmpty("parse_mode", tgbotapi.ModeHTML)
+		if keyboard != nil && i == len(parts)-1 {
+			if err := params.AddInterface("reply_markup", keyboard); err != nil {
+				log.Printf("Error encoding keyboard: %v", err)
+				return nil
+			}
+		}
+
+		resp, err := BotAPI.MakeRequest("sendMessage", params)
+		if err != nil {
+			log.Printf("Error sending message to %d (topic %d): %v", chatID, threadID, err)
+			return nil
+		}
+
+		if err := json.Unmarshal(resp.Result, &msg); err != nil {
+			log.Printf("Error decoding sent message: %v", err)
+			return nil
+		}
+	}
+	return &msg
+}
+
+// operatorGroup returns the operators' group of the ticket's organization, 0 if none.
+func operatorGroup(ticket *models.Ticket) int64 {
+	org, err := db.GetOrganizationByID(ticket.OrganizationID)
+	if err != nil || org.TelegramChatID == nil {
+		return 0
+	}
+	return *org.TelegramChatID
+}
+
+// ticketTopic returns the operators' group and the ticket's topic in it,
+// opening the topic with the ticket card if the ticket has none yet. The group
+// is written to in the organization's default language.
+func ticketTopic(ticket *models.Ticket) (chatID int64, threadID int, ok bool) {
+	chatID = operatorGroup(ticket)
+	if chatID == 0 || BotAPI == nil {
+		return 0, 0, false
+	}
+
+	threadID, found, err := db.GetTicketTopic(ticket.ID, chatID)
+	if err != nil {
+		log.Printf("Error getting topic of ticket #%d: %v", ticket.ID, err)
+		return 0, 0, false
+	}
+	if found {
+		return chatID, threadID, true
+	}
+
+	threadID, err = createForumTopic(chatID, fmt.Sprintf("#%d %s", ticket.ID, truncate(ticket.Title, 100)))
+	if err != nil {
+		// Topics are disabled or the bot may not manage them
+		log.Printf("Error creating topic for ticket #%d in %d, posting to the group: %v", ticket.ID, chatID, err)
+		threadID = 0
+	}
+	if err := db.SaveTicketTopic(ticket.ID, chatID, threadID); err != nil {
+		log.Printf("Error saving topic of ticket #%d: %v", ticket.ID, err)
+	}
+	if threadID != 0 {
+		// Plain messages in a topic are replies to the topic's first message
+		linkMessage(chatID, threadID, ticket.ID)
+	}
+
+	lang := organizationLanguage(ticket.OrganizationID)
+	text, err := ticketViewText(ticket, lang)
+	if err != nil {
+		log.Printf("Error rendering ticket #%d: %v", ticket.ID, err)
+		return chatID, threadID, true
+	}
+	keyboard := ticketKeyboard(ticket, lang)
+	if sent := sendToTopic(chatID, threadID, text, &keyboard); sent != nil {
+		linkMessage(chatID, sent.MessageID, ticket.ID)
+	}
+	return chatID, threadID, true
+}
+
+// postTicketToGroup opens the topic of a new ticket.
+func postTicketToGroup(ticket *models.Ticket) {
+	ticketTopic(ticket)
+}
+
+// mirrorToGroup posts text into the ticket's topic.
+func mirrorToGroup(ticket *models.Ticket, text i18n.Message) {
+	chatID, threadID, ok := ticketTopic(ticket)
+	if !ok {
+		return
+	}
+	if sent := sendToTopic(chatID, threadID, htmlMessage(text, organizationLanguage(ticket.OrganizationID)), nil); sent != nil {
+		linkMessage(chatID, sent.MessageID, ticket.ID)
+	}
+}
+
+// handleGroupMessage handles messages in group chats: /connect and
+// /disconnect from admins, and operator answers in ticket topics.
+func handleGroupMessage(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	if message.From == nil || !isOperator(message.From.ID) {
+		return
+	}
+
+	user, err := telegramUser(message.From)
+	if err != nil {
+		log.Printf("Error getting user: %v", err)
+		return
+	}
+
+	if message.IsCommand() {
+		switch message.Command() {
+		case "connect":
+			connectGroup(message, user)
+		case "disconnect":
+			disconnectGroup(message, user)
+		}
+		return
+	}
+
+	orgID, err := db.GetOrganizationIDByTelegramChat(chatID)
+	if err != nil || orgID == 0 || orgID != user.OrganizationID || message.ReplyToMessage == nil {
+		return
+	}
+
+	ticketID, err := db.GetLinkedTicketID(chatID, message.ReplyToMessage.MessageID)
+	if err != nil || ticketID == 0 {
+		return
+	}
+
+	threadID, _, _ := db.GetTicketTopic(ticketID, chatID)
+	if notice, ok := sendOperatorReply(message, user, ticketID); !ok {
+		sendToTopic(chatID, threadID, notice, nil)
+	}
+}
+
+func connectGroup(message *tgbotapi.Message, user *models.User) {
+	chatID := message.Chat.ID
+	lang := organizationLanguage(user.OrganizationID)
+	if !isAdmin(message.From.ID) {
+		sendMessage(chatID, html(lang, "bot.group.connect_admins_only"))
+		return
+	}
+	if !message.Chat.IsSuperGroup() {
+		sendMessage(chatID, html(lang, "bot.group.supergroup_required"))
+		return
+	}
+
+	if err := db.UpdateOrganizationTelegramChat(user.OrganizationID, &chatID); err != nil {
+		log.Printf("Error connecting group %d: %v", chatID, err)
+		sendMessage(chatID, html(lang, "bot.group.connect_failed"))
+		return
+	}
+	sendMessage(chatID, html(lang, "bot.group.connected"))
+}
+
+func disconnectGroup(message *tgbotapi.Message, user *models.User) {
+	chatID := message.Chat.ID
+	lang := organizationLanguage(user.OrganizationID)
+	if !isAdmin(message.From.ID) {
+		sendMessage(chatID, html(lang, "bot.group.disconnect_admins_only"))
+		return
+	}
+
+	orgID, err := db.GetOrganizationIDByTelegramChat(chatID)
+	if err != nil || orgID != user.OrganizationID {
+		return
+	}
+	if err := db.UpdateOrganizationTelegramChat(orgID, nil); err != nil {
+		log.Printf("Error disconnecting group %d: %v", chatID, err)
+		sendMessage(chatID, html(lang, "bot.group.disconnect_failed"))
+		return
+	}
+	sendMessage(chatID, html(lang, "bot.group.disconnected"))
+}
@@ -0,0 +1,43 @@
+package bot
+
+import (
+	"fmt"
+	"helpdesk/internal/i18n"
+	"helpdesk/internal/richtext"
+)
+
+// messageLimit is the longest text of a Telegram message. Longer texts are
+// sent as several messages.
+const messageLimit = 4096
+
+// html renders a catalog message for an HTML parse mode message: the catalog
+// text and plain arguments are escaped, richtext.HTML arguments are kept.
+func html(lang, key string, args ...interface{}) richtext.HTML {
+	return htmlMessage(i18n.M(key, args...), lang)
+}
+
+func htmlMessage(m i18n.Message, lang string) richtext.HTML {
+	format := string(richtext.Escape(i18n.Format(lang, m.Key)))
+	if len(m.Args) == 0 {
+		return richtext.HTML(format)
+	}
+
+	args := make([]interface{}, len(m.Args))
+	for i, arg := range m.Args {
+		switch a := arg.(type) {
+		case richtext.HTML:
+			args[i] = string(a)
+		case i18n.Message:
+			args[i] = string(htmlMessage(a, lang))
+		case i18n.Localizer:
+			args[i] = string(richtext.Escape(a.In(lang)))
+		case string:
+			args[i] = string(richtext.Escape(a))
+		case error:
+			args[i] = string(richtext.Escape(a.Error()))
+		default:
+			args[i] = a
+		}
+	}
+	return richtext.HTML(fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,372 @@
+package bot
+
+import (
+	"fmt"
+	"helpdesk/internal/db"
+	"helpdesk/internal/i18n"
+	"helpdesk/internal/models"
+	"helpdesk/internal/richtext"
+	"helpdesk/internal/tickets"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// intakeTTL is how long an unfinished intake is kept.
+const intakeTTL = time.Hour
+
+// intake is a customer's ticket being filled in: the chosen category, its
+// questions and the answers so far. The last step asks for the description.
+type intake struct {
+	category  *models.TicketCategory
+	questions []*models.IntakeQuestion
+	step      int
+	fields    []*models.TicketField
+	priority  string
+	started   time.Time
+}
+
+func (in *intake) current() *models.IntakeQuestion {
+	if in.step < len(in.questions) {
+		return in.questions[in.step]
+	}
+	return nil
+}
+
+// intakes holds the intake in progress of each customer, keyed by chat ID.
+var intakes = struct {
+	sync.Mutex
+	m map[int64]*intake
+}{m: make(map[int64]*intake)}
+
+func getIntake(chatID int64) *intake {
+	intakes.Lock()
+	defer intakes.Unlock()
+
+	in := intakes.m[chatID]
+	if in != nil && time.Since(in.started) > intakeTTL {
+		delete(intakes.m, chatID)
+		return nil
+	}
+	return in
+}
+
+func endIntake(chatID int64) {
+	intakes.Lock()
+	delete(intakes.m, chatID)
+	intakes.Unlock()
+}
+
+// startIntake offers the organization's ticket categories. It returns false
+// when the organization has none and tickets are opened by a plain message.
+func startIntake(chatID int64, user *models.User) bool {
+	lang := language(user)
+	categories, err := db.GetTicketCategories(user.OrganizationID)
+	if err != nil {
+		log.Printf("Error getting ticket categories: %v", err)
+		return false
+	}
+	if len(categories) == 0 {
+		return false
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, c := range categories {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(c.Name, fmt.Sprintf("intake_cat_%d", c.ID)),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(i18n.T(lang, "bot.intake.other"), "intake_cat_0"),
+	))
+
+	sendWithKeyboard(chatID, html(lang, "bot.intake.choose_category"), tgbotapi.NewInlineKeyboardMarkup(rows...))
+	return true
+}
+
+func cancelIntake(chatID int64, lang string) {
+	if getIntake(chatID) == nil {
+		sendMessage(chatID, html(lang, "bot.nothing_to_cancel"))
+		return
+	}
+	endIntake(chatID)
+
+	send(chatID, html(lang, "bot.intake.cancelled"), tgbotapi.NewRemoveKeyboard(true))
+}
+
+// handleIntakeCallback handles the category, choice and skip buttons of an intake.
+func handleIntakeCallback(callback *tgbotapi.CallbackQuery) {
+	chatID := callback.Message.Chat.ID
+	messageID := callback.Message.MessageID
+	data := callback.Data
+
+	user, err := db.GetUserByTelegramID(chatID)
+	if err != nil || user == nil {
+		return
+	}
+	lang := language(user)
+
+	if strings.HasPrefix(data, "intake_cat_") {
+		id, err := strconv.Atoi(strings.TrimPrefix(data, "intake_cat_"))
+		if err != nil {
+			return
+		}
+		in := &intake{started: time.Now()}
+		if id != 0 {
+			if in.category, err = db.GetTicketCategory(user.OrganizationID, id); err != nil || in.category == nil {
+				editMessage(chatID, messageID, html(lang, "bot.intake.category_not_found"))
+				return
+			}
+			if in.questions, err = categoryQuestions(user.OrganizationID, id); err != nil {
+				log.Printf("Error getting intake questions: %v", err)
+				editMessage(chatID, messageID, html(lang, "bot.error.generic"))
+				return
+			}
+		}
+
+		intakes.Lock()
+		intakes.m[chatID] = in
+		intakes.Unlock()
+
+		name := i18n.T(lang, "bot.intake.other")
+		if in.category != nil {
+			name = in.category.Name
+		}
+		editMessage(chatID, messageID, html(lang, "bot.intake.category", name))
+		askIntake(chatID, in, lang)
+		return
+	}
+
+	in := getIntake(chatID)
+	q := (*models.IntakeQuestion)(nil)
+	if in != nil {
+		q = in.current()
+	}
+	if q == nil {
+		editMessage(chatID, messageID, html(lang, "bot.intake.expired"))
+		return
+	}
+
+	// Buttons carry the question they answer, so a tap on an older question
+	// does not answer the current one
+	var questionID, index int
+	skip := strings.HasPrefix(data, "intake_skip_")
+	if skip {
+		questionID, err = strconv.Atoi(strings.TrimPrefix(data, "intake_skip_"))
+	} else {
+		_, err = fmt.Sscanf(data, "intake_ans_%d_%d", &questionID, &index)
+	}
+	if err != nil {
+		return
+	}
+	if questionID != q.ID {
+		editMessage(chatID, messageID, html(lang, "bot.intake.expired"))
+		return
+	}
+
+	if skip {
+		if q.Required {
+			return
+		}
+		editMessage(chatID, messageID, richtext.Escape(q.Prompt)+"\n— "+html(lang, "bot.intake.skipped"))
+		in.step++
+		askIntake(chatID, in, lang)
+		return
+	}
+
+	var answer string
+	switch q.Kind {
+	case models.QuestionPriority:
+		if index < 0 || index >= len(models.TicketPriorities) {
+			return
+		}
+		in.priority = models.TicketPriorities[index]
+		answer = tickets.PriorityLabel(in.priority, lang)
+	case models.QuestionChoice:
+		if index < 0 || index >= len(q.Options) {
+			return
+		}
+		answer = q.Options[index]
+	default:
+		return
+	}
+
+	editMessage(chatID, messageID, richtext.Escape(q.Prompt+"\n— "+answer))
+	in.fields = append(in.fields, &models.TicketField{Label: q.Label, Value: answer})
+	in.step++
+	askIntake(chatID, in, lang)
+}
+
+func categoryQuestions(orgID, categoryID int) ([]*models.IntakeQuestion, error) {
+	all, err := db.GetIntakeQuestions(orgID)
+	if err != nil {
+		return nil, err
+	}
+	var questions []*models.IntakeQuestion
+	for _, q := range all {
+		if q.CategoryID == categoryID {
+			questions = append(questions, q)
+		}
+	}
+	return questions, nil
+}
+
+// askIntake asks the current question, or for the description after the last one.
+func askIntake(chatID int64, in *intake, lang string) {
+	q := in.current()
+	if q == nil {
+		sendMessage(chatID, html(lang, "bot.intake.describe"))
+		return
+	}
+
+	var skip []tgbotapi.InlineKeyboardButton
+	if !q.Required {
+		skip = tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(i18n.T(lang, "bot.intake.skip"), fmt.Sprintf("intake_skip_%d", q.ID)))
+	}
+
+	switch q.Kind {
+	case models.QuestionChoice, models.QuestionPriority:
+		options := q.Options
+		if q.Kind == models.QuestionPriority {
+			options = nil
+			for _, p := range models.TicketPriorities {
+				options = append(options, tickets.PriorityLabel(p, lang))
+			}
+		}
+		var rows [][]tgbotapi.InlineKeyboardButton
+		for i, o := range options {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(o, fmt.Sprintf("intake_ans_%d_%d", q.ID, i)),
+			))
+		}
+		if skip != nil {
+			rows = append(rows, skip)
+		}
+		sendWithKeyboard(chatID, richtext.Escape(q.Prompt), tgbotapi.NewInlineKeyboardMarkup(rows...))
+
+	case models.QuestionContact:
+		buttons := tgbotapi.NewKeyboardButtonRow(tgbotapi.NewKeyboardButtonContact(i18n.T(lang, "bot.intake.share_contact")))
+		hint := "bot.intake.contact_hint_button"
+		if !q.Required {
+			buttons = append(buttons, tgbotapi.NewKeyboardButton(i18n.T(lang, "bot.intake.skip")))
+			hint = "bot.intake.contact_hint"
+		}
+		keyboard := tgbotapi.NewOneTimeReplyKeyboard(buttons)
+		send(chatID, richtext.Escape(q.Prompt)+"\n\n"+html(lang, hint), keyboard)
+
+	default:
+		if skip != nil {
+			sendWithKeyboard(chatID, richtext.Escape(q.Prompt), tgbotapi.NewInlineKeyboardMarkup(skip))
+		} else {
+			sendMessage(chatID, richtext.Escape(q.Prompt))
+		}
+	}
+}
+
+// handleIntakeMessage takes a customer message as the answer to the current
+// intake question. It returns false if the customer has no intake in progress.
+func handleIntakeMessage(message *tgbotapi.Message, user *models.User) bool {
+	chatID := message.Chat.ID
+	in := getIntake(chatID)
+	if in == nil {
+		return false
+	}
+	lang := language(user)
+
+	q := in.current()
+	if q == nil {
+		if message.Text == "" {
+			sendMessage(chatID, html(lang, "bot.intake.describe_text"))
+			return true
+		}
+		endIntake(chatID)
+		finishIntake(message, user, in)
+		return true
+	}
+
+	switch q.Kind {
+	case models.QuestionChoice, models.QuestionPriority:
+		sendMessage(chatID, html(lang, "bot.intake.use_buttons"))
+		return true
+
+	case models.QuestionContact:
+		// A shared contact must be the customer's own; a required number is
+		// only taken from the button, typed text may be anything
+		var phone string
+		switch {
+		case message.Contact != nil && (message.From == nil || message.Contact.UserID != message.From.ID):
+			sendMessage(chatID, html(lang, "bot.intake.contact_not_own"))
+			return true
+		case message.Contact != nil:
+			phone = message.Contact.PhoneNumber
+		case q.Required:
+			sendMessage(chatID, html(lang, "bot.intake.contact_button_required"))
+			return true
+		case message.Text == i18n.T(lang, "bot.intake.skip"):
+		case message.Text != "":
+			phone = strings.TrimSpace(message.Text)
+		default:
+			sendMessage(chatID, html(lang, "bot.intake.contact_required"))
+			return true
+		}
+
+		text := html(lang, "bot.intake.thanks")
+		if phone == "" {
+			text = html(lang, "bot.intake.contact_skipped")
+		} else {
+			in.fields = append(in.fields, &models.TicketField{Label: q.Label, Value: phone})
+		}
+		send(chatID, text, tgbotapi.NewRemoveKeyboard(true))
+
+	default:
+		if message.Text == "" {
+			sendMessage(chatID, html(lang, "bot.intake.text_required"))
+			return true
+		}
+		in.fields = append(in.fields, &models.TicketField{Label: q.Label, Value: message.Text})
+	}
+
+	in.step++
+	askIntake(chatID, in, lang)
+	return true
+}
+
+// finishIntake opens the ticket with the description from message and the
+// collected answers.
+func finishIntake(message *tgbotapi.Message, user *models.User, in *intake) {
+	text := message.Text
+
+	title := truncate(firstLine(text), 100)
+	ticket := &models.Ticket{
+		Title:       title,
+		Description: &text,
+		Priority:    "medium",
+	}
+	if in.category != nil {
+		ticket.Title = in.category.Name + ": " + truncate(firstLine(text), 80)
+		ticket.CategoryID = &in.category.ID
+	}
+	if in.priority != "" {
+		ticket.Priority = in.priority
+	}
+
+	openTicket(message, user, ticket, in.fields)
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return line
+}
+
+// fieldsText lists the ticket's intake answers, one "Label: value" per line.
+func fieldsText(fields []*models.TicketField) richtext.HTML {
+	var sb strings.Builder
+	for _, f := range fields {
+		sb.WriteString(fmt.Sprintf("<b>%s:</b> %s\n", richtext.Escape(f.Label), richtext.Escape(f.Value)))
+	}
+	return richtext.HTML(sb.String())
+}
@@ -0,0 +1,81 @@
+package bot
+
+import (
+	"helpdesk/internal/db"
+	"helpdesk/internal/i18n"
+	"helpdesk/internal/models"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// language is the language the bot speaks with the user: their own choice,
+// else their organization's default.
+func language(user *models.User) string {
+	if user.Language != nil && i18n.Supported(*user.Language) {
+		return *user.Language
+	}
+	return organizationLanguage(user.OrganizationID)
+}
+
+func organizationLanguage(orgID int) string {
+	org, err := db.GetOrganizationByID(orgID)
+	if err != nil {
+		return i18n.Default
+	}
+	return i18n.Pick(org.Language)
+}
+
+// chatLanguage is the language of a chat: its user's in a private chat, the
+// organization's default in the operators' group.
+func chatLanguage(chatID int64) string {
+	if user, err := db.GetUserByTelegramID(chatID); err == nil && user != nil {
+		return language(user)
+	}
+	if orgID, err := db.GetOrganizationIDByTelegramChat(chatID); err == nil && orgID != 0 {
+		return organizationLanguage(orgID)
+	}
+	return organizationLanguage(1)
+}
+
+// customerLanguage is the language of the ticket's customer.
+func customerLanguage(ticket *models.Ticket) string {
+	if ticket.CustomerID != nil {
+		if customer, err := db.GetUserByID(*ticket.CustomerID); err == nil {
+			return language(customer)
+		}
+	}
+	return organizationLanguage(ticket.OrganizationID)
+}
+
+// handleLanguageCommand offers the languages the bot speaks, each named in itself.
+func handleLanguageCommand(chatID int64, user *models.User) {
+	var row []tgbotapi.InlineKeyboardButton
+	for _, lang := range i18n.Languages {
+		label := i18n.T(lang, "language.name")
+		if lang == language(user) {
+			label = "• " + label
+		}
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(label, "lang_"+lang))
+	}
+	sendWithKeyboard(chatID, html(language(user), "bot.language.choose"), tgbotapi.NewInlineKeyboardMarkup(row))
+}
+
+func handleLanguageCallback(callback *tgbotapi.CallbackQuery) {
+	lang := strings.TrimPrefix(callback.Data, "lang_")
+	if !i18n.Supported(lang) {
+		return
+	}
+
+	user, err := db.GetUserByTelegramID(callback.From.ID)
+	if err != nil || user == nil {
+		return
+	}
+	if err := db.UpdateUserLanguage(user.ID, &lang); err != nil {
+		log.Printf("Error saving language of user %d: %v", user.ID, err)
+		return
+	}
+
+	editMessage(callback.Message.Chat.ID, callback.Message.MessageID, html(lang, "bot.language.changed"))
+}
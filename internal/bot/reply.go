@@ -0,0 +1,314 @@
+package bot
+
+import (
+	"helpdesk/internal/db"
+	"helpdesk/internal/i18n"
+	"helpdesk/internal/models"
+	"helpdesk/internal/richtext"
+	"helpdesk/internal/tickets"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf16"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// replyModeTTL is how long an operator's reply mode waits for the answer.
+const replyModeTTL = 30 * time.Minute
+
+type replyMode struct {
+	ticketID int
+	since    time.Time
+}
+
+// replyModes holds the ticket each operator is answering, keyed by chat ID.
+// The operator's next message is sent to that ticket's customer.
+var replyModes = struct {
+	sync.Mutex
+	m map[int64]replyMode
+}{m: make(map[int64]replyMode)}
+
+func startReplyMode(chatID int64, ticketID int, lang string) {
+	ticket, err := db.GetTicketByID(ticketID)
+	if err != nil || ticket == nil {
+		sendMessage(chatID, html(lang, "bot.error.ticket_not_found"))
+		return
+	}
+
+	replyModes.Lock()
+	replyModes.m[chatID] = replyMode{ticketID: ticketID, since: time.Now()}
+	replyModes.Unlock()
+
+	sendMessage(chatID, html(lang, "bot.reply.mode", ticketID, richtext.Bold(truncate(ticket.Title, 50))))
+}
+
+// takeReplyMode returns and ends the operator's reply mode, 0 if there is none.
+func takeReplyMode(chatID int64) int {
+	replyModes.Lock()
+	defer replyModes.Unlock()
+
+	mode, ok := replyModes.m[chatID]
+	delete(replyModes.m, chatID)
+	if !ok || time.Since(mode.since) > replyModeTTL {
+		return 0
+	}
+	return mode.ticketID
+}
+
+func cancelReplyMode(chatID int64, lang string) {
+	if takeReplyMode(chatID) != 0 {
+		sendMessage(chatID, html(lang, "bot.reply.cancelled"))
+		return
+	}
+	sendMessage(chatID, html(lang, "bot.nothing_to_cancel"))
+}
+
+// handleOperatorMessage sends a non-command operator message to a customer:
+// either as a Telegram reply to a bot message about a ticket or as the answer
+// in reply mode.
+func handleOperatorMessage(message *tgbotapi.Message, user *models.User) {
+	chatID := message.Chat.ID
+
+	if message.ReplyToMessage != nil {
+		ticketID, err := db.GetLinkedTicketID(chatID, message.ReplyToMessage.MessageID)
+		if err != nil {
+			log.Printf("Error looking up message link: %v", err)
+		}
+		if ticketID != 0 {
+			takeReplyMode(chatID)
+			notice, _ := sendOperatorReply(message, user, ticketID)
+			sendMessage(chatID, notice)
+			return
+		}
+	}
+
+	if ticketID := takeReplyMode(chatID); ticketID != 0 {
+		notice, _ := sendOperatorReply(message, user, ticketID)
+		sendMessage(chatID, notice)
+		return
+	}
+
+	sendMessage(chatID, html(language(user), "bot.operator.use_commands"))
+}
+
+// mediaLabel names the attachment of a message for the ticket history.
+func mediaLabel(message *tgbotapi.Message, lang string) string {
+	switch {
+	case len(message.Photo) > 0:
+		return i18n.T(lang, "bot.media.photo")
+	case message.Document != nil:
+		return i18n.T(lang, "bot.media.document", message.Document.FileName)
+	case message.Video != nil:
+		return i18n.T(lang, "bot.media.video")
+	case message.Voice != nil:
+		return i18n.T(lang, "bot.media.voice")
+	case message.Audio != nil:
+		return i18n.T(lang, "bot.media.audio")
+	case message.VideoNote != nil:
+		return i18n.T(lang, "bot.media.video_note")
+	case message.Sticker != nil:
+		return i18n.T(lang, "bot.media.sticker")
+	}
+	return ""
+}
+
+// messageContent is the text stored in the ticket for a Telegram message,
+// its formatting kept as Markdown.
+func messageContent(message *tgbotapi.Message, lang string) string {
+	if message.Text != "" {
+		return entitiesMarkdown(message.Text, message.Entities)
+	}
+	return strings.TrimSpace(mediaLabel(message, lang) + "\n" + entitiesMarkdown(message.Caption, message.CaptionEntities))
+}
+
+// markdownMarkers are the Markdown markers of the Telegram formatting that
+// replies keep, see richtext.Markdown.
+var markdownMarkers = map[string][2]string{
+	"bold":          {"**", "**"},
+	"italic":        {"_", "_"},
+	"strikethrough": {"~~", "~~"},
+	"code":          {"`", "`"},
+	"pre":           {"```\n", "\n```"},
+}
+
+// entitiesMarkdown writes the formatting of a Telegram text as Markdown.
+func entitiesMarkdown(text string, entities []tgbotapi.MessageEntity) string {
+	if len(entities) == 0 {
+		return text
+	}
+	units := utf16.Encode([]rune(text))
+
+	type marker struct {
+		pos   int
+		close bool
+		seq   int
+		text  string
+	}
+	sorted := append([]tgbotapi.MessageEntity(nil), entities...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Offset != sorted[j].Offset {
+			return sorted[i].Offset < sorted[j].Offset
+		}
+		return sorted[i].Length > sorted[j].Length
+	})
+	var markers []marker
+	for seq, e := range sorted {
+		pair, ok := markdownMarkers[e.Type]
+		if e.Type == "text_link" {
+			pair, ok = [2]string{"[", "](" + e.URL + ")"}, true
+		}
+		start, end := e.Offset, e.Offset+e.Length
+		if !ok || start < 0 || end > len(units) {
+			continue
+		}
+		if e.Type != "pre" && e.Type != "code" {
+			// Markdown emphasis cannot start or end with a space
+			for start < end && unicode.IsSpace(rune(units[start])) {
+				start++
+			}
+			for end > start && unicode.IsSpace(rune(units[end-1])) {
+				end--
+			}
+		}
+		if start == end {
+			continue
+		}
+		markers = append(markers, marker{start, false, seq, pair[0]}, marker{end, true, seq, pair[1]})
+	}
+	// Inner formatting closes before the outer one
+	sort.SliceStable(markers, func(i, j int) bool {
+		a, b := markers[i], markers[j]
+		switch {
+		case a.pos != b.pos:
+			return a.pos < b.pos
+		case a.close != b.close:
+			return a.close
+		case a.close:
+			return a.seq > b.seq
+		}
+		return a.seq < b.seq
+	})
+
+	var sb strings.Builder
+	pos := 0
+	for _, m := range markers {
+		sb.WriteString(string(utf16.Decode(units[pos:m.pos])))
+		sb.WriteString(m.text)
+		pos = m.pos
+	}
+	sb.WriteString(string(utf16.Decode(units[pos:])))
+	return sb.String()
+}
+
+// sendOperatorReply stores the operator's message on the ticket and delivers
+// it to the customer. It returns the result for the operator.
+func sendOperatorReply(message *tgbotapi.Message, agent *models.User, ticketID int) (richtext.HTML, bool) {
+	lang := language(agent)
+
+	// The ticket history is read by the whole organization
+	content := messageContent(message, organizationLanguage(agent.OrganizationID))
+	if content == "" {
+		return html(lang, "bot.reply.unsupported"), false
+	}
+
+	ticket, err := db.GetTicketByID(ticketID)
+	if err != nil || ticket == nil || ticket.OrganizationID != agent.OrganizationID {
+		return html(lang, "bot.error.ticket_not_found"), false
+	}
+
+	msg := &models.Message{
+		TicketID:       ticketID,
+		UserID:         &agent.ID,
+		Content:        content,
+		IsFromCustomer: false,
+	}
+	if err := tickets.AddMessage(ticket, msg, botActor(agent)); err != nil {
+		log.Printf("Error creating message: %v", err)
+		return html(lang, "bot.error.reply"), false
+	}
+
+	if err := tickets.StartWork(ticket, botActor(agent)); err != nil {
+		log.Printf("Error updating ticket status: %v", err)
+	}
+
+	// Answers written in the ticket's topic are already there
+	if message.Chat.IsPrivate() {
+		mirrorToGroup(ticket, i18n.M("bot.group.agent_message", displayName(agent), richtext.Markdown(content)))
+	}
+
+	if ticket.TelegramChatID == nil {
+		return html(lang, "bot.reply.saved_web_only", ticketID), true
+	}
+
+	if err := deliverToCustomer(*ticket.TelegramChatID, ticketID, message, content, customerLanguage(ticket)); err != nil {
+		log.Printf("Error delivering reply to customer of ticket #%d: %v", ticketID, err)
+		return html(lang, "bot.reply.not_delivered", ticketID), false
+	}
+
+	return html(lang, "bot.reply.sent", ticketID), true
+}
+
+// deliverToCustomer sends the operator's message, keeping its formatting and
+// attachment, prefixed with the ticket number in the customer's language.
+// Text is sent as its stored content, attachments as a copy.
+func deliverToCustomer(customerChatID int64, ticketID int, message *tgbotapi.Message, content, lang string) error {
+	header := i18n.T(lang, "bot.reply.header", ticketID)
+
+	if message.Text != "" {
+		for _, part := range richtext.Split(html(lang, "bot.reply.to_customer", ticketID, richtext.Markdown(content)), messageLimit) {
+			msg := tgbotapi.NewMessage(customerChatID, string(part))
+			msg.ParseMode = tgbotapi.ModeHTML
+			sent, err := BotAPI.Send(msg)
+			if err != nil {
+				return err
+			}
+			linkMessage(customerChatID, sent.MessageID, ticketID)
+		}
+		return nil
+	}
+
+	copyMsg := tgbotapi.NewCopyMessage(customerChatID, message.Chat.ID, message.MessageID)
+	if message.Sticker != nil || message.VideoNote != nil {
+		// These cannot carry a caption
+		sendMessage(customerChatID, richtext.Escape(header))
+	} else {
+		copyMsg.Caption = header
+		if message.Caption != "" {
+			copyMsg.Caption += "\n\n" + message.Caption
+			copyMsg.CaptionEntities = shiftEntities(message.CaptionEntities, utf16Len(header+"\n\n"))
+		}
+	}
+
+	sent, err := BotAPI.CopyMessage(copyMsg)
+	if err != nil {
+		return err
+	}
+	linkMessage(customerChatID, sent.MessageID, ticketID)
+	return nil
+}
+
+// utf16Len is the length of s in UTF-16 code units, the unit of entity offsets.
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+func shiftEntities(entities []tgbotapi.MessageEntity, by int) []tgbotapi.MessageEntity {
+	shifted := make([]tgbotapi.MessageEntity, len(entities))
+	for i, e := range entities {
+		e.Offset += by
+		shifted[i] = e
+	}
+	return shifted
+}
+
+// linkMessage remembers that a bot message is about the ticket so that
+// Telegram replies to it reach the ticket.
+func linkMessage(chatID int64, messageID, ticketID int) {
+	if err := db.LinkTelegramMessage(chatID, messageID, ticketID); err != nil {
+		log.Printf("Error linking message %d in %d to ticket #%d: %v", messageID, chatID, ticketID, err)
+	}
+}
@@ -0,0 +1,371 @@
+package calendar
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"helpdesk/internal/ics"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrCalDAVUnauthorized means the CalDAV server rejected the credentials.
+var ErrCalDAVUnauthorized = errors.New("CalDAV server rejected the credentials")
+
+// CalDAVProvider stores events as calendar objects in a CalDAV collection
+// (RFC 4791), e.g. Nextcloud, Radicale or iCloud. Changes are read with
+// WebDAV collection sync (RFC 6578).
+type CalDAVProvider struct {
+	URL      string // calendar collection, ends with a slash
+	Username string
+	Password string
+	Client   *http.Client
+}
+
+// ErrPrivateAddress means a CalDAV URL leads to a loopback, link-local or
+// private address, which the helpdesk must not be made to request.
+var ErrPrivateAddress = errors.New("CalDAV server address is not public")
+
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast())
+}
+
+// CheckPublicURL verifies that every address the URL's host resolves to is public.
+func CheckPublicURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	ips, err := net.LookupIP(u.Hostname())
+	if err != nil {
+		return err
+	}
+	for _, ip := range ips {
+		if !isPublicIP(ip) {
+			return fmt.Errorf("%w: %s", ErrPrivateAddress, ip)
+		}
+	}
+	return nil
+}
+
+// publicDialer refuses connections to non-public addresses, so a host that
+// resolves differently after CheckPublicURL is still not reached.
+var publicDialer = &net.Dialer{
+	Timeout: 10 * time.Second,
+	Control: func(network, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+			return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+		}
+		return nil
+	},
+}
+
+func NewCalDAVProvider(calendarURL, username, password string) *CalDAVProvider {
+	if !strings.HasSuffix(calendarURL, "/") {
+		calendarURL += "/"
+	}
+	return &CalDAVProvider{
+		URL:      calendarURL,
+		Username: username,
+		Password: password,
+		Client: &http.Client{
+			Timeout:   15 * time.Second,
+			Transport: &http.Transport{DialContext: publicDialer.DialContext},
+		},
+	}
+}
+
+func (p *CalDAVProvider) SyncKey() string {
+	return p.URL
+}
+
+func (p *CalDAVProvider) do(method, target string, body []byte, header map[string]string) (*http.Response, []byte, error) {
+	req, err := http.NewRequest(method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.Username != "" || p.Password != "" {
+		req.SetBasicAuth(p.Username, p.Password)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("CalDAV %s failed: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, nil, ErrCalDAVUnauthorized
+	}
+	return resp, data, nil
+}
+
+func (p *CalDAVProvider) objectURL(id string) string {
+	return p.URL + url.PathEscape(id) + ".ics"
+}
+
+func (p *CalDAVProvider) put(id string, e *Event, header map[string]string) error {
+	var buf bytes.Buffer
+	err := ics.WriteObject(&buf, ics.Event{
+		UID:         id,
+		Start:       e.Start,
+		End:         e.End,
+		Summary:     e.Title,
+		Description: e.Description,
+		Attendees:   e.Attendees,
+	})
+	if err != nil {
+		return err
+	}
+
+	header["Content-Type"] = "text/calendar; charset=utf-8"
+	resp, _, err := p.do("PUT", p.objectURL(id), buf.Bytes(), header)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("CalDAV PUT returned %s", resp.Status)
+	}
+	return nil
+}
+
+// CreateEvent stores the event under a new random ID, which is also its UID.
+func (p *CalDAVProvider) CreateEvent(e *Event) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b)
+
+	if err := p.put(id, e, map[string]string{"If-None-Match": "*"}); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (p *CalDAVProvider) UpdateEvent(id string, e *Event) error {
+	return p.put(id, e, map[string]string{})
+}
+
+func (p *CalDAVProvider) DeleteEvent(id string) error {
+	resp, _, err := p.do("DELETE", p.objectURL(id), nil, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("CalDAV DELETE returned %s", resp.Status)
+	}
+	return nil
+}
+
+type multistatus struct {
+	Responses []davResponse `xml:"DAV: response"`
+	SyncToken string        `xml:"DAV: sync-token"`
+}
+
+type davResponse struct {
+	Href      string     `xml:"DAV: href"`
+	Status    string     `xml:"DAV: status"`
+	Propstats []propstat `xml:"DAV: propstat"`
+}
+
+type propstat struct {
+	Status string `xml:"DAV: status"`
+	Prop   struct {
+		CalendarData string `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+		ResourceType struct {
+			Calendar *struct{} `xml:"urn:ietf:params:xml:ns:caldav calendar"`
+		} `xml:"DAV: resourcetype"`
+	} `xml:"DAV: prop"`
+}
+
+// statusCode reads the code from a status line such as "HTTP/1.1 404 Not Found".
+func statusCode(line string) int {
+	var code int
+	fields := strings.Fields(line)
+	if len(fields) > 1 {
+		fmt.Sscanf(fields[1], "%d", &code)
+	}
+	return code
+}
+
+// calendarData returns the calendar object from a successful propstat.
+func (r davResponse) calendarData() string {
+	for _, ps := range r.Propstats {
+		if statusCode(ps.Status) == http.StatusOK && ps.Prop.CalendarData != "" {
+			return ps.Prop.CalendarData
+		}
+	}
+	return ""
+}
+
+func (p *CalDAVProvider) report(body string, depth string) (*http.Response, *multistatus, []byte, error) {
+	header := map[string]string{"Content-Type": "application/xml; charset=utf-8"}
+	if depth != "" {
+		header["Depth"] = depth
+	}
+	resp, data, err := p.do("REPORT", p.URL, []byte(body), header)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if resp.StatusCode != http.StatusMultiStatus {
+		return resp, nil, data, nil
+	}
+
+	ms := &multistatus{}
+	if err := xml.Unmarshal(data, ms); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid CalDAV response: %w", err)
+	}
+	return resp, ms, data, nil
+}
+
+func caldavTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// FreeBusy reads the events between from and to with recurrences expanded.
+// Cancelled and transparent events do not block time.
+func (p *CalDAVProvider) FreeBusy(from, to time.Time) ([]Busy, error) {
+	body := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop>
+    <C:calendar-data>
+      <C:expand start="%[1]s" end="%[2]s"/>
+    </C:calendar-data>
+  </D:prop>
+  <C:filter>
+    <C:comp-filter name="VCALENDAR">
+      <C:comp-filter name="VEVENT">
+        <C:time-range start="%[1]s" end="%[2]s"/>
+      </C:comp-filter>
+    </C:comp-filter>
+  </C:filter>
+</C:calendar-query>`, caldavTime(from), caldavTime(to))
+
+	resp, ms, _, err := p.report(body, "1")
+	if err != nil {
+		return nil, err
+	}
+	if ms == nil {
+		return nil, fmt.Errorf("CalDAV calendar-query returned %s", resp.Status)
+	}
+
+	var busy []Busy
+	for _, r := range ms.Responses {
+		events, err := ics.Parse(r.calendarData())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", r.Href, err)
+		}
+		for _, e := range events {
+			if e.Cancelled || e.Transparent || !e.Start.Before(to) || !from.Before(e.End) {
+				continue
+			}
+			busy = append(busy, Busy{Start: e.Start, End: e.End})
+		}
+	}
+	return busy, nil
+}
+
+// Changes runs a sync-collection report. Removed objects are reported as
+// cancelled events.
+func (p *CalDAVProvider) Changes(syncToken string) ([]*Change, string, error) {
+	body := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<D:sync-collection xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:sync-token>%s</D:sync-token>
+  <D:sync-level>1</D:sync-level>
+  <D:prop>
+    <D:getetag/>
+    <C:calendar-data/>
+  </D:prop>
+</D:sync-collection>`, xmlEscape(syncToken))
+
+	resp, ms, data, err := p.report(body, "")
+	if err != nil {
+		return nil, "", err
+	}
+	if ms == nil {
+		if bytes.Contains(data, []byte("valid-sync-token")) {
+			return nil, "", ErrSyncTokenInvalid
+		}
+		return nil, "", fmt.Errorf("CalDAV sync-collection returned %s", resp.Status)
+	}
+
+	var changes []*Change
+	for _, r := range ms.Responses {
+		id, err := url.PathUnescape(strings.TrimSuffix(path.Base(r.Href), ".ics"))
+		if err != nil || !strings.HasSuffix(r.Href, ".ics") {
+			continue
+		}
+
+		if statusCode(r.Status) == http.StatusNotFound {
+			changes = append(changes, &Change{EventID: id, Cancelled: true})
+			continue
+		}
+
+		events, err := ics.Parse(r.calendarData())
+		if err != nil || len(events) == 0 {
+			continue
+		}
+		e := events[0]
+		changes = append(changes, &Change{EventID: id, Cancelled: e.Cancelled, Start: e.Start, End: e.End})
+	}
+
+	return changes, ms.SyncToken, nil
+}
+
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+// Check verifies that the URL is a calendar collection the credentials can read.
+func (p *CalDAVProvider) Check() error {
+	body := `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:"><D:prop><D:resourcetype/></D:prop></D:propfind>`
+
+	resp, data, err := p.do("PROPFIND", p.URL, []byte(body), map[string]string{
+		"Content-Type": "application/xml; charset=utf-8",
+		"Depth":        "0",
+	})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusMultiStatus {
+		return fmt.Errorf("CalDAV PROPFIND returned %s", resp.Status)
+	}
+
+	ms := &multistatus{}
+	if err := xml.Unmarshal(data, ms); err != nil {
+		return fmt.Errorf("invalid CalDAV response: %w", err)
+	}
+	for _, r := range ms.Responses {
+		for _, ps := range r.Propstats {
+			if ps.Prop.ResourceType.Calendar != nil {
+				return nil
+			}
+		}
+	}
+	return errors.New("URL is not a CalDAV calendar collection")
+}
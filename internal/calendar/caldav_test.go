@@ -0,0 +1,238 @@
+package calendar
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"helpdesk/internal/ics"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// davServer is a minimal CalDAV collection at /cal/ keeping objects in memory.
+type davServer struct {
+	mu      sync.Mutex
+	objects map[string]string // path -> calendar data
+	headers map[string]http.Header
+}
+
+func (s *davServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user, pass, ok := r.BasicAuth(); !ok || user != "helpdesk" || pass != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	s.headers[r.Method+" "+r.URL.Path] = r.Header.Clone()
+	body, _ := io.ReadAll(r.Body)
+
+	switch r.Method {
+	case "PUT":
+		_, exists := s.objects[r.URL.Path]
+		if r.Header.Get("If-None-Match") == "*" && exists {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		s.objects[r.URL.Path] = string(body)
+		if exists {
+			w.WriteHeader(http.StatusNoContent)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+		}
+	case "DELETE":
+		if _, ok := s.objects[r.URL.Path]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(s.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	case "REPORT":
+		s.report(w, string(body))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func calendarDataXML(data string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(data))
+	return buf.String()
+}
+
+func (s *davServer) report(w http.ResponseWriter, body string) {
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="utf-8"?><D:multistatus xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">`)
+
+	if strings.Contains(body, "sync-collection") {
+		if strings.Contains(body, "<D:sync-token>expired</D:sync-token>") {
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, `<?xml version="1.0"?><D:error xmlns:D="DAV:"><D:valid-sync-token/></D:error>`)
+			return
+		}
+		for p, data := range s.objects {
+			sb.WriteString(`<D:response><D:href>` + p + `</D:href><D:propstat><D:prop><D:getetag>"1"</D:getetag><C:calendar-data>` +
+				calendarDataXML(data) + `</C:calendar-data></D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat></D:response>`)
+		}
+		sb.WriteString(`<D:response><D:href>/cal/removed.ics</D:href><D:status>HTTP/1.1 404 Not Found</D:status></D:response>`)
+		sb.WriteString(`<D:response><D:href>/cal/</D:href><D:status>HTTP/1.1 200 OK</D:status></D:response>`)
+		sb.WriteString(`<D:sync-token>token-2</D:sync-token>`)
+	} else {
+		for p, data := range s.objects {
+			sb.WriteString(`<D:response><D:href>` + p + `</D:href><D:propstat><D:prop><C:calendar-data>` +
+				calendarDataXML(data) + `</C:calendar-data></D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat></D:response>`)
+		}
+	}
+
+	sb.WriteString(`</D:multistatus>`)
+	w.WriteHeader(http.StatusMultiStatus)
+	io.WriteString(w, sb.String())
+}
+
+func newTestProvider(t *testing.T) (*CalDAVProvider, *davServer) {
+	t.Helper()
+	dav := &davServer{objects: make(map[string]string), headers: make(map[string]http.Header)}
+	srv := httptest.NewServer(dav)
+	t.Cleanup(srv.Close)
+
+	p := NewCalDAVProvider(srv.URL+"/cal", "helpdesk", "secret")
+	p.Client = srv.Client()
+	return p, dav
+}
+
+func TestCalDAVCreateUpdateDelete(t *testing.T) {
+	p, dav := newTestProvider(t)
+	start := time.Date(2026, 10, 21, 11, 0, 0, 0, time.UTC)
+
+	id, err := p.CreateEvent(&Event{Title: "Visit: #1", Start: start, End: start.Add(time.Hour), Attendees: []string{"agent@example.com"}})
+	if err != nil {
+		t.Fatalf("CreateEvent: %v", err)
+	}
+	path := "/cal/" + id + ".ics"
+	if got := dav.headers["PUT "+path].Get("If-None-Match"); got != "*" {
+		t.Errorf("create sent If-None-Match %q, want *", got)
+	}
+	if got := dav.headers["PUT "+path].Get("Content-Type"); !strings.HasPrefix(got, "text/calendar") {
+		t.Errorf("create sent Content-Type %q", got)
+	}
+	events, err := ics.Parse(dav.objects[path])
+	if err != nil || len(events) != 1 || events[0].UID != id || !events[0].Start.Equal(start) {
+		t.Fatalf("stored object = %v, %v; want one event %s at %v", events, err, id, start)
+	}
+
+	moved := start.Add(3 * time.Hour)
+	if err := p.UpdateEvent(id, &Event{Title: "Visit: #1", Start: moved, End: moved.Add(time.Hour)}); err != nil {
+		t.Fatalf("UpdateEvent: %v", err)
+	}
+	if events, _ := ics.Parse(dav.objects[path]); len(events) != 1 || !events[0].Start.Equal(moved) {
+		t.Errorf("after update stored %v, want start %v", events, moved)
+	}
+
+	if err := p.DeleteEvent(id); err != nil {
+		t.Fatalf("DeleteEvent: %v", err)
+	}
+	if _, ok := dav.objects[path]; ok {
+		t.Error("object still stored after DeleteEvent")
+	}
+	// Deleting an event that is already gone is not an error
+	if err := p.DeleteEvent(id); err != nil {
+		t.Errorf("second DeleteEvent: %v", err)
+	}
+}
+
+func TestCalDAVUnauthorized(t *testing.T) {
+	p, _ := newTestProvider(t)
+	p.Password = "wrong"
+
+	_, err := p.CreateEvent(&Event{Start: time.Now(), End: time.Now().Add(time.Hour)})
+	if !errors.Is(err, ErrCalDAVUnauthorized) {
+		t.Errorf("CreateEvent with a wrong password: %v, want ErrCalDAVUnauthorized", err)
+	}
+}
+
+func TestCalDAVChanges(t *testing.T) {
+	p, dav := newTestProvider(t)
+	start := time.Date(2026, 10, 21, 11, 0, 0, 0, time.UTC)
+
+	var sb strings.Builder
+	ics.WriteObject(&sb, ics.Event{UID: "moved", Start: start, End: start.Add(time.Hour), Summary: "Visit"})
+	dav.objects["/cal/moved.ics"] = sb.String()
+
+	changes, next, err := p.Changes("token-1")
+	if err != nil {
+		t.Fatalf("Changes: %v", err)
+	}
+	if next != "token-2" {
+		t.Errorf("next sync token = %q, want token-2", next)
+	}
+
+	byID := make(map[string]*Change)
+	for _, c := range changes {
+		byID[c.EventID] = c
+	}
+	if len(changes) != 2 {
+		t.Errorf("got %d changes, want 2 (the collection itself is skipped)", len(changes))
+	}
+	if c := byID["moved"]; c == nil || c.Cancelled || !c.Start.Equal(start) || !c.End.Equal(start.Add(time.Hour)) {
+		t.Errorf("moved change = %+v", c)
+	}
+	if c := byID["removed"]; c == nil || !c.Cancelled {
+		t.Errorf("removed change = %+v, want cancelled", c)
+	}
+
+	if _, _, err := p.Changes("expired"); !errors.Is(err, ErrSyncTokenInvalid) {
+		t.Errorf("Changes with an expired token: %v, want ErrSyncTokenInvalid", err)
+	}
+}
+
+func TestCalDAVFreeBusy(t *testing.T) {
+	p, dav := newTestProvider(t)
+	day := time.Date(2026, 10, 21, 0, 0, 0, 0, time.UTC)
+
+	for id, e := range map[string]ics.Event{
+		"busy":      {UID: "busy", Start: day.Add(10 * time.Hour), End: day.Add(11 * time.Hour)},
+		"cancelled": {UID: "cancelled", Start: day.Add(12 * time.Hour), End: day.Add(13 * time.Hour), Cancelled: true},
+		"free":      {UID: "free", Start: day.Add(14 * time.Hour), End: day.Add(15 * time.Hour), Transparent: true},
+	} {
+		var sb strings.Builder
+		ics.WriteObject(&sb, e)
+		dav.objects["/cal/"+id+".ics"] = sb.String()
+	}
+
+	busy, err := p.FreeBusy(day, day.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("FreeBusy: %v", err)
+	}
+	if len(busy) != 1 || !busy[0].Start.Equal(day.Add(10*time.Hour)) {
+		t.Errorf("busy = %v, want only 10:00-11:00", busy)
+	}
+	if got := dav.headers["REPORT /cal/"].Get("Depth"); got != "1" {
+		t.Errorf("calendar-query sent Depth %q, want 1", got)
+	}
+}
+
+func TestCalDAVRefusesPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached a loopback server")
+	}))
+	defer srv.Close()
+
+	p := NewCalDAVProvider(srv.URL+"/cal", "helpdesk", "secret")
+	if err := p.DeleteEvent("x"); !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("DeleteEvent on a loopback server: %v, want ErrPrivateAddress", err)
+	}
+
+	for _, u := range []string{"http://127.0.0.1/cal/", "http://[::1]/cal/", "http://169.254.169.254/", "https://10.0.0.5/dav/", "http://192.168.1.1/"} {
+		if err := CheckPublicURL(u); !errors.Is(err, ErrPrivateAddress) {
+			t.Errorf("CheckPublicURL(%q) = %v, want ErrPrivateAddress", u, err)
+		}
+	}
+	if err := CheckPublicURL("https://93.184.216.34/dav/"); err != nil {
+		t.Errorf("CheckPublicURL on a public address: %v", err)
+	}
+}
@@ -2,10 +2,13 @@ package calendar
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"helpdesk/internal/db"
 	"helpdesk/internal/models"
 	"log"
+	"net/http"
+	"net/url"
 	"os"
 	"time"
 
@@ -36,6 +39,19 @@ func Init() {
 	}
 }
 
+// Enabled reports whether Google OAuth credentials are configured.
+func Enabled() bool {
+	return oauthConfig != nil
+}
+
+// CalendarID returns the calendar the organization's events go to.
+func CalendarID(org *models.Organization) string {
+	if org.GoogleCalendarID != nil && *org.GoogleCalendarID != "" {
+		return *org.GoogleCalendarID
+	}
+	return "primary"
+}
+
 func GetAuthURL(state string) string {
 	if oauthConfig == nil {
 		return ""
@@ -50,44 +66,40 @@ func ExchangeCode(code string) (*oauth2.Token, error) {
 	return oauthConfig.Exchange(context.Background(), code)
 }
 
+// ErrConnectionBroken means Google rejected the stored refresh token and the
+// calendar has to be connected again.
+var ErrConnectionBroken = errors.New("Google Calendar connection is broken, reconnect required")
+
 func GetCalendarService(orgID int) (*calendar.Service, error) {
+	if oauthConfig == nil {
+		return nil, fmt.Errorf("OAuth config not initialized")
+	}
+
 	token, err := db.GetGoogleCalendarToken(orgID)
-	if err != nil || token == nil {
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
 		return nil, fmt.Errorf("no calendar token found for organization")
 	}
+	if token.BrokenAt != nil {
+		return nil, ErrConnectionBroken
+	}
 
 	oauthToken := &oauth2.Token{
 		AccessToken: token.AccessToken,
 		TokenType:   "Bearer",
 	}
-
 	if token.RefreshToken != nil {
 		oauthToken.RefreshToken = *token.RefreshToken
 	}
-
 	if token.Expiry != nil {
 		oauthToken.Expiry = *token.Expiry
 	}
 
-	// Check if token needs refresh
-	if oauthToken.Expiry.Before(time.Now()) {
-		if err := refreshToken(orgID, oauthToken); err != nil {
-			return nil, fmt.Errorf("failed to refresh token: %w", err)
-		}
-		// Reload token
-		token, err = db.GetGoogleCalendarToken(orgID)
-		if err != nil || token == nil {
-			return nil, fmt.Errorf("failed to reload token")
-		}
-		oauthToken.AccessToken = token.AccessToken
-		if token.Expiry != nil {
-			oauthToken.Expiry = *token.Expiry
-		}
-	}
-
 	ctx := context.Background()
-	client := oauthConfig.Client(ctx, oauthToken)
-	
+	client := oauth2.NewClient(ctx, newTokenSource(orgID, oauthToken))
+
 	service, err := calendar.NewService(ctx, option.WithHTTPClient(client))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create calendar service: %w", err)
@@ -96,56 +108,66 @@ func GetCalendarService(orgID int) (*calendar.Service, error) {
 	return service, nil
 }
 
-func refreshToken(orgID int, token *oauth2.Token) error {
-	if oauthConfig == nil {
-		return fmt.Errorf("OAuth config not initialized")
-	}
-
-	ctx := context.Background()
-	newToken, err := oauthConfig.TokenSource(ctx, token).Token()
-	if err != nil {
-		return err
-	}
-
-	expiry := newToken.Expiry
-	return db.UpdateGoogleCalendarToken(orgID, newToken.AccessToken, newToken.RefreshToken, &expiry)
+// CalendarInfo is a calendar the connected account can write to.
+type CalendarInfo struct {
+	ID      string
+	Summary string
+	Primary bool
 }
 
-func CreateEvent(orgID int, title, description string, startTime, endTime time.Time) (*calendar.Event, error) {
+// ListCalendars returns the calendars the organization's account may add events to.
+func ListCalendars(orgID int) ([]CalendarInfo, error) {
 	service, err := GetCalendarService(orgID)
 	if err != nil {
 		return nil, err
 	}
 
-	org, err := db.GetOrganizationByID(orgID)
+	list, err := service.CalendarList.List().MinAccessRole("writer").Do()
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to list calendars: %w", err)
 	}
 
-	calendarID := "primary"
-	if org.GoogleCalendarID != nil && *org.GoogleCalendarID != "" {
-		calendarID = *org.GoogleCalendarID
+	var calendars []CalendarInfo
+	for _, item := range list.Items {
+		calendars = append(calendars, CalendarInfo{ID: item.Id, Summary: item.Summary, Primary: item.Primary})
 	}
+	return calendars, nil
+}
+
+const revokeURL = "https://oauth2.googleapis.com/revoke"
 
-	event := &calendar.Event{
-		Summary:     title,
-		Description: description,
-		Start: &calendar.EventDateTime{
-			DateTime: startTime.Format(time.RFC3339),
-			TimeZone: "UTC",
-		},
-		End: &calendar.EventDateTime{
-			DateTime: endTime.Format(time.RFC3339),
-			TimeZone: "UTC",
-		},
+// Disconnect revokes the organization's Google grant and forgets its tokens.
+// The tokens are removed even if Google could not be reached.
+func Disconnect(orgID int) error {
+	token, err := db.GetGoogleCalendarToken(orgID)
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return nil
 	}
 
-	createdEvent, err := service.Events.Insert(calendarID, event).Do()
+	// Revoking the refresh token also revokes its access tokens
+	value := token.AccessToken
+	if token.RefreshToken != nil && *token.RefreshToken != "" {
+		value = *token.RefreshToken
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.PostForm(revokeURL, url.Values{"token": {value}})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create event: %w", err)
+		log.Printf("Error revoking Google token for organization %d: %v", orgID, err)
+	} else {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			log.Printf("Google token revocation for organization %d returned %s", orgID, resp.Status)
+		}
 	}
 
-	return createdEvent, nil
+	if err := db.DeleteGoogleCalendarToken(orgID); err != nil {
+		return err
+	}
+	return db.UpdateOrganizationCalendarID(orgID, nil)
 }
 
 func SaveToken(orgID int, token *oauth2.Token) error {
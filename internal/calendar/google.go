@@ -0,0 +1,200 @@
+package calendar
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// GoogleProvider stores events in a Google calendar connected over OAuth.
+type GoogleProvider struct {
+	OrgID      int
+	CalendarID string
+	Timezone   string
+}
+
+func (p *GoogleProvider) SyncKey() string {
+	return p.CalendarID
+}
+
+func (p *GoogleProvider) toGoogle(e *Event) *calendar.Event {
+	event := &calendar.Event{
+		Summary:     e.Title,
+		Description: e.Description,
+		Start: &calendar.EventDateTime{
+			DateTime: e.Start.Format(time.RFC3339),
+			TimeZone: p.Timezone,
+		},
+		End: &calendar.EventDateTime{
+			DateTime: e.End.Format(time.RFC3339),
+			TimeZone: p.Timezone,
+		},
+	}
+	for _, email := range e.Attendees {
+		event.Attendees = append(event.Attendees, &calendar.EventAttendee{Email: email})
+	}
+	return event
+}
+
+// CreateEvent adds the event and emails invitations to its attendees.
+func (p *GoogleProvider) CreateEvent(e *Event) (string, error) {
+	service, err := GetCalendarService(p.OrgID)
+	if err != nil {
+		return "", err
+	}
+
+	created, err := service.Events.Insert(p.CalendarID, p.toGoogle(e)).SendUpdates("all").Do()
+	if err != nil {
+		return "", fmt.Errorf("failed to create event: %w", err)
+	}
+	return created.Id, nil
+}
+
+func (p *GoogleProvider) UpdateEvent(id string, e *Event) error {
+	service, err := GetCalendarService(p.OrgID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := service.Events.Update(p.CalendarID, id, p.toGoogle(e)).SendUpdates("all").Do(); err != nil {
+		return fmt.Errorf("failed to update event: %w", err)
+	}
+	return nil
+}
+
+func (p *GoogleProvider) DeleteEvent(id string) error {
+	service, err := GetCalendarService(p.OrgID)
+	if err != nil {
+		return err
+	}
+
+	if err := service.Events.Delete(p.CalendarID, id).SendUpdates("all").Do(); err != nil {
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusGone {
+			return nil
+		}
+		return fmt.Errorf("failed to delete event: %w", err)
+	}
+	return nil
+}
+
+func (p *GoogleProvider) FreeBusy(from, to time.Time) ([]Busy, error) {
+	service, err := GetCalendarService(p.OrgID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := service.Freebusy.Query(&calendar.FreeBusyRequest{
+		TimeMin: from.Format(time.RFC3339),
+		TimeMax: to.Format(time.RFC3339),
+		Items:   []*calendar.FreeBusyRequestItem{{Id: p.CalendarID}},
+	}).Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query free/busy: %w", err)
+	}
+
+	cal, ok := resp.Calendars[p.CalendarID]
+	if !ok {
+		return nil, fmt.Errorf("calendar %s missing from free/busy response", p.CalendarID)
+	}
+	if len(cal.Errors) > 0 {
+		return nil, fmt.Errorf("free/busy error for calendar %s: %s", p.CalendarID, cal.Errors[0].Reason)
+	}
+
+	var busy []Busy
+	for _, period := range cal.Busy {
+		start, err := time.Parse(time.RFC3339, period.Start)
+		if err != nil {
+			return nil, err
+		}
+		end, err := time.Parse(time.RFC3339, period.End)
+		if err != nil {
+			return nil, err
+		}
+		busy = append(busy, Busy{Start: start, End: end})
+	}
+
+	return busy, nil
+}
+
+func (p *GoogleProvider) Changes(syncToken string) ([]*Change, string, error) {
+	service, err := GetCalendarService(p.OrgID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var changes []*Change
+	pageToken := ""
+	for {
+		call := service.Events.List(p.CalendarID).ShowDeleted(true).SingleEvents(true).MaxResults(250)
+		if syncToken != "" {
+			call = call.SyncToken(syncToken)
+		}
+		if pageToken != "" {
+			call = call.PageToken(pageToken)
+		}
+
+		events, err := call.Do()
+		if err != nil {
+			var apiErr *googleapi.Error
+			if errors.As(err, &apiErr) && apiErr.Code == http.StatusGone {
+				return nil, "", ErrSyncTokenInvalid
+			}
+			return nil, "", fmt.Errorf("failed to list events: %w", err)
+		}
+
+		for _, item := range events.Items {
+			change, err := toChange(item)
+			if err != nil {
+				log.Printf("Skipping calendar event for organization %d: %v", p.OrgID, err)
+				continue
+			}
+			changes = append(changes, change)
+		}
+
+		if events.NextPageToken == "" {
+			return changes, events.NextSyncToken, nil
+		}
+		pageToken = events.NextPageToken
+	}
+}
+
+func toChange(event *calendar.Event) (*Change, error) {
+	change := &Change{EventID: event.Id, Cancelled: event.Status == "cancelled"}
+	// Cancelled events come without times
+	if change.Cancelled {
+		return change, nil
+	}
+
+	var err error
+	if change.Start, err = eventTime(event.Start); err != nil {
+		return nil, fmt.Errorf("event %s: %w", event.Id, err)
+	}
+	if change.End, err = eventTime(event.End); err != nil {
+		return nil, fmt.Errorf("event %s: %w", event.Id, err)
+	}
+	return change, nil
+}
+
+// eventTime reads a timed or an all-day event boundary.
+func eventTime(t *calendar.EventDateTime) (time.Time, error) {
+	if t == nil {
+		return time.Time{}, errors.New("missing event time")
+	}
+	if t.DateTime != "" {
+		return time.Parse(time.RFC3339, t.DateTime)
+	}
+
+	loc := time.UTC
+	if t.TimeZone != "" {
+		if l, err := time.LoadLocation(t.TimeZone); err == nil {
+			loc = l
+		}
+	}
+	return time.ParseInLocation("2006-01-02", t.Date, loc)
+}
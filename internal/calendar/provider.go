@@ -0,0 +1,100 @@
+package calendar
+
+import (
+	"errors"
+	"fmt"
+	"helpdesk/internal/db"
+	"time"
+)
+
+// Calendar providers an organization can store appointments in.
+const (
+	ProviderGoogle = "google"
+	ProviderCalDAV = "caldav"
+)
+
+// ErrNotConnected means the organization has not connected its selected
+// calendar provider.
+var ErrNotConnected = errors.New("calendar is not connected")
+
+// ErrSyncTokenInvalid means the calendar no longer accepts the sync token and
+// a full sync is required.
+var ErrSyncTokenInvalid = errors.New("calendar sync token is no longer valid")
+
+// Event is an appointment written to a provider's calendar.
+type Event struct {
+	Title       string
+	Description string
+	Start       time.Time
+	End         time.Time
+	Attendees   []string // email addresses
+}
+
+// Busy is a period in which a calendar is occupied.
+type Busy struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Change is the current state of an event reported by an incremental sync.
+type Change struct {
+	EventID   string
+	Cancelled bool
+	Start     time.Time
+	End       time.Time
+}
+
+// ChangeSource reports the changes made in a calendar.
+type ChangeSource interface {
+	// Changes lists events changed since syncToken, or all events when
+	// syncToken is empty, together with the token for the next call.
+	Changes(syncToken string) (changes []*Change, nextSyncToken string, err error)
+	// SyncKey identifies the calendar sync tokens belong to; a new key
+	// starts a full sync.
+	SyncKey() string
+}
+
+// Provider is an organization's calendar.
+type Provider interface {
+	ChangeSource
+	// CreateEvent adds an event and returns its ID in the calendar.
+	CreateEvent(e *Event) (string, error)
+	UpdateEvent(id string, e *Event) error
+	DeleteEvent(id string) error
+	// FreeBusy returns the busy periods between from and to.
+	FreeBusy(from, to time.Time) ([]Busy, error)
+}
+
+// ForOrganization returns the organization's selected calendar provider.
+// Tests may replace it to use a stand-in calendar.
+var ForOrganization = providerFor
+
+func providerFor(orgID int) (Provider, error) {
+	org, err := db.GetOrganizationByID(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch org.CalendarProvider {
+	case ProviderCalDAV:
+		account, err := db.GetCalDAVAccount(orgID)
+		if err != nil {
+			return nil, err
+		}
+		if account == nil {
+			return nil, ErrNotConnected
+		}
+		return NewCalDAVProvider(account.CalendarURL, account.Username, account.Password), nil
+	case ProviderGoogle, "":
+		if !Enabled() {
+			return nil, ErrNotConnected
+		}
+		timezone := org.Timezone
+		if timezone == "" {
+			timezone = "UTC"
+		}
+		return &GoogleProvider{OrgID: orgID, CalendarID: CalendarID(org), Timezone: timezone}, nil
+	default:
+		return nil, fmt.Errorf("unknown calendar provider %q", org.CalendarProvider)
+	}
+}
@@ -0,0 +1,75 @@
+package calendar
+
+import (
+	"context"
+	"errors"
+	"helpdesk/internal/db"
+	"log"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// OnConnectionBroken is called when Google rejects an organization's refresh
+// token, e.g. to alert administrators. reason is Google's error description.
+var OnConnectionBroken func(orgID int, reason string)
+
+// persistingTokenSource refreshes tokens through the OAuth config and stores
+// every new token, so refreshed access tokens survive restarts.
+type persistingTokenSource struct {
+	orgID int
+	base  oauth2.TokenSource
+
+	mu   sync.Mutex
+	last string // access token last seen in the database
+}
+
+func newTokenSource(orgID int, token *oauth2.Token) oauth2.TokenSource {
+	return &persistingTokenSource{
+		orgID: orgID,
+		base:  oauthConfig.TokenSource(context.Background(), token),
+		last:  token.AccessToken,
+	}
+}
+
+func (s *persistingTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, err := s.base.Token()
+	if err != nil {
+		var re *oauth2.RetrieveError
+		if errors.As(err, &re) && re.ErrorCode == "invalid_grant" {
+			s.markBroken(re)
+			return nil, ErrConnectionBroken
+		}
+		return nil, err
+	}
+
+	if token.AccessToken != s.last {
+		// Google usually omits the refresh token on refresh; the stored one is kept then
+		expiry := token.Expiry
+		if err := db.UpdateGoogleCalendarToken(s.orgID, token.AccessToken, token.RefreshToken, &expiry); err != nil {
+			log.Printf("Error saving refreshed Google token for organization %d: %v", s.orgID, err)
+		} else {
+			s.last = token.AccessToken
+		}
+	}
+
+	return token, nil
+}
+
+func (s *persistingTokenSource) markBroken(re *oauth2.RetrieveError) {
+	reason := re.ErrorDescription
+	if reason == "" {
+		reason = re.ErrorCode
+	}
+
+	log.Printf("Google rejected the refresh token of organization %d: %s", s.orgID, reason)
+	if err := db.MarkGoogleCalendarTokenBroken(s.orgID, reason); err != nil {
+		log.Printf("Error marking Google connection of organization %d broken: %v", s.orgID, err)
+	}
+	if OnConnectionBroken != nil {
+		OnConnectionBroken(s.orgID, reason)
+	}
+}
@@ -0,0 +1,124 @@
+// Package calsync brings changes made directly in an organization's calendar
+// (rescheduled or cancelled events) back into ticket appointments.
+package calsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"helpdesk/internal/calendar"
+	"helpdesk/internal/db"
+	"helpdesk/internal/i18n"
+	"helpdesk/internal/models"
+	"helpdesk/internal/tickets"
+	"log"
+)
+
+var systemActor = tickets.Actor{Channel: tickets.ChannelSystem}
+
+// The calendar, storage and ticket operations the sync uses. Tests replace
+// them with stand-ins.
+var (
+	changeSource = func(orgID int) (calendar.ChangeSource, error) { return calendar.ForOrganization(orgID) }
+
+	getSyncToken       = db.GetCalendarSyncToken
+	saveSyncToken      = db.SaveCalendarSyncToken
+	getEvent           = db.GetTicketEventByExternalID
+	getTicket          = db.GetTicketByID
+	recordCancel       = tickets.RecordCancel
+	recordReschedule   = tickets.RecordReschedule
+	appointmentSummary = tickets.AppointmentSummary
+)
+
+// SyncOrganization applies the changes in the organization's calendar since
+// the last sync. When the stored sync token has expired it falls back to a
+// full sync. notify informs a ticket's customer. When ctx is done it stops
+// before the next change and keeps the old token.
+func SyncOrganization(ctx context.Context, orgID int, notify func(ticket *models.Ticket, text i18n.Message)) error {
+	source, err := changeSource(orgID)
+	if err != nil {
+		return err
+	}
+	key := source.SyncKey()
+
+	token, err := getSyncToken(orgID, key)
+	if err != nil {
+		return err
+	}
+
+	changes, next, err := source.Changes(token)
+	if errors.Is(err, calendar.ErrSyncTokenInvalid) {
+		log.Printf("Calendar sync token expired for organization %d, running full sync", orgID)
+		changes, next, err = source.Changes("")
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := applyChange(orgID, change, notify); err != nil {
+			// Keep the old token so the change is retried
+			return fmt.Errorf("event %s: %w", change.EventID, err)
+		}
+	}
+
+	if next == "" {
+		return nil
+	}
+	return saveSyncToken(orgID, key, next)
+}
+
+func applyChange(orgID int, change *calendar.Change, notify func(ticket *models.Ticket, text i18n.Message)) error {
+	event, err := getEvent(orgID, change.EventID)
+	if err != nil || event == nil {
+		return err
+	}
+
+	ticket, err := getTicket(event.TicketID)
+	if err != nil {
+		return err
+	}
+
+	if change.Cancelled {
+		if event.Status == "cancelled" {
+			return nil
+		}
+		if err := recordCancel(ticket, event, systemActor); err != nil {
+			return err
+		}
+		notify(ticket, i18n.M("calsync.cancelled", ticket.ID, appointmentSummary(event)))
+		return nil
+	}
+
+	if event.Status == "scheduled" && event.StartsAt.Equal(change.Start) && event.EndsAt.Equal(change.End) {
+		return nil
+	}
+	if err := recordReschedule(ticket, event, change.Start, change.End, systemActor); err != nil {
+		return err
+	}
+	notify(ticket, i18n.M("calsync.rescheduled", ticket.ID, appointmentSummary(event)))
+	return nil
+}
+
+// SyncAll syncs every organization with a connected calendar until ctx is
+// done.
+func SyncAll(ctx context.Context, notify func(ticket *models.Ticket, text i18n.Message)) error {
+	orgIDs, err := db.GetCalendarOrganizationIDs()
+	if err != nil {
+		return err
+	}
+
+	for _, orgID := range orgIDs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := SyncOrganization(ctx, orgID, notify)
+		if err != nil && !errors.Is(err, calendar.ErrNotConnected) {
+			log.Printf("Error syncing calendar for organization %d: %v", orgID, err)
+		}
+	}
+	return nil
+}
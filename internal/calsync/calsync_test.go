@@ -0,0 +1,176 @@
+package calsync
+
+import (
+	"context"
+	"helpdesk/internal/calendar"
+	"helpdesk/internal/i18n"
+	"helpdesk/internal/models"
+	"helpdesk/internal/tickets"
+	"testing"
+	"time"
+)
+
+// fakeSource serves the changes of a calendar by sync token.
+type fakeSource struct {
+	changes map[string][]*calendar.Change
+	next    string
+	expired map[string]bool
+	calls   []string
+}
+
+func (f *fakeSource) Changes(token string) ([]*calendar.Change, string, error) {
+	f.calls = append(f.calls, token)
+	if f.expired[token] {
+		return nil, "", calendar.ErrSyncTokenInvalid
+	}
+	return f.changes[token], f.next, nil
+}
+
+func (f *fakeSource) SyncKey() string { return "fake" }
+
+// fakeStore stands in for the database and ticket service.
+type fakeStore struct {
+	token       string
+	saved       string
+	events      map[string]*models.TicketEvent
+	cancelled   []int
+	rescheduled []int
+	notices     []string
+}
+
+func setup(t *testing.T, source *fakeSource, store *fakeStore) {
+	t.Helper()
+	origSource, origGetToken, origSaveToken, origGetEvent := changeSource, getSyncToken, saveSyncToken, getEvent
+	origGetTicket, origCancel, origReschedule, origSummary := getTicket, recordCancel, recordReschedule, appointmentSummary
+	t.Cleanup(func() {
+		changeSource, getSyncToken, saveSyncToken, getEvent = origSource, origGetToken, origSaveToken, origGetEvent
+		getTicket, recordCancel, recordReschedule, appointmentSummary = origGetTicket, origCancel, origReschedule, origSummary
+	})
+
+	changeSource = func(int) (calendar.ChangeSource, error) { return source, nil }
+	getSyncToken = func(int, string) (string, error) { return store.token, nil }
+	saveSyncToken = func(_ int, _ string, token string) error {
+		store.saved = token
+		return nil
+	}
+	getEvent = func(_ int, id string) (*models.TicketEvent, error) { return store.events[id], nil }
+	getTicket = func(id int) (*models.Ticket, error) { return &models.Ticket{ID: id}, nil }
+	recordCancel = func(_ *models.Ticket, e *models.TicketEvent, _ tickets.Actor) error {
+		e.Status = "cancelled"
+		store.cancelled = append(store.cancelled, e.ID)
+		return nil
+	}
+	recordReschedule = func(_ *models.Ticket, e *models.TicketEvent, start, end time.Time, _ tickets.Actor) error {
+		e.StartsAt, e.EndsAt, e.Status = start, end, "scheduled"
+		store.rescheduled = append(store.rescheduled, e.ID)
+		return nil
+	}
+	appointmentSummary = func(*models.TicketEvent) i18n.Message { return i18n.M("summary") }
+}
+
+func (s *fakeStore) notify(_ *models.Ticket, text i18n.Message) {
+	s.notices = append(s.notices, text.Key)
+}
+
+func scheduled(id int, start time.Time) *models.TicketEvent {
+	return &models.TicketEvent{ID: id, TicketID: 100 + id, StartsAt: start, EndsAt: start.Add(time.Hour), Status: "scheduled"}
+}
+
+func TestSyncOrganizationMovedEvent(t *testing.T) {
+	start := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	moved := start.Add(2 * time.Hour)
+	source := &fakeSource{
+		changes: map[string][]*calendar.Change{"t1": {
+			{EventID: "moved", Start: moved, End: moved.Add(time.Hour)},
+			{EventID: "same", Start: start, End: start.Add(time.Hour)},
+			{EventID: "unknown", Start: start, End: start.Add(time.Hour)},
+		}},
+		next: "t2",
+	}
+	store := &fakeStore{token: "t1", events: map[string]*models.TicketEvent{
+		"moved": scheduled(1, start),
+		"same":  scheduled(2, start),
+	}}
+	setup(t, source, store)
+
+	if err := SyncOrganization(context.Background(), 1, store.notify); err != nil {
+		t.Fatalf("SyncOrganization: %v", err)
+	}
+
+	if len(store.rescheduled) != 1 || store.rescheduled[0] != 1 {
+		t.Errorf("rescheduled = %v, want [1]", store.rescheduled)
+	}
+	if e := store.events["moved"]; !e.StartsAt.Equal(moved) {
+		t.Errorf("moved event starts at %v, want %v", e.StartsAt, moved)
+	}
+	if len(store.notices) != 1 || store.notices[0] != "calsync.rescheduled" {
+		t.Errorf("notices = %v, want [calsync.rescheduled]", store.notices)
+	}
+	if store.saved != "t2" {
+		t.Errorf("saved token = %q, want t2", store.saved)
+	}
+}
+
+func TestSyncOrganizationCancelledEvent(t *testing.T) {
+	start := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	source := &fakeSource{
+		changes: map[string][]*calendar.Change{"t1": {
+			{EventID: "gone", Cancelled: true},
+			{EventID: "already", Cancelled: true},
+		}},
+		next: "t2",
+	}
+	already := scheduled(2, start)
+	already.Status = "cancelled"
+	store := &fakeStore{token: "t1", events: map[string]*models.TicketEvent{
+		"gone":    scheduled(1, start),
+		"already": already,
+	}}
+	setup(t, source, store)
+
+	if err := SyncOrganization(context.Background(), 1, store.notify); err != nil {
+		t.Fatalf("SyncOrganization: %v", err)
+	}
+
+	if len(store.cancelled) != 1 || store.cancelled[0] != 1 {
+		t.Errorf("cancelled = %v, want [1]", store.cancelled)
+	}
+	if len(store.notices) != 1 || store.notices[0] != "calsync.cancelled" {
+		t.Errorf("notices = %v, want [calsync.cancelled]", store.notices)
+	}
+	if store.saved != "t2" {
+		t.Errorf("saved token = %q, want t2", store.saved)
+	}
+}
+
+func TestSyncOrganizationExpiredTokenRunsFullSync(t *testing.T) {
+	start := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	moved := start.Add(24 * time.Hour)
+	source := &fakeSource{
+		changes: map[string][]*calendar.Change{"": {
+			{EventID: "moved", Start: moved, End: moved.Add(time.Hour)},
+			{EventID: "gone", Cancelled: true},
+		}},
+		expired: map[string]bool{"stale": true},
+		next:    "fresh",
+	}
+	store := &fakeStore{token: "stale", events: map[string]*models.TicketEvent{
+		"moved": scheduled(1, start),
+		"gone":  scheduled(2, start),
+	}}
+	setup(t, source, store)
+
+	if err := SyncOrganization(context.Background(), 1, store.notify); err != nil {
+		t.Fatalf("SyncOrganization: %v", err)
+	}
+
+	if len(source.calls) != 2 || source.calls[0] != "stale" || source.calls[1] != "" {
+		t.Errorf("Changes called with %q, want [stale \"\"]", source.calls)
+	}
+	if len(store.rescheduled) != 1 || len(store.cancelled) != 1 {
+		t.Errorf("rescheduled = %v, cancelled = %v, want one of each", store.rescheduled, store.cancelled)
+	}
+	if store.saved != "fresh" {
+		t.Errorf("saved token = %q, want fresh", store.saved)
+	}
+}
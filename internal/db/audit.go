@@ -0,0 +1,88 @@
+package db
+
+import (
+	"database/sql"
+	"helpdesk/internal/models"
+	"time"
+)
+
+const insertAuditEvent = `
+	INSERT INTO audit_events (organization_id, ticket_id, actor_id, channel, action,
+	                          before_value, after_value)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING id, created_at`
+
+func CreateAuditEvent(event *models.AuditEvent) error {
+	err := DB.QueryRow(insertAuditEvent,
+		event.OrganizationID, event.TicketID, event.ActorID, event.Channel, event.Action,
+		event.Before, event.After,
+	).Scan(&event.ID, &event.CreatedAt)
+
+	return err
+}
+
+func GetAuditEventsByTicket(ticketID int) ([]*models.AuditEvent, error) {
+	query := `
+		SELECT id, organization_id, ticket_id, actor_id, channel, action, before_value,
+		       after_value, created_at
+		FROM audit_events WHERE ticket_id = $1
+		ORDER BY created_at ASC, id ASC`
+
+	return queryAuditEvents(query, ticketID)
+}
+
+// GetAuditEventsByOrganization returns the organization's audit log between
+// from and to. A ticketID of 0 returns events for all tickets.
+func GetAuditEventsByOrganization(orgID int, from, to time.Time, ticketID int) ([]*models.AuditEvent, error) {
+	query := `
+		SELECT id, organization_id, ticket_id, actor_id, channel, action, before_value,
+		       after_value, created_at
+		FROM audit_events
+		WHERE organization_id = $1 AND created_at >= $2 AND created_at < $3
+		  AND ($4 = 0 OR ticket_id = $4)
+		ORDER BY created_at ASC, id ASC`
+
+	return queryAuditEvents(query, orgID, from, to, ticketID)
+}
+
+func queryAuditEvents(query string, args ...interface{}) ([]*models.AuditEvent, error) {
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*models.AuditEvent
+	for rows.Next() {
+		event := &models.AuditEvent{}
+		var ticketID, actorID sql.NullInt64
+		var before, after sql.NullString
+
+		err := rows.Scan(
+			&event.ID, &event.OrganizationID, &ticketID, &actorID, &event.Channel,
+			&event.Action, &before, &after, &event.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if ticketID.Valid {
+			tid := int(ticketID.Int64)
+			event.TicketID = &tid
+		}
+		if actorID.Valid {
+			aid := int(actorID.Int64)
+			event.ActorID = &aid
+		}
+		if before.Valid {
+			event.Before = &before.String
+		}
+		if after.Valid {
+			event.After = &after.String
+		}
+
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"database/sql"
+	"helpdesk/internal/models"
+	"time"
+)
+
+func GetBusinessHours(orgID int) ([]*models.BusinessHours, error) {
+	query := `
+		SELECT id, organization_id, weekday, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI')
+		FROM business_hours WHERE organization_id = $1
+		ORDER BY weekday ASC`
+
+	rows, err := DB.Query(query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hours []*models.BusinessHours
+	for rows.Next() {
+		h := &models.BusinessHours{}
+		err := rows.Scan(&h.ID, &h.OrganizationID, &h.Weekday, &h.StartTime, &h.EndTime)
+		if err != nil {
+			return nil, err
+		}
+		hours = append(hours, h)
+	}
+
+	return hours, rows.Err()
+}
+
+// ReplaceBusinessHours swaps the organization's whole weekly schedule.
+func ReplaceBusinessHours(orgID int, hours []*models.BusinessHours) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM business_hours WHERE organization_id = $1`, orgID); err != nil {
+		return err
+	}
+
+	for _, h := range hours {
+		_, err := tx.Exec(`
+			INSERT INTO business_hours (organization_id, weekday, start_time, end_time)
+			VALUES ($1, $2, $3, $4)`,
+			orgID, h.Weekday, h.StartTime, h.EndTime,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func GetHolidays(orgID int) ([]*models.Holiday, error) {
+	query := `
+		SELECT id, organization_id, date, name
+		FROM holidays WHERE organization_id = $1
+		ORDER BY date ASC`
+
+	rows, err := DB.Query(query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var holidays []*models.Holiday
+	for rows.Next() {
+		h := &models.Holiday{}
+		var name sql.NullString
+
+		if err := rows.Scan(&h.ID, &h.OrganizationID, &h.Date, &name); err != nil {
+			return nil, err
+		}
+		if name.Valid {
+			h.Name = &name.String
+		}
+
+		holidays = append(holidays, h)
+	}
+
+	return holidays, rows.Err()
+}
+
+func CreateHoliday(orgID int, date time.Time, name string) error {
+	query := `
+		INSERT INTO holidays (organization_id, date, name) VALUES ($1, $2, $3)
+		ON CONFLICT (organization_id, date) DO UPDATE SET name = EXCLUDED.name`
+	_, err := DB.Exec(query, orgID, date.Format("2006-01-02"), name)
+	return err
+}
+
+func DeleteHoliday(orgID, id int) error {
+	query := `DELETE FROM holidays WHERE organization_id = $1 AND id = $2`
+	_, err := DB.Exec(query, orgID, id)
+	return err
+}
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"helpdesk/internal/models"
+	"helpdesk/internal/secrets"
+)
+
+// passwordColumn is the column the encrypted CalDAV password is bound to.
+const passwordColumn = "caldav_accounts.password"
+
+func GetCalDAVAccount(orgID int) (*models.CalDAVAccount, error) {
+	query := `
+		SELECT organization_id, calendar_url, username, password, created_at, updated_at
+		FROM caldav_accounts WHERE organization_id = $1`
+
+	account := &models.CalDAVAccount{}
+	var username, password sql.NullString
+
+	err := DB.QueryRow(query, orgID).Scan(
+		&account.OrganizationID, &account.CalendarURL, &username, &password,
+		&account.CreatedAt, &account.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	account.Username = username.String
+	if account.Password, err = secrets.Decrypt(password.String, orgID, passwordColumn); err != nil {
+		return nil, fmt.Errorf("failed to decrypt CalDAV password: %w", err)
+	}
+
+	return account, nil
+}
+
+// SaveCalDAVAccount stores the organization's CalDAV account with the password encrypted.
+func SaveCalDAVAccount(account *models.CalDAVAccount) error {
+	password, err := secrets.Encrypt(account.Password, account.OrganizationID, passwordColumn)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt CalDAV password: %w", err)
+	}
+
+	query := `
+		INSERT INTO caldav_accounts (organization_id, calendar_url, username, password)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (organization_id) DO UPDATE SET
+			calendar_url = EXCLUDED.calendar_url,
+			username = EXCLUDED.username,
+			password = EXCLUDED.password,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING created_at, updated_at`
+
+	return DB.QueryRow(query, account.OrganizationID, account.CalendarURL, account.Username, password).
+		Scan(&account.CreatedAt, &account.UpdatedAt)
+}
+
+// DeleteCalDAVAccount removes the organization's CalDAV account and its sync position.
+func DeleteCalDAVAccount(orgID int) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM caldav_accounts WHERE organization_id = $1`, orgID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM calendar_sync_state WHERE organization_id = $1`, orgID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RewrapCalDAVPasswords encrypts passwords stored as plain text or under a
+// retired master key with the active key. It returns the number of accounts updated.
+func RewrapCalDAVPasswords() (int, error) {
+	rows, err := DB.Query(`SELECT organization_id, password FROM caldav_accounts WHERE password IS NOT NULL`)
+	if err != nil {
+		return 0, err
+	}
+
+	stale := make(map[int]string)
+	for rows.Next() {
+		var orgID int
+		var password string
+		if err := rows.Scan(&orgID, &password); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if secrets.NeedsRewrap(password) {
+			stale[orgID] = password
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for orgID, stored := range stale {
+		password, err := secrets.Rewrap(stored, orgID, passwordColumn)
+		if err != nil {
+			return updated, fmt.Errorf("organization %d: %w", orgID, err)
+		}
+		// Skip passwords changed since they were read
+		res, err := DB.Exec(`UPDATE caldav_accounts SET password = $1 WHERE organization_id = $2 AND password = $3`,
+			password, orgID, stored)
+		if err != nil {
+			return updated, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			updated++
+		}
+	}
+
+	return updated, nil
+}
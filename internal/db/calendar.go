@@ -2,11 +2,19 @@ package db
 
 import (
 	"database/sql"
+	"fmt"
 	"helpdesk/internal/models"
+	"helpdesk/internal/secrets"
 	"time"
 )
 
+// SaveGoogleCalendarToken stores the organization's OAuth tokens encrypted.
 func SaveGoogleCalendarToken(token *models.GoogleCalendarToken) error {
+	accessToken, refreshToken, err := encryptTokens(token.OrganizationID, token.AccessToken, token.RefreshToken)
+	if err != nil {
+		return err
+	}
+
 	query := `
 		INSERT INTO google_calendar_tokens (organization_id, access_token, refresh_token, 
 		                                   token_type, expiry)
@@ -16,30 +24,54 @@ func SaveGoogleCalendarToken(token *models.GoogleCalendarToken) error {
 			refresh_token = EXCLUDED.refresh_token,
 			token_type = EXCLUDED.token_type,
 			expiry = EXCLUDED.expiry,
+			broken_at = NULL,
+			broken_reason = NULL,
 			updated_at = CURRENT_TIMESTAMP
 		RETURNING id, created_at, updated_at`
 	
-	err := DB.QueryRow(query,
-		token.OrganizationID, token.AccessToken, token.RefreshToken,
-		token.TokenType, token.Expiry,
+	err = DB.QueryRow(query,
+		token.OrganizationID, accessToken, refreshToken,
+		token.TokenType, utc(token.Expiry),
 	).Scan(&token.ID, &token.CreatedAt, &token.UpdatedAt)
 	
 	return err
 }
 
+// Columns the encrypted tokens are bound to.
+const (
+	accessTokenColumn  = "google_calendar_tokens.access_token"
+	refreshTokenColumn = "google_calendar_tokens.refresh_token"
+)
+
+// encryptTokens encrypts an access token and an optional refresh token for storage.
+func encryptTokens(orgID int, accessToken string, refreshToken *string) (string, *string, error) {
+	access, err := secrets.Encrypt(accessToken, orgID, accessTokenColumn)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to encrypt access token: %w", err)
+	}
+	if refreshToken == nil {
+		return access, nil, nil
+	}
+	refresh, err := secrets.Encrypt(*refreshToken, orgID, refreshTokenColumn)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to encrypt refresh token: %w", err)
+	}
+	return access, &refresh, nil
+}
+
 func GetGoogleCalendarToken(orgID int) (*models.GoogleCalendarToken, error) {
 	query := `
 		SELECT id, organization_id, access_token, refresh_token, token_type, expiry, 
-		       created_at, updated_at
+		       broken_at, broken_reason, created_at, updated_at
 		FROM google_calendar_tokens WHERE organization_id = $1`
 	
 	token := &models.GoogleCalendarToken{}
-	var refreshToken, tokenType sql.NullString
-	var expiry sql.NullTime
+	var refreshToken, tokenType, brokenReason sql.NullString
+	var expiry, brokenAt sql.NullTime
 	
 	err := DB.QueryRow(query, orgID).Scan(
 		&token.ID, &token.OrganizationID, &token.AccessToken, &refreshToken,
-		&tokenType, &expiry, &token.CreatedAt, &token.UpdatedAt,
+		&tokenType, &expiry, &brokenAt, &brokenReason, &token.CreatedAt, &token.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -48,8 +80,15 @@ func GetGoogleCalendarToken(orgID int) (*models.GoogleCalendarToken, error) {
 		return nil, err
 	}
 
+	if token.AccessToken, err = secrets.Decrypt(token.AccessToken, orgID, accessTokenColumn); err != nil {
+		return nil, fmt.Errorf("failed to decrypt access token: %w", err)
+	}
 	if refreshToken.Valid {
-		token.RefreshToken = &refreshToken.String
+		refresh, err := secrets.Decrypt(refreshToken.String, orgID, refreshTokenColumn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt refresh token: %w", err)
+		}
+		token.RefreshToken = &refresh
 	}
 	if tokenType.Valid {
 		token.TokenType = &tokenType.String
@@ -57,16 +96,185 @@ func GetGoogleCalendarToken(orgID int) (*models.GoogleCalendarToken, error) {
 	if expiry.Valid {
 		token.Expiry = &expiry.Time
 	}
+	if brokenAt.Valid {
+		token.BrokenAt = &brokenAt.Time
+	}
+	if brokenReason.Valid {
+		token.BrokenReason = &brokenReason.String
+	}
 
 	return token, nil
 }
 
+// UpdateGoogleCalendarToken stores a refreshed token. An empty refreshToken
+// keeps the stored one, as Google usually returns none on refresh.
 func UpdateGoogleCalendarToken(orgID int, accessToken, refreshToken string, expiry *time.Time) error {
+	var refresh *string
+	if refreshToken != "" {
+		refresh = &refreshToken
+	}
+	access, refresh, err := encryptTokens(orgID, accessToken, refresh)
+	if err != nil {
+		return err
+	}
+
 	query := `
 		UPDATE google_calendar_tokens 
-		SET access_token = $1, refresh_token = $2, expiry = $3, updated_at = $4
+		SET access_token = $1, refresh_token = COALESCE($2, refresh_token), expiry = $3, updated_at = $4
 		WHERE organization_id = $5`
 	
-	_, err := DB.Exec(query, accessToken, refreshToken, expiry, time.Now(), orgID)
+	_, err = DB.Exec(query, access, refresh, utc(expiry), time.Now(), orgID)
+	return err
+}
+
+// MarkGoogleCalendarTokenBroken records that Google rejected the refresh token.
+func MarkGoogleCalendarTokenBroken(orgID int, reason string) error {
+	query := `
+		UPDATE google_calendar_tokens SET broken_at = $1, broken_reason = $2, updated_at = $1
+		WHERE organization_id = $3`
+	_, err := DB.Exec(query, time.Now(), reason, orgID)
+	return err
+}
+
+// RewrapGoogleCalendarTokens encrypts tokens still stored as plain text or
+// under a retired master key with the active key. It returns the number of
+// organizations updated.
+func RewrapGoogleCalendarTokens() (int, error) {
+	rows, err := DB.Query(`SELECT organization_id, access_token, refresh_token FROM google_calendar_tokens`)
+	if err != nil {
+		return 0, err
+	}
+
+	type stored struct {
+		orgID   int
+		access  string
+		refresh sql.NullString
+	}
+	var stale []stored
+	for rows.Next() {
+		var t stored
+		if err := rows.Scan(&t.orgID, &t.access, &t.refresh); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if secrets.NeedsRewrap(t.access) || (t.refresh.Valid && secrets.NeedsRewrap(t.refresh.String)) {
+			stale = append(stale, t)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for _, t := range stale {
+		access, err := secrets.Rewrap(t.access, t.orgID, accessTokenColumn)
+		if err != nil {
+			return updated, fmt.Errorf("organization %d: %w", t.orgID, err)
+		}
+		var refresh *string
+		if t.refresh.Valid {
+			r, err := secrets.Rewrap(t.refresh.String, t.orgID, refreshTokenColumn)
+			if err != nil {
+				return updated, fmt.Errorf("organization %d: %w", t.orgID, err)
+			}
+			refresh = &r
+		}
+
+		// Skip tokens refreshed since they were read; they are stored with the active key
+		res, err := DB.Exec(`
+			UPDATE google_calendar_tokens SET access_token = $1, refresh_token = $2
+			WHERE organization_id = $3 AND access_token = $4 AND refresh_token IS NOT DISTINCT FROM $5`,
+			access, refresh, t.orgID, t.access, t.refresh)
+		if err != nil {
+			return updated, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			updated++
+		}
+	}
+
+	return updated, nil
+}
+
+// GetCalendarOrganizationIDs returns the organizations with a working
+// connection to their selected calendar provider.
+func GetCalendarOrganizationIDs() ([]int, error) {
+	query := `
+		SELECT o.id FROM organizations o
+		WHERE (COALESCE(o.calendar_provider, 'google') = 'google' AND EXISTS (
+		           SELECT 1 FROM google_calendar_tokens g WHERE g.organization_id = o.id AND g.broken_at IS NULL))
+		   OR (o.calendar_provider = 'caldav' AND EXISTS (
+		           SELECT 1 FROM caldav_accounts c WHERE c.organization_id = o.id))
+		ORDER BY o.id`
+
+	rows, err := DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// GetCalendarSyncToken returns the stored sync token for the organization's
+// calendar. An empty token means a full sync is needed, also when the
+// organization switched to another calendar since.
+func GetCalendarSyncToken(orgID int, calendarID string) (string, error) {
+	var storedCalendarID string
+	var token sql.NullString
+
+	err := DB.QueryRow(`SELECT calendar_id, sync_token FROM calendar_sync_state WHERE organization_id = $1`, orgID).
+		Scan(&storedCalendarID, &token)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if storedCalendarID != calendarID {
+		return "", nil
+	}
+	return token.String, nil
+}
+
+func SaveCalendarSyncToken(orgID int, calendarID, token string) error {
+	query := `
+		INSERT INTO calendar_sync_state (organization_id, calendar_id, sync_token, synced_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+		ON CONFLICT (organization_id) DO UPDATE SET
+			calendar_id = EXCLUDED.calendar_id,
+			sync_token = EXCLUDED.sync_token,
+			synced_at = EXCLUDED.synced_at,
+			updated_at = CURRENT_TIMESTAMP`
+	_, err := DB.Exec(query, orgID, calendarID, token)
 	return err
 }
+
+// DeleteGoogleCalendarToken removes the organization's Google connection and
+// its sync position.
+func DeleteGoogleCalendarToken(orgID int) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM google_calendar_tokens WHERE organization_id = $1`, orgID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM calendar_sync_state WHERE organization_id = $1`, orgID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
 
 	_ "github.com/lib/pq"
 )
@@ -53,15 +55,24 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// RunMigrations applies every migrations/*.sql file in name order.
+// Migrations are written to be idempotent, so they are re-run on every start.
 func RunMigrations() error {
-	migrationSQL, err := os.ReadFile("migrations/001_init.sql")
+	files, err := filepath.Glob("migrations/*.sql")
 	if err != nil {
-		return fmt.Errorf("failed to read migration file: %w", err)
+		return fmt.Errorf("failed to list migration files: %w", err)
 	}
+	sort.Strings(files)
 
-	_, err = DB.Exec(string(migrationSQL))
-	if err != nil {
-		return fmt.Errorf("failed to run migration: %w", err)
+	for _, file := range files {
+		migrationSQL, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read migration file %s: %w", file, err)
+		}
+
+		if _, err := DB.Exec(string(migrationSQL)); err != nil {
+			return fmt.Errorf("failed to run migration %s: %w", file, err)
+		}
 	}
 
 	log.Println("Migrations completed successfully")
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"database/sql"
+	"helpdesk/internal/models"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const digestSettingsColumns = `user_id, frequency, send_time, weekday, sections, last_sent_at, updated_at`
+
+func scanDigestSettings(row rowScanner) (*models.DigestSettings, error) {
+	s := &models.DigestSettings{}
+	var lastSent sql.NullTime
+
+	err := row.Scan(&s.UserID, &s.Frequency, &s.SendTime, &s.Weekday, pq.Array(&s.Sections),
+		&lastSent, &s.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if lastSent.Valid {
+		s.LastSentAt = &lastSent.Time
+	}
+	return s, nil
+}
+
+// GetDigestSettings returns the user's digest settings, nil if they never
+// chose any.
+func GetDigestSettings(userID int) (*models.DigestSettings, error) {
+	query := `SELECT ` + digestSettingsColumns + ` FROM digest_settings WHERE user_id = $1`
+	s, err := scanDigestSettings(DB.QueryRow(query, userID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return s, err
+}
+
+// SaveDigestSettings stores the user's digest settings, keeping when the last
+// digest was sent.
+func SaveDigestSettings(s *models.DigestSettings) error {
+	query := `
+		INSERT INTO digest_settings (user_id, frequency, send_time, weekday, sections)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id) DO UPDATE
+		SET frequency = EXCLUDED.frequency, send_time = EXCLUDED.send_time,
+		    weekday = EXCLUDED.weekday, sections = EXCLUDED.sections, updated_at = CURRENT_TIMESTAMP
+		RETURNING updated_at`
+	return DB.QueryRow(query, s.UserID, s.Frequency, s.SendTime, s.Weekday, pq.Array(s.Sections)).
+		Scan(&s.UpdatedAt)
+}
+
+// GetEnabledDigestSettings returns the digest settings of active staff
+// members who can be reached in Telegram and have not turned digests off.
+func GetEnabledDigestSettings() ([]*models.DigestSettings, error) {
+	query := `
+		SELECT ` + digestSettingsColumns + `
+		FROM digest_settings
+		WHERE frequency <> 'off'
+		  AND user_id IN (SELECT id FROM users
+		                  WHERE is_active AND role <> 'customer' AND telegram_id IS NOT NULL)
+		ORDER BY user_id`
+
+	rows, err := DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*models.DigestSettings
+	for rows.Next() {
+		s, err := scanDigestSettings(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
+
+func MarkDigestSent(userID int, at time.Time) error {
+	query := `UPDATE digest_settings SET last_sent_at = $1 WHERE user_id = $2`
+	_, err := DB.Exec(query, at.UTC(), userID)
+	return err
+}
+
+// GetActiveTicketsByOrganization returns the organization's open and in
+// progress tickets, oldest first.
+func GetActiveTicketsByOrganization(orgID int) ([]*models.Ticket, error) {
+	query := `
+		SELECT ` + ticketColumns + `
+		FROM tickets t
+		WHERE t.organization_id = $1 AND ` + inStages("t", "$2") + `
+		ORDER BY t.created_at ASC`
+	return queryTickets(query, orgID, pq.Array([]string{"open", "in_progress"}))
+}
+
+// GetTicketsAwaitingCustomer returns the organization's open and in progress
+// tickets whose last message, system messages aside, was written by an agent.
+// Tickets waiting longest come first.
+func GetTicketsAwaitingCustomer(orgID int) ([]*models.Ticket, error) {
+	query := `
+		SELECT ` + ticketColumns + `
+		FROM tickets t
+		WHERE t.organization_id = $1 AND ` + inStages("t", "$2") + `
+		  AND (SELECT COALESCE(m.is_from_customer, FALSE) FROM messages m
+		       WHERE m.ticket_id = t.id AND NOT COALESCE(m.is_system, FALSE)
+		       ORDER BY m.created_at DESC, m.id DESC LIMIT 1) = FALSE
+		ORDER BY t.updated_at ASC`
+	return queryTickets(query, orgID, pq.Array([]string{"open", "in_progress"}))
+}
+
+// CountTicketsResolvedBetween counts the organization's tickets resolved or
+// closed in [from, to) and not reopened since.
+func CountTicketsResolvedBetween(orgID int, from, to time.Time) (int, error) {
+	query := `SELECT COUNT(*) FROM tickets WHERE organization_id = $1 AND resolved_at >= $2 AND resolved_at < $3`
+	var n int
+	err := DB.QueryRow(query, orgID, from.UTC(), to.UTC()).Scan(&n)
+	return n, err
+}
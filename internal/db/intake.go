@@ -0,0 +1,175 @@
+package db
+
+import (
+	"database/sql"
+	"helpdesk/internal/models"
+	"strings"
+)
+
+func GetTicketCategories(orgID int) ([]*models.TicketCategory, error) {
+	query := `
+		SELECT id, organization_id, name, sort_order, created_at
+		FROM ticket_categories WHERE organization_id = $1
+		ORDER BY sort_order ASC, id ASC`
+
+	rows, err := DB.Query(query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []*models.TicketCategory
+	for rows.Next() {
+		c := &models.TicketCategory{}
+		if err := rows.Scan(&c.ID, &c.OrganizationID, &c.Name, &c.SortOrder, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+
+	return categories, rows.Err()
+}
+
+// GetTicketCategory returns the organization's category, nil if there is none with the ID.
+func GetTicketCategory(orgID, id int) (*models.TicketCategory, error) {
+	query := `
+		SELECT id, organization_id, name, sort_order, created_at
+		FROM ticket_categories WHERE organization_id = $1 AND id = $2`
+
+	c := &models.TicketCategory{}
+	err := DB.QueryRow(query, orgID, id).Scan(&c.ID, &c.OrganizationID, &c.Name, &c.SortOrder, &c.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func CreateTicketCategory(category *models.TicketCategory) error {
+	query := `
+		INSERT INTO ticket_categories (organization_id, name, sort_order)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`
+
+	return DB.QueryRow(query, category.OrganizationID, category.Name, category.SortOrder).
+		Scan(&category.ID, &category.CreatedAt)
+}
+
+func DeleteTicketCategory(orgID, id int) error {
+	query := `DELETE FROM ticket_categories WHERE organization_id = $1 AND id = $2`
+	_, err := DB.Exec(query, orgID, id)
+	return err
+}
+
+// GetIntakeQuestions returns the questions of the organization's categories in asking order.
+func GetIntakeQuestions(orgID int) ([]*models.IntakeQuestion, error) {
+	query := `
+		SELECT q.id, q.category_id, q.label, q.prompt, q.kind, q.options, q.required, q.sort_order, q.created_at
+		FROM intake_questions q
+		JOIN ticket_categories c ON c.id = q.category_id
+		WHERE c.organization_id = $1
+		ORDER BY q.category_id, q.sort_order ASC, q.id ASC`
+
+	rows, err := DB.Query(query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var questions []*models.IntakeQuestion
+	for rows.Next() {
+		q := &models.IntakeQuestion{}
+		var options sql.NullString
+
+		err := rows.Scan(&q.ID, &q.CategoryID, &q.Label, &q.Prompt, &q.Kind, &options,
+			&q.Required, &q.SortOrder, &q.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range strings.Split(options.String, "\n") {
+			if o = strings.TrimSpace(o); o != "" {
+				q.Options = append(q.Options, o)
+			}
+		}
+
+		questions = append(questions, q)
+	}
+
+	return questions, rows.Err()
+}
+
+func CreateIntakeQuestion(q *models.IntakeQuestion) error {
+	query := `
+		INSERT INTO intake_questions (category_id, label, prompt, kind, options, required, sort_order)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`
+
+	var options *string
+	if len(q.Options) > 0 {
+		joined := strings.Join(q.Options, "\n")
+		options = &joined
+	}
+
+	return DB.QueryRow(query, q.CategoryID, q.Label, q.Prompt, q.Kind, options, q.Required, q.SortOrder).
+		Scan(&q.ID, &q.CreatedAt)
+}
+
+// DeleteIntakeQuestion removes a question of one of the organization's categories.
+func DeleteIntakeQuestion(orgID, id int) error {
+	query := `
+		DELETE FROM intake_questions
+		WHERE id = $2 AND category_id IN (SELECT id FROM ticket_categories WHERE organization_id = $1)`
+	_, err := DB.Exec(query, orgID, id)
+	return err
+}
+
+// SaveTicketFields stores the intake answers of a ticket.
+func SaveTicketFields(ticketID int, fields []*models.TicketField) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i, f := range fields {
+		f.TicketID = ticketID
+		f.SortOrder = i
+		err := tx.QueryRow(`
+			INSERT INTO ticket_fields (ticket_id, label, value, sort_order)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id`,
+			ticketID, f.Label, f.Value, f.SortOrder,
+		).Scan(&f.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func GetTicketFields(ticketID int) ([]*models.TicketField, error) {
+	query := `
+		SELECT id, ticket_id, label, value, sort_order
+		FROM ticket_fields WHERE ticket_id = $1
+		ORDER BY sort_order ASC`
+
+	rows, err := DB.Query(query, ticketID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fields []*models.TicketField
+	for rows.Next() {
+		f := &models.TicketField{}
+		if err := rows.Scan(&f.ID, &f.TicketID, &f.Label, &f.Value, &f.SortOrder); err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+
+	return fields, rows.Err()
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"helpdesk/internal/models"
+	"time"
+)
+
+// LockJob takes the session advisory lock key on a connection of its own and
+// returns that connection, nil if another session holds the lock. The lock
+// lasts until UnlockJob or until the connection is lost.
+func LockJob(ctx context.Context, key int64) (*sql.Conn, error) {
+	conn, err := DB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&locked); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !locked {
+		conn.Close()
+		return nil, nil
+	}
+	return conn, nil
+}
+
+// UnlockJob releases the lock taken by LockJob and closes its connection.
+func UnlockJob(conn *sql.Conn, key int64) error {
+	defer conn.Close()
+	_, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, key)
+	return err
+}
+
+func CreateJobRun(run *models.JobRun) error {
+	query := `
+		INSERT INTO job_runs (job_name, instance, status)
+		VALUES ($1, $2, 'running')
+		RETURNING id, status, started_at`
+	return DB.QueryRow(query, run.JobName, run.Instance).Scan(&run.ID, &run.Status, &run.StartedAt)
+}
+
+// FinishJobRun records the end of a run; a nil error means it succeeded.
+func FinishJobRun(id int, runErr error) error {
+	status := "succeeded"
+	var message *string
+	if runErr != nil {
+		status = "failed"
+		s := runErr.Error()
+		message = &s
+	}
+	query := `UPDATE job_runs SET status = $1, error = $2, finished_at = $3 WHERE id = $4`
+	_, err := DB.Exec(query, status, message, time.Now(), id)
+	return err
+}
+
+// FailUnfinishedJobRuns marks the job's runs still recorded as running as
+// failed, e.g. after their process died holding the job's lock.
+func FailUnfinishedJobRuns(name, reason string) error {
+	query := `UPDATE job_runs SET status = 'failed', error = $1, finished_at = $2 WHERE job_name = $3 AND status = 'running'`
+	_, err := DB.Exec(query, reason, time.Now(), name)
+	return err
+}
+
+// GetJobRuns returns the latest runs, of one job if name is not empty.
+func GetJobRuns(name string, limit int) ([]*models.JobRun, error) {
+	query := `
+		SELECT id, job_name, instance, status, error, started_at, finished_at
+		FROM job_runs
+		WHERE $1 = '' OR job_name = $1
+		ORDER BY started_at DESC, id DESC
+		LIMIT $2`
+
+	rows, err := DB.Query(query, name, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []*models.JobRun
+	for rows.Next() {
+		run := &models.JobRun{}
+		var message sql.NullString
+		var finishedAt sql.NullTime
+		if err := rows.Scan(&run.ID, &run.JobName, &run.Instance, &run.Status, &message, &run.StartedAt, &finishedAt); err != nil {
+			return nil, err
+		}
+		if message.Valid {
+			run.Error = &message.String
+		}
+		if finishedAt.Valid {
+			run.FinishedAt = &finishedAt.Time
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// DeleteJobRunsBefore removes the history of runs started before the time.
+func DeleteJobRunsBefore(before time.Time) (int64, error) {
+	result, err := DB.Exec(`DELETE FROM job_runs WHERE started_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,47 @@
+package db
+
+import "database/sql"
+
+// LinkTelegramMessage records that a bot message in a chat is about the ticket.
+func LinkTelegramMessage(chatID int64, messageID, ticketID int) error {
+	query := `
+		INSERT INTO telegram_message_links (chat_id, message_id, ticket_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (chat_id, message_id) DO UPDATE SET ticket_id = EXCLUDED.ticket_id`
+
+	_, err := DB.Exec(query, chatID, messageID, ticketID)
+	return err
+}
+
+// GetLinkedTicketID returns the ticket a bot message is about, 0 if none.
+func GetLinkedTicketID(chatID int64, messageID int) (int, error) {
+	var ticketID int
+	err := DB.QueryRow(`SELECT ticket_id FROM telegram_message_links WHERE chat_id = $1 AND message_id = $2`,
+		chatID, messageID).Scan(&ticketID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return ticketID, err
+}
+
+// SaveTicketTopic records the forum topic a ticket is discussed in.
+func SaveTicketTopic(ticketID int, chatID int64, threadID int) error {
+	query := `
+		INSERT INTO telegram_topics (ticket_id, chat_id, thread_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (ticket_id) DO UPDATE SET chat_id = EXCLUDED.chat_id, thread_id = EXCLUDED.thread_id`
+
+	_, err := DB.Exec(query, ticketID, chatID, threadID)
+	return err
+}
+
+// GetTicketTopic returns the ticket's forum topic in the chat. Thread 0 means
+// the ticket is posted to the chat without a topic.
+func GetTicketTopic(ticketID int, chatID int64) (threadID int, found bool, err error) {
+	err = DB.QueryRow(`SELECT thread_id FROM telegram_topics WHERE ticket_id = $1 AND chat_id = $2`,
+		ticketID, chatID).Scan(&threadID)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	return threadID, err == nil, err
+}
@@ -7,13 +7,13 @@ import (
 
 func CreateMessage(message *models.Message) error {
 	query := `
-		INSERT INTO messages (ticket_id, user_id, content, telegram_message_id, is_from_customer)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO messages (ticket_id, user_id, content, telegram_message_id, is_from_customer, is_system)
+		VALUES ($1, $2, $3, $4, $5, $6)
 		RETURNING id, created_at`
 	
 	err := DB.QueryRow(query,
 		message.TicketID, message.UserID, message.Content,
-		message.TelegramMessageID, message.IsFromCustomer,
+		message.TelegramMessageID, message.IsFromCustomer, message.IsSystem,
 	).Scan(&message.ID, &message.CreatedAt)
 	
 	return err
@@ -21,7 +21,8 @@ func CreateMessage(message *models.Message) error {
 
 func GetMessagesByTicket(ticketID int) ([]*models.Message, error) {
 	query := `
-		SELECT id, ticket_id, user_id, content, telegram_message_id, is_from_customer, created_at
+		SELECT id, ticket_id, user_id, content, telegram_message_id, is_from_customer,
+		       COALESCE(is_system, FALSE), created_at
 		FROM messages WHERE ticket_id = $1
 		ORDER BY created_at ASC`
 	
@@ -38,7 +39,7 @@ func GetMessagesByTicket(ticketID int) ([]*models.Message, error) {
 		
 		err := rows.Scan(
 			&message.ID, &message.TicketID, &userID, &message.Content,
-			&telegramMessageID, &message.IsFromCustomer, &message.CreatedAt,
+			&telegramMessageID, &message.IsFromCustomer, &message.IsSystem, &message.CreatedAt,
 		)
 		if err != nil {
 			return nil, err
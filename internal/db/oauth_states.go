@@ -0,0 +1,30 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+func CreateOAuthState(nonce string, expiresAt time.Time) error {
+	_, err := DB.Exec(`INSERT INTO oauth_states (nonce, expires_at) VALUES ($1, $2)`, nonce, expiresAt.UTC())
+	return err
+}
+
+// UseOAuthState deletes the nonce and reports whether it was issued and had
+// not expired by now.
+func UseOAuthState(nonce string, now time.Time) (bool, error) {
+	var expiresAt time.Time
+	err := DB.QueryRow(`DELETE FROM oauth_states WHERE nonce = $1 RETURNING expires_at`, nonce).Scan(&expiresAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return now.UTC().Before(expiresAt), nil
+}
+
+func DeleteExpiredOAuthStates(now time.Time) error {
+	_, err := DB.Exec(`DELETE FROM oauth_states WHERE expires_at < $1`, now.UTC())
+	return err
+}
@@ -3,19 +3,21 @@ package db
 import (
 	"database/sql"
 	"helpdesk/internal/models"
+	"time"
 )
 
 func GetOrganizationByID(id int) (*models.Organization, error) {
 	query := `
-		SELECT id, name, telegram_chat_id, google_calendar_id, created_at, updated_at
+		SELECT id, name, telegram_chat_id, google_calendar_id, calendar_provider, timezone, language,
+		       csat_auto_close, auto_close_days, created_at, updated_at
 		FROM organizations WHERE id = $1`
 	
 	org := &models.Organization{}
 	var telegramChatID sql.NullInt64
-	var googleCalendarID sql.NullString
+	var googleCalendarID, calendarProvider, timezone sql.NullString
 	
 	err := DB.QueryRow(query, id).Scan(
-		&org.ID, &org.Name, &telegramChatID, &googleCalendarID,
+		&org.ID, &org.Name, &telegramChatID, &googleCalendarID, &calendarProvider, &timezone, &org.Language, &org.CSATAutoClose, &org.AutoCloseDays,
 		&org.CreatedAt, &org.UpdatedAt,
 	)
 	if err != nil {
@@ -28,13 +30,22 @@ func GetOrganizationByID(id int) (*models.Organization, error) {
 	if googleCalendarID.Valid {
 		org.GoogleCalendarID = &googleCalendarID.String
 	}
+	org.CalendarProvider = "google"
+	if calendarProvider.Valid && calendarProvider.String != "" {
+		org.CalendarProvider = calendarProvider.String
+	}
+	org.Timezone = "UTC"
+	if timezone.Valid && timezone.String != "" {
+		org.Timezone = timezone.String
+	}
 
 	return org, nil
 }
 
 func GetAllOrganizations() ([]*models.Organization, error) {
 	query := `
-		SELECT id, name, telegram_chat_id, google_calendar_id, created_at, updated_at
+		SELECT id, name, telegram_chat_id, google_calendar_id, calendar_provider, timezone, language,
+		       csat_auto_close, auto_close_days, created_at, updated_at
 		FROM organizations ORDER BY created_at DESC`
 	
 	rows, err := DB.Query(query)
@@ -47,10 +58,10 @@ func GetAllOrganizations() ([]*models.Organization, error) {
 	for rows.Next() {
 		org := &models.Organization{}
 		var telegramChatID sql.NullInt64
-		var googleCalendarID sql.NullString
+		var googleCalendarID, calendarProvider, timezone sql.NullString
 		
 		err := rows.Scan(
-			&org.ID, &org.Name, &telegramChatID, &googleCalendarID,
+			&org.ID, &org.Name, &telegramChatID, &googleCalendarID, &calendarProvider, &timezone, &org.Language, &org.CSATAutoClose, &org.AutoCloseDays,
 			&org.CreatedAt, &org.UpdatedAt,
 		)
 		if err != nil {
@@ -63,9 +74,72 @@ func GetAllOrganizations() ([]*models.Organization, error) {
 		if googleCalendarID.Valid {
 			org.GoogleCalendarID = &googleCalendarID.String
 		}
+		org.CalendarProvider = "google"
+		if calendarProvider.Valid && calendarProvider.String != "" {
+			org.CalendarProvider = calendarProvider.String
+		}
+		org.Timezone = "UTC"
+		if timezone.Valid && timezone.String != "" {
+			org.Timezone = timezone.String
+		}
 
 		orgs = append(orgs, org)
 	}
 
 	return orgs, rows.Err()
 }
+
+func UpdateOrganizationTimezone(id int, timezone string) error {
+	query := `UPDATE organizations SET timezone = $1, updated_at = $2 WHERE id = $3`
+	_, err := DB.Exec(query, timezone, time.Now(), id)
+	return err
+}
+
+// UpdateOrganizationCalendarID sets the Google calendar events go to; nil means the primary calendar.
+func UpdateOrganizationCalendarID(id int, calendarID *string) error {
+	query := `UPDATE organizations SET google_calendar_id = $1, updated_at = $2 WHERE id = $3`
+	_, err := DB.Exec(query, calendarID, time.Now(), id)
+	return err
+}
+
+func UpdateOrganizationCalendarProvider(id int, provider string) error {
+	query := `UPDATE organizations SET calendar_provider = $1, updated_at = $2 WHERE id = $3`
+	_, err := DB.Exec(query, provider, time.Now(), id)
+	return err
+}
+
+// UpdateOrganizationTelegramChat sets the operators' Telegram group; nil disconnects it.
+func UpdateOrganizationTelegramChat(id int, chatID *int64) error {
+	query := `UPDATE organizations SET telegram_chat_id = $1, updated_at = $2 WHERE id = $3`
+	_, err := DB.Exec(query, chatID, time.Now(), id)
+	return err
+}
+
+// GetOrganizationIDByTelegramChat returns the organization whose operators'
+// group is the chat, 0 if none.
+func GetOrganizationIDByTelegramChat(chatID int64) (int, error) {
+	var id int
+	err := DB.QueryRow(`SELECT id FROM organizations WHERE telegram_chat_id = $1`, chatID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+func UpdateOrganizationLanguage(id int, language string) error {
+	query := `UPDATE organizations SET language = $1, updated_at = $2 WHERE id = $3`
+	_, err := DB.Exec(query, language, time.Now(), id)
+	return err
+}
+
+func UpdateOrganizationCSATAutoClose(id int, autoClose bool) error {
+	query := `UPDATE organizations SET csat_auto_close = $1, updated_at = $2 WHERE id = $3`
+	_, err := DB.Exec(query, autoClose, time.Now(), id)
+	return err
+}
+
+func UpdateOrganizationAutoCloseDays(id int, days int) error {
+	query := `UPDATE organizations SET auto_close_days = $1, updated_at = $2 WHERE id = $3`
+	_, err := DB.Exec(query, days, time.Now(), id)
+	return err
+}
@@ -0,0 +1,178 @@
+package db
+
+import (
+	"database/sql"
+	"helpdesk/internal/models"
+	"sort"
+	"time"
+)
+
+// SaveTicketRating stores the rating of a ticket, replacing the score and
+// agent of an earlier one but keeping its comment.
+func SaveTicketRating(rating *models.TicketRating) error {
+	query := `
+		INSERT INTO ticket_ratings (ticket_id, organization_id, customer_id, agent_id, score)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (ticket_id) DO UPDATE
+		SET agent_id = EXCLUDED.agent_id, score = EXCLUDED.score, updated_at = CURRENT_TIMESTAMP
+		RETURNING created_at, updated_at`
+	return DB.QueryRow(query, rating.TicketID, rating.OrganizationID, rating.CustomerID, rating.AgentID, rating.Score).
+		Scan(&rating.CreatedAt, &rating.UpdatedAt)
+}
+
+func SetTicketRatingComment(ticketID int, comment string) error {
+	query := `UPDATE ticket_ratings SET comment = $1, updated_at = $2 WHERE ticket_id = $3`
+	_, err := DB.Exec(query, comment, time.Now(), ticketID)
+	return err
+}
+
+const ratingColumns = `ticket_id, organization_id, customer_id, agent_id, score, comment, created_at, updated_at`
+
+func scanTicketRating(row rowScanner) (*models.TicketRating, error) {
+	rating := &models.TicketRating{}
+	var customerID, agentID sql.NullInt64
+	var comment sql.NullString
+
+	err := row.Scan(&rating.TicketID, &rating.OrganizationID, &customerID, &agentID,
+		&rating.Score, &comment, &rating.CreatedAt, &rating.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if customerID.Valid {
+		id := int(customerID.Int64)
+		rating.CustomerID = &id
+	}
+	if agentID.Valid {
+		id := int(agentID.Int64)
+		rating.AgentID = &id
+	}
+	if comment.Valid {
+		rating.Comment = &comment.String
+	}
+	return rating, nil
+}
+
+// GetTicketRating returns the rating of a ticket, nil if it has none.
+func GetTicketRating(ticketID int) (*models.TicketRating, error) {
+	query := `SELECT ` + ratingColumns + ` FROM ticket_ratings WHERE ticket_id = $1`
+	rating, err := scanTicketRating(DB.QueryRow(query, ticketID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return rating, err
+}
+
+// GetRatingComments returns the organization's ratings with a comment given
+// since the time, newest first.
+func GetRatingComments(orgID int, since time.Time, limit int) ([]*models.TicketRating, error) {
+	query := `
+		SELECT ` + ratingColumns + `
+		FROM ticket_ratings
+		WHERE organization_id = $1 AND updated_at >= $2 AND COALESCE(comment, '') <> ''
+		ORDER BY updated_at DESC
+		LIMIT $3`
+
+	rows, err := DB.Query(query, orgID, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ratings []*models.TicketRating
+	for rows.Next() {
+		rating, err := scanTicketRating(rows)
+		if err != nil {
+			return nil, err
+		}
+		ratings = append(ratings, rating)
+	}
+	return ratings, rows.Err()
+}
+
+// addScores adds n ratings of the score to the stats.
+func addScores(stats *models.CSATStats, score, n int) {
+	if score < 1 || score > 5 {
+		return
+	}
+	total := stats.Average*float64(stats.Count) + float64(score*n)
+	stats.Scores[score-1] += n
+	stats.Count += n
+	stats.Average = total / float64(stats.Count)
+}
+
+// GetCSATStats aggregates the organization's ratings given since the time.
+func GetCSATStats(orgID int, since time.Time) (*models.CSATStats, error) {
+	query := `
+		SELECT score, COUNT(*) FROM ticket_ratings
+		WHERE organization_id = $1 AND updated_at >= $2
+		GROUP BY score`
+
+	rows, err := DB.Query(query, orgID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := &models.CSATStats{}
+	for rows.Next() {
+		var score, n int
+		if err := rows.Scan(&score, &n); err != nil {
+			return nil, err
+		}
+		addScores(stats, score, n)
+	}
+	return stats, rows.Err()
+}
+
+// GetAgentCSAT aggregates the organization's ratings given since the time per
+// agent, best average first.
+func GetAgentCSAT(orgID int, since time.Time) ([]*models.AgentCSAT, error) {
+	query := `
+		SELECT r.agent_id, COALESCE(NULLIF(u.full_name, ''), u.email, u.username, ''), r.score, COUNT(*)
+		FROM ticket_ratings r
+		LEFT JOIN users u ON u.id = r.agent_id
+		WHERE r.organization_id = $1 AND r.updated_at >= $2
+		GROUP BY r.agent_id, u.full_name, u.email, u.username, r.score`
+
+	rows, err := DB.Query(query, orgID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var agents []*models.AgentCSAT
+	byID := make(map[int64]*models.AgentCSAT)
+	for rows.Next() {
+		var agentID sql.NullInt64
+		var name string
+		var score, n int
+		if err := rows.Scan(&agentID, &name, &score, &n); err != nil {
+			return nil, err
+		}
+
+		// Ratings without an agent are gathered under ID 0
+		agent, ok := byID[agentID.Int64]
+		if !ok {
+			agent = &models.AgentCSAT{Name: name}
+			if agentID.Valid {
+				id := int(agentID.Int64)
+				agent.AgentID = &id
+			}
+			byID[agentID.Int64] = agent
+			agents = append(agents, agent)
+		}
+		addScores(&agent.CSATStats, score, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(agents, func(i, j int) bool {
+		if agents[i].Average != agents[j].Average {
+			return agents[i].Average > agents[j].Average
+		}
+		return agents[i].Count > agents[j].Count
+	})
+	return agents, nil
+}
@@ -0,0 +1,193 @@
+package db
+
+import (
+	"database/sql"
+	"helpdesk/internal/models"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func GetSLAPolicies(orgID int) ([]*models.SLAPolicy, error) {
+	query := `
+		SELECT id, organization_id, priority, first_response_minutes, resolution_minutes,
+		       business_hours, created_at, updated_at
+		FROM sla_policies WHERE organization_id = $1
+		ORDER BY ` + priorityOrder
+
+	rows, err := DB.Query(query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var policies []*models.SLAPolicy
+	for rows.Next() {
+		policy, err := scanSLAPolicy(rows)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+
+	return policies, rows.Err()
+}
+
+func GetSLAPolicy(orgID int, priority string) (*models.SLAPolicy, error) {
+	query := `
+		SELECT id, organization_id, priority, first_response_minutes, resolution_minutes,
+		       business_hours, created_at, updated_at
+		FROM sla_policies WHERE organization_id = $1 AND priority = $2`
+
+	policy, err := scanSLAPolicy(DB.QueryRow(query, orgID, priority))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return policy, err
+}
+
+func scanSLAPolicy(row rowScanner) (*models.SLAPolicy, error) {
+	policy := &models.SLAPolicy{}
+	var firstResponse, resolution sql.NullInt64
+	var businessHours sql.NullBool
+
+	err := row.Scan(
+		&policy.ID, &policy.OrganizationID, &policy.Priority, &firstResponse, &resolution,
+		&businessHours, &policy.CreatedAt, &policy.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if firstResponse.Valid {
+		m := int(firstResponse.Int64)
+		policy.FirstResponseMinutes = &m
+	}
+	if resolution.Valid {
+		m := int(resolution.Int64)
+		policy.ResolutionMinutes = &m
+	}
+	policy.BusinessHours = businessHours.Valid && businessHours.Bool
+
+	return policy, nil
+}
+
+func SaveSLAPolicy(policy *models.SLAPolicy) error {
+	query := `
+		INSERT INTO sla_policies (organization_id, priority, first_response_minutes,
+		                          resolution_minutes, business_hours)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (organization_id, priority) DO UPDATE SET
+			first_response_minutes = EXCLUDED.first_response_minutes,
+			resolution_minutes = EXCLUDED.resolution_minutes,
+			business_hours = EXCLUDED.business_hours,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING id, created_at, updated_at`
+
+	err := DB.QueryRow(query,
+		policy.OrganizationID, policy.Priority, policy.FirstResponseMinutes,
+		policy.ResolutionMinutes, policy.BusinessHours,
+	).Scan(&policy.ID, &policy.CreatedAt, &policy.UpdatedAt)
+
+	return err
+}
+
+// UpdateTicketSLADueDates stores new SLA due dates and re-arms escalation
+// warnings and breach notices.
+func UpdateTicketSLADueDates(ticketID int, firstResponseDue, resolutionDue *time.Time) error {
+	query := `
+		UPDATE tickets
+		SET first_response_due_at = $1, resolution_due_at = $2,
+		    first_response_escalated_at = NULL, resolution_escalated_at = NULL,
+		    first_response_breach_notified_at = NULL, resolution_breach_notified_at = NULL
+		WHERE id = $3`
+	_, err := DB.Exec(query, utc(firstResponseDue), utc(resolutionDue), ticketID)
+	return err
+}
+
+// utc converts an optional time to UTC, as TIMESTAMP columns keep no zone.
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+func SetTicketFirstResponse(ticketID int, at time.Time) error {
+	query := `UPDATE tickets SET first_responded_at = $1 WHERE id = $2 AND first_responded_at IS NULL`
+	_, err := DB.Exec(query, at.UTC(), ticketID)
+	return err
+}
+
+// SetTicketResolved stores when the ticket was resolved. A nil time clears it
+// after the ticket is reopened, together with the resolution warning and
+// breach notice so they are sent again for the new run of the timer.
+func SetTicketResolved(ticketID int, at *time.Time) error {
+	query := `UPDATE tickets SET resolved_at = $1 WHERE id = $2`
+	if at == nil {
+		query = `
+			UPDATE tickets
+			SET resolved_at = $1, resolution_escalated_at = NULL, resolution_breach_notified_at = NULL
+			WHERE id = $2`
+	}
+	_, err := DB.Exec(query, utc(at), ticketID)
+	return err
+}
+
+// GetTicketsWithSLADue returns unresolved tickets with a running first response
+// or resolution timer that either expired before now without a breach notice,
+// or expires before warnUntil without a warning.
+func GetTicketsWithSLADue(now, warnUntil time.Time) ([]*models.Ticket, error) {
+	query := `
+		SELECT ` + ticketColumns + `
+		FROM tickets t
+		WHERE ` + inStages("t", "$3") + `
+		  AND ((first_responded_at IS NULL
+		        AND ((first_response_due_at < $1 AND first_response_breach_notified_at IS NULL)
+		          OR (first_response_due_at < $2 AND first_response_escalated_at IS NULL)))
+		    OR (resolved_at IS NULL
+		        AND ((resolution_due_at < $1 AND resolution_breach_notified_at IS NULL)
+		          OR (resolution_due_at < $2 AND resolution_escalated_at IS NULL))))
+		ORDER BY LEAST(first_response_due_at, resolution_due_at) ASC`
+	return queryTickets(query, now.UTC(), warnUntil.UTC(), pq.Array([]string{"open", "in_progress"}))
+}
+
+// GetTicketsToAutoClose returns tickets resolved longer ago than their
+// organization's auto_close_days with no customer message since.
+func GetTicketsToAutoClose(now time.Time) ([]*models.Ticket, error) {
+	query := `
+		SELECT ` + ticketColumns + `
+		FROM tickets t
+		WHERE ` + inStages("t", "$2") + `
+		  AND t.resolved_at + (SELECT o.auto_close_days FROM organizations o
+		                       WHERE o.id = t.organization_id AND o.auto_close_days > 0) * INTERVAL '1 day' < $1
+		  AND NOT EXISTS (SELECT 1 FROM messages m
+		                  WHERE m.ticket_id = t.id AND m.is_from_customer AND m.created_at > t.resolved_at)
+		ORDER BY t.resolved_at ASC`
+	return queryTickets(query, now.UTC(), pq.Array([]string{"resolved"}))
+}
+
+func MarkTicketFirstResponseEscalated(ticketID int) error {
+	query := `UPDATE tickets SET first_response_escalated_at = CURRENT_TIMESTAMP WHERE id = $1`
+	_, err := DB.Exec(query, ticketID)
+	return err
+}
+
+func MarkTicketResolutionEscalated(ticketID int) error {
+	query := `UPDATE tickets SET resolution_escalated_at = CURRENT_TIMESTAMP WHERE id = $1`
+	_, err := DB.Exec(query, ticketID)
+	return err
+}
+
+func MarkTicketFirstResponseBreachNotified(ticketID int) error {
+	query := `UPDATE tickets SET first_response_breach_notified_at = CURRENT_TIMESTAMP WHERE id = $1`
+	_, err := DB.Exec(query, ticketID)
+	return err
+}
+
+func MarkTicketResolutionBreachNotified(ticketID int) error {
+	query := `UPDATE tickets SET resolution_breach_notified_at = CURRENT_TIMESTAMP WHERE id = $1`
+	_, err := DB.Exec(query, ticketID)
+	return err
+}
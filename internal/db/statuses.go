@@ -0,0 +1,139 @@
+package db
+
+import (
+	"database/sql"
+	"helpdesk/internal/models"
+	"time"
+)
+
+func GetTicketStatuses(orgID int) ([]*models.TicketStatus, error) {
+	query := `
+		SELECT id, organization_id, code, label, base_status, sort_order, created_at
+		FROM ticket_statuses WHERE organization_id = $1
+		ORDER BY sort_order ASC, id ASC`
+
+	rows, err := DB.Query(query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var statuses []*models.TicketStatus
+	for rows.Next() {
+		status := &models.TicketStatus{}
+		var sortOrder sql.NullInt64
+
+		err := rows.Scan(
+			&status.ID, &status.OrganizationID, &status.Code, &status.Label,
+			&status.BaseStatus, &sortOrder, &status.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if sortOrder.Valid {
+			status.SortOrder = int(sortOrder.Int64)
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses, rows.Err()
+}
+
+func CreateTicketStatus(status *models.TicketStatus) error {
+	query := `
+		INSERT INTO ticket_statuses (organization_id, code, label, base_status, sort_order)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	err := DB.QueryRow(query,
+		status.OrganizationID, status.Code, status.Label, status.BaseStatus, status.SortOrder,
+	).Scan(&status.ID, &status.CreatedAt)
+
+	return err
+}
+
+func DeleteTicketStatus(orgID, id int) error {
+	query := `DELETE FROM ticket_statuses WHERE organization_id = $1 AND id = $2`
+	_, err := DB.Exec(query, orgID, id)
+	return err
+}
+
+// ChangeTicketStatus moves a ticket from one status to another and records the
+// change in ticket_status_history and the audit log in one transaction. It reports false, changing
+// nothing, if the ticket no longer has the status the change starts from.
+func ChangeTicketStatus(ticketID int, from, to string, event *models.AuditEvent) (bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`UPDATE tickets SET status = $1, updated_at = $2 WHERE id = $3 AND status = $4`,
+		to, time.Now(), ticketID, from)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO ticket_status_history (ticket_id, from_status, to_status, changed_by, channel)
+		VALUES ($1, $2, $3, $4, $5)`,
+		ticketID, from, to, event.ActorID, event.Channel)
+	if err != nil {
+		return false, err
+	}
+
+	err = tx.QueryRow(insertAuditEvent,
+		event.OrganizationID, event.TicketID, event.ActorID, event.Channel, event.Action,
+		event.Before, event.After,
+	).Scan(&event.ID, &event.CreatedAt)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+func GetTicketStatusHistory(ticketID int) ([]*models.TicketStatusChange, error) {
+	query := `
+		SELECT id, ticket_id, from_status, to_status, changed_by, channel, created_at
+		FROM ticket_status_history WHERE ticket_id = $1
+		ORDER BY created_at ASC, id ASC`
+
+	rows, err := DB.Query(query, ticketID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []*models.TicketStatusChange
+	for rows.Next() {
+		change := &models.TicketStatusChange{}
+		var fromStatus sql.NullString
+		var changedBy sql.NullInt64
+
+		err := rows.Scan(
+			&change.ID, &change.TicketID, &fromStatus, &change.ToStatus,
+			&changedBy, &change.Channel, &change.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if fromStatus.Valid {
+			change.FromStatus = &fromStatus.String
+		}
+		if changedBy.Valid {
+			uid := int(changedBy.Int64)
+			change.ChangedBy = &uid
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes, rows.Err()
+}
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"database/sql"
+	"helpdesk/internal/models"
+	"time"
+)
+
+const ticketEventColumns = `id, ticket_id, organization_id, google_event_id, kind, starts_at, ends_at,
+		       status, agent_id, created_by, created_at, updated_at`
+
+func scanTicketEvent(row rowScanner) (*models.TicketEvent, error) {
+	event := &models.TicketEvent{}
+	var externalEventID sql.NullString
+	var agentID, createdBy sql.NullInt64
+
+	err := row.Scan(
+		&event.ID, &event.TicketID, &event.OrganizationID, &externalEventID, &event.Kind,
+		&event.StartsAt, &event.EndsAt, &event.Status, &agentID, &createdBy,
+		&event.CreatedAt, &event.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if externalEventID.Valid {
+		event.ExternalEventID = &externalEventID.String
+	}
+	if agentID.Valid {
+		id := int(agentID.Int64)
+		event.AgentID = &id
+	}
+	if createdBy.Valid {
+		id := int(createdBy.Int64)
+		event.CreatedBy = &id
+	}
+
+	return event, nil
+}
+
+func queryTicketEvents(query string, args ...interface{}) ([]*models.TicketEvent, error) {
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*models.TicketEvent
+	for rows.Next() {
+		event, err := scanTicketEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// CreateTicketEvent stores an appointment. Appointment times are kept in UTC.
+func CreateTicketEvent(event *models.TicketEvent) error {
+	query := `
+		INSERT INTO ticket_events (ticket_id, organization_id, google_event_id, kind, starts_at,
+		                           ends_at, status, agent_id, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at, updated_at`
+
+	return DB.QueryRow(query,
+		event.TicketID, event.OrganizationID, event.ExternalEventID, event.Kind, event.StartsAt.UTC(),
+		event.EndsAt.UTC(), event.Status, event.AgentID, event.CreatedBy,
+	).Scan(&event.ID, &event.CreatedAt, &event.UpdatedAt)
+}
+
+func GetTicketEventByID(id int) (*models.TicketEvent, error) {
+	query := `SELECT ` + ticketEventColumns + ` FROM ticket_events WHERE id = $1`
+	return scanTicketEvent(DB.QueryRow(query, id))
+}
+
+func GetTicketEventsByTicket(ticketID int) ([]*models.TicketEvent, error) {
+	query := `SELECT ` + ticketEventColumns + ` FROM ticket_events WHERE ticket_id = $1 ORDER BY starts_at ASC`
+	return queryTicketEvents(query, ticketID)
+}
+
+// GetTicketEventByExternalID returns the appointment linked to a Google event, or
+// nil if the event was not created by the helpdesk.
+func GetTicketEventByExternalID(orgID int, externalEventID string) (*models.TicketEvent, error) {
+	query := `SELECT ` + ticketEventColumns + ` FROM ticket_events WHERE organization_id = $1 AND google_event_id = $2`
+
+	event, err := scanTicketEvent(DB.QueryRow(query, orgID, externalEventID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return event, err
+}
+
+func UpdateTicketEvent(event *models.TicketEvent) error {
+	query := `
+		UPDATE ticket_events SET starts_at = $1, ends_at = $2, status = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4`
+	_, err := DB.Exec(query, event.StartsAt.UTC(), event.EndsAt.UTC(), event.Status, event.ID)
+	return err
+}
+
+// GetTicketEventsForAgent returns appointments starting after since that the
+// agent attends or that belong to tickets assigned to them.
+func GetTicketEventsForAgent(agentID int, since time.Time) ([]*models.TicketEvent, error) {
+	query := `
+		SELECT ` + ticketEventColumns + ` FROM ticket_events
+		WHERE (agent_id = $1 OR ticket_id IN (SELECT id FROM tickets WHERE assigned_agent_id = $1))
+		  AND starts_at >= $2
+		ORDER BY starts_at ASC`
+	return queryTicketEvents(query, agentID, since.UTC())
+}
@@ -2,41 +2,51 @@ package db
 
 import (
 	"database/sql"
+	"fmt"
 	"helpdesk/internal/models"
 	"time"
+
+	"github.com/lib/pq"
 )
 
-func CreateTicket(ticket *models.Ticket) error {
-	query := `
-		INSERT INTO tickets (organization_id, customer_id, assigned_agent_id, title, 
-		                    description, status, priority, telegram_message_id, telegram_chat_id)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-		RETURNING id, created_at, updated_at`
+// priorityOrder sorts tickets from urgent to low in ORDER BY clauses.
+const priorityOrder = `CASE priority WHEN 'urgent' THEN 0 WHEN 'high' THEN 1 WHEN 'medium' THEN 2 WHEN 'low' THEN 3 ELSE 4 END`
 
-	err := DB.QueryRow(query,
-		ticket.OrganizationID, ticket.CustomerID, ticket.AssignedAgentID,
-		ticket.Title, ticket.Description, ticket.Status, ticket.Priority,
-		ticket.TelegramMessageID, ticket.TelegramChatID,
-	).Scan(&ticket.ID, &ticket.CreatedAt, &ticket.UpdatedAt)
-
-	return err
+// inStages builds a condition matching tickets (aliased as alias) whose status,
+// built-in or custom, belongs to one of the lifecycle stages passed as the
+// text array parameter param.
+func inStages(alias, param string) string {
+	return fmt.Sprintf(`(%[1]s.status = ANY(%[2]s) OR %[1]s.status IN (
+		SELECT ts.code FROM ticket_statuses ts
+		WHERE ts.organization_id = %[1]s.organization_id AND ts.base_status = ANY(%[2]s)))`, alias, param)
 }
 
-func GetTicketByID(id int) (*models.Ticket, error) {
-	query := `
-		SELECT id, organization_id, customer_id, assigned_agent_id, title, description,
-		       status, priority, telegram_message_id, telegram_chat_id, created_at, updated_at
-		FROM tickets WHERE id = $1`
+// ticketColumns is the column list read by scanTicket.
+const ticketColumns = `id, organization_id, customer_id, assigned_agent_id, title, description,
+		       status, priority, telegram_message_id, telegram_chat_id, created_at, updated_at,
+		       first_response_due_at, resolution_due_at, first_responded_at, resolved_at, category_id,
+		       first_response_escalated_at, resolution_escalated_at,
+		       first_response_breach_notified_at, resolution_breach_notified_at`
 
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTicket(row rowScanner) (*models.Ticket, error) {
 	ticket := &models.Ticket{}
-	var customerID, assignedAgentID, telegramMessageID sql.NullInt64
+	var customerID, assignedAgentID, telegramMessageID, categoryID sql.NullInt64
 	var description sql.NullString
 	var telegramChatID sql.NullInt64
+	var firstResponseDue, resolutionDue, firstResponded, resolved sql.NullTime
+	var firstResponseWarned, resolutionWarned, firstResponseBreached, resolutionBreached sql.NullTime
 
-	err := DB.QueryRow(query, id).Scan(
+	err := row.Scan(
 		&ticket.ID, &ticket.OrganizationID, &customerID, &assignedAgentID,
 		&ticket.Title, &description, &ticket.Status, &ticket.Priority,
 		&telegramMessageID, &telegramChatID, &ticket.CreatedAt, &ticket.UpdatedAt,
+		&firstResponseDue, &resolutionDue, &firstResponded, &resolved, &categoryID,
+		&firstResponseWarned, &resolutionWarned, &firstResponseBreached, &resolutionBreached,
 	)
 	if err != nil {
 		return nil, err
@@ -60,75 +70,39 @@ func GetTicketByID(id int) (*models.Ticket, error) {
 	if telegramChatID.Valid {
 		ticket.TelegramChatID = &telegramChatID.Int64
 	}
-
-	return ticket, nil
-}
-
-func GetTicketByTelegramMessage(chatID int64, messageID int) (*models.Ticket, error) {
-	query := `
-		SELECT id, organization_id, customer_id, assigned_agent_id, title, description,
-		       status, priority, telegram_message_id, telegram_chat_id, created_at, updated_at
-		FROM tickets WHERE telegram_chat_id = $1 AND telegram_message_id = $2`
-
-	ticket := &models.Ticket{}
-	var customerID, assignedAgentID, telegramMessageID sql.NullInt64
-	var description sql.NullString
-	var telegramChatID sql.NullInt64
-
-	err := DB.QueryRow(query, chatID, messageID).Scan(
-		&ticket.ID, &ticket.OrganizationID, &customerID, &assignedAgentID,
-		&ticket.Title, &description, &ticket.Status, &ticket.Priority,
-		&telegramMessageID, &telegramChatID, &ticket.CreatedAt, &ticket.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, nil
+	if firstResponseDue.Valid {
+		ticket.FirstResponseDueAt = &firstResponseDue.Time
 	}
-	if err != nil {
-		return nil, err
+	if resolutionDue.Valid {
+		ticket.ResolutionDueAt = &resolutionDue.Time
 	}
-
-	if customerID.Valid {
-		cid := int(customerID.Int64)
-		ticket.CustomerID = &cid
+	if firstResponded.Valid {
+		ticket.FirstRespondedAt = &firstResponded.Time
 	}
-	if assignedAgentID.Valid {
-		aid := int(assignedAgentID.Int64)
-		ticket.AssignedAgentID = &aid
+	if resolved.Valid {
+		ticket.ResolvedAt = &resolved.Time
 	}
-	if description.Valid {
-		ticket.Description = &description.String
+	if categoryID.Valid {
+		id := int(categoryID.Int64)
+		ticket.CategoryID = &id
 	}
-	if telegramMessageID.Valid {
-		tmid := int(telegramMessageID.Int64)
-		ticket.TelegramMessageID = &tmid
+	if firstResponseWarned.Valid {
+		ticket.FirstResponseWarnedAt = &firstResponseWarned.Time
 	}
-	if telegramChatID.Valid {
-		ticket.TelegramChatID = &telegramChatID.Int64
+	if resolutionWarned.Valid {
+		ticket.ResolutionWarnedAt = &resolutionWarned.Time
+	}
+	if firstResponseBreached.Valid {
+		ticket.FirstResponseBreachNotifiedAt = &firstResponseBreached.Time
+	}
+	if resolutionBreached.Valid {
+		ticket.ResolutionBreachNotifiedAt = &resolutionBreached.Time
 	}
 
 	return ticket, nil
 }
 
-func GetTicketsByOrganization(orgID int, statusFilter string) ([]*models.Ticket, error) {
-	var query string
-	var args []interface{}
-
-	if statusFilter != "" && statusFilter != "all" {
-		query = `
-			SELECT id, organization_id, customer_id, assigned_agent_id, title, description,
-			       status, priority, telegram_message_id, telegram_chat_id, created_at, updated_at
-			FROM tickets WHERE organization_id = $1 AND status = $2
-			ORDER BY created_at DESC`
-		args = []interface{}{orgID, statusFilter}
-	} else {
-		query = `
-			SELECT id, organization_id, customer_id, assigned_agent_id, title, description,
-			       status, priority, telegram_message_id, telegram_chat_id, created_at, updated_at
-			FROM tickets WHERE organization_id = $1
-			ORDER BY created_at DESC`
-		args = []interface{}{orgID}
-	}
-
+func queryTickets(query string, args ...interface{}) ([]*models.Ticket, error) {
 	rows, err := DB.Query(query, args...)
 	if err != nil {
 		return nil, err
@@ -137,107 +111,144 @@ func GetTicketsByOrganization(orgID int, statusFilter string) ([]*models.Ticket,
 
 	var tickets []*models.Ticket
 	for rows.Next() {
-		ticket := &models.Ticket{}
-		var customerID, assignedAgentID, telegramMessageID sql.NullInt64
-		var description sql.NullString
-		var telegramChatID sql.NullInt64
-
-		err := rows.Scan(
-			&ticket.ID, &ticket.OrganizationID, &customerID, &assignedAgentID,
-			&ticket.Title, &description, &ticket.Status, &ticket.Priority,
-			&telegramMessageID, &telegramChatID, &ticket.CreatedAt, &ticket.UpdatedAt,
-		)
+		ticket, err := scanTicket(rows)
 		if err != nil {
 			return nil, err
 		}
-
-		if customerID.Valid {
-			cid := int(customerID.Int64)
-			ticket.CustomerID = &cid
-		}
-		if assignedAgentID.Valid {
-			aid := int(assignedAgentID.Int64)
-			ticket.AssignedAgentID = &aid
-		}
-		if description.Valid {
-			ticket.Description = &description.String
-		}
-		if telegramMessageID.Valid {
-			tmid := int(telegramMessageID.Int64)
-			ticket.TelegramMessageID = &tmid
-		}
-		if telegramChatID.Valid {
-			ticket.TelegramChatID = &telegramChatID.Int64
-		}
-
 		tickets = append(tickets, ticket)
 	}
 
 	return tickets, rows.Err()
 }
 
-func UpdateTicketStatus(id int, status string) error {
-	query := `UPDATE tickets SET status = $1, updated_at = $2 WHERE id = $3`
-	_, err := DB.Exec(query, status, time.Now(), id)
+func CreateTicket(ticket *models.Ticket) error {
+	query := `
+		INSERT INTO tickets (organization_id, customer_id, assigned_agent_id, title,
+		                    description, status, priority, telegram_message_id, telegram_chat_id, category_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, created_at, updated_at`
+
+	err := DB.QueryRow(query,
+		ticket.OrganizationID, ticket.CustomerID, ticket.AssignedAgentID,
+		ticket.Title, ticket.Description, ticket.Status, ticket.Priority,
+		ticket.TelegramMessageID, ticket.TelegramChatID, ticket.CategoryID,
+	).Scan(&ticket.ID, &ticket.CreatedAt, &ticket.UpdatedAt)
+
+	return err
+}
+
+func GetTicketByID(id int) (*models.Ticket, error) {
+	query := `SELECT ` + ticketColumns + ` FROM tickets WHERE id = $1`
+	return scanTicket(DB.QueryRow(query, id))
+}
+
+func GetTicketByTelegramMessage(chatID int64, messageID int) (*models.Ticket, error) {
+	query := `SELECT ` + ticketColumns + ` FROM tickets WHERE telegram_chat_id = $1 AND telegram_message_id = $2`
+
+	ticket, err := scanTicket(DB.QueryRow(query, chatID, messageID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return ticket, err
+}
+
+func GetTicketsByOrganization(orgID int, statusFilter string) ([]*models.Ticket, error) {
+	if statusFilter != "" && statusFilter != "all" {
+		// A stage also matches the custom statuses mapped onto it
+		query := `
+			SELECT ` + ticketColumns + `
+			FROM tickets t WHERE t.organization_id = $1 AND ` + inStages("t", "$2") + `
+			ORDER BY ` + priorityOrder + `, created_at DESC`
+		return queryTickets(query, orgID, pq.Array([]string{statusFilter}))
+	}
+
+	query := `
+		SELECT ` + ticketColumns + `
+		FROM tickets WHERE organization_id = $1
+		ORDER BY ` + priorityOrder + `, created_at DESC`
+	return queryTickets(query, orgID)
+}
+
+func UpdateTicketPriority(id int, priority string) error {
+	if !models.IsValidPriority(priority) {
+		return fmt.Errorf("invalid priority %q", priority)
+	}
+	query := `UPDATE tickets SET priority = $1, updated_at = $2 WHERE id = $3`
+	_, err := DB.Exec(query, priority, time.Now(), id)
 	return err
 }
 
 func AssignTicket(ticketID, agentID int) error {
-	query := `UPDATE tickets SET assigned_agent_id = $1, status = 'in_progress', updated_at = $2 WHERE id = $3`
+	query := `UPDATE tickets SET assigned_agent_id = $1, updated_at = $2 WHERE id = $3`
 	_, err := DB.Exec(query, agentID, time.Now(), ticketID)
 	return err
 }
 
 func GetTicketsByAgent(agentID int) ([]*models.Ticket, error) {
 	query := `
-		SELECT id, organization_id, customer_id, assigned_agent_id, title, description,
-		       status, priority, telegram_message_id, telegram_chat_id, created_at, updated_at
+		SELECT ` + ticketColumns + `
 		FROM tickets WHERE assigned_agent_id = $1
-		ORDER BY created_at DESC`
+		ORDER BY ` + priorityOrder + `, created_at DESC`
+	return queryTickets(query, agentID)
+}
 
-	rows, err := DB.Query(query, agentID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+// GetActiveTicketsByCustomer returns the customer's open and in-progress tickets
+// that had any activity (ticket update or message) since the given time,
+// most recently active first.
+func GetActiveTicketsByCustomer(customerID int, since time.Time) ([]*models.Ticket, error) {
+	return getRecentTicketsByCustomer(customerID, since, []string{"open", "in_progress"})
+}
 
-	var tickets []*models.Ticket
-	for rows.Next() {
-		ticket := &models.Ticket{}
-		var customerID, assignedAgentID, telegramMessageID sql.NullInt64
-		var description sql.NullString
-		var telegramChatID sql.NullInt64
-
-		err := rows.Scan(
-			&ticket.ID, &ticket.OrganizationID, &customerID, &assignedAgentID,
-			&ticket.Title, &description, &ticket.Status, &ticket.Priority,
-			&telegramMessageID, &telegramChatID, &ticket.CreatedAt, &ticket.UpdatedAt,
-		)
-		if err != nil {
-			return nil, err
-		}
+// GetUnclosedTicketsByCustomer is GetActiveTicketsByCustomer including
+// resolved tickets.
+func GetUnclosedTicketsByCustomer(customerID int, since time.Time) ([]*models.Ticket, error) {
+	return getRecentTicketsByCustomer(customerID, since, []string{"open", "in_progress", "resolved"})
+}
 
-		if customerID.Valid {
-			cid := int(customerID.Int64)
-			ticket.CustomerID = &cid
-		}
-		if assignedAgentID.Valid {
-			aid := int(assignedAgentID.Int64)
-			ticket.AssignedAgentID = &aid
-		}
-		if description.Valid {
-			ticket.Description = &description.String
-		}
-		if telegramMessageID.Valid {
-			tmid := int(telegramMessageID.Int64)
-			ticket.TelegramMessageID = &tmid
-		}
-		if telegramChatID.Valid {
-			ticket.TelegramChatID = &telegramChatID.Int64
-		}
+func getRecentTicketsByCustomer(customerID int, since time.Time, stages []string) ([]*models.Ticket, error) {
+	query := `
+		SELECT ` + ticketColumns + `
+		FROM (
+			SELECT t.*, GREATEST(t.updated_at,
+			       COALESCE((SELECT MAX(m.created_at) FROM messages m WHERE m.ticket_id = t.id), t.updated_at)) AS last_activity
+			FROM tickets t
+			WHERE t.customer_id = $1 AND ` + inStages("t", "$3") + `
+		) active
+		WHERE last_activity >= $2
+		ORDER BY last_activity DESC`
+	return queryTickets(query, customerID, since, pq.Array(stages))
+}
 
-		tickets = append(tickets, ticket)
-	}
+// GetFollowUpTicketsByCustomer returns the tickets a customer's new message
+// may belong to, most recently active first: open and in-progress tickets
+// active since the given time, and resolved tickets their organization has
+// not auto-closed yet. With auto-closing off, resolved tickets too count only
+// when active since the given time.
+func GetFollowUpTicketsByCustomer(customerID int, since, now time.Time) ([]*models.Ticket, error) {
+	query := `
+		SELECT ` + ticketColumns + `
+		FROM (
+			SELECT t.*, GREATEST(t.updated_at,
+			       COALESCE((SELECT MAX(m.created_at) FROM messages m WHERE m.ticket_id = t.id), t.updated_at)) AS last_activity,
+			       ` + inStages("t", "$5") + ` AS is_resolved, o.auto_close_days
+			FROM tickets t
+			JOIN organizations o ON o.id = t.organization_id
+			WHERE t.customer_id = $1 AND ` + inStages("t", "$4") + `
+		) unclosed
+		WHERE CASE WHEN is_resolved AND auto_close_days > 0 AND resolved_at IS NOT NULL
+		           THEN resolved_at + auto_close_days * INTERVAL '1 day' >= $3
+		           ELSE last_activity >= $2 END
+		ORDER BY last_activity DESC`
+	return queryTickets(query, customerID, since.UTC(), now.UTC(),
+		pq.Array([]string{"open", "in_progress", "resolved"}), pq.Array([]string{"resolved"}))
+}
 
-	return tickets, rows.Err()
+// GetTicketsByCustomer returns a page of the customer's tickets, newest first.
+func GetTicketsByCustomer(customerID, limit, offset int) ([]*models.Ticket, error) {
+	query := `
+		SELECT ` + ticketColumns + `
+		FROM tickets WHERE customer_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2 OFFSET $3`
+	return queryTickets(query, customerID, limit, offset)
 }
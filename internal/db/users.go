@@ -9,16 +9,16 @@ import (
 func GetUserByID(id int) (*models.User, error) {
 	query := `
 		SELECT id, organization_id, telegram_id, username, email, password_hash, 
-		       role, full_name, is_active, created_at, updated_at
+		       role, full_name, is_active, language, created_at, updated_at
 		FROM users WHERE id = $1`
 
 	user := &models.User{}
 	var telegramID sql.NullInt64
-	var username, email, passwordHash, fullName sql.NullString
+	var username, email, passwordHash, fullName, language sql.NullString
 
 	err := DB.QueryRow(query, id).Scan(
 		&user.ID, &user.OrganizationID, &telegramID, &username, &email,
-		&passwordHash, &user.Role, &fullName, &user.IsActive,
+		&passwordHash, &user.Role, &fullName, &user.IsActive, &language,
 		&user.CreatedAt, &user.UpdatedAt,
 	)
 	if err != nil {
@@ -40,6 +40,9 @@ func GetUserByID(id int) (*models.User, error) {
 	if fullName.Valid {
 		user.FullName = &fullName.String
 	}
+	if language.Valid {
+		user.Language = &language.String
+	}
 
 	return user, nil
 }
@@ -47,16 +50,16 @@ func GetUserByID(id int) (*models.User, error) {
 func GetUserByTelegramID(telegramID int64) (*models.User, error) {
 	query := `
 		SELECT id, organization_id, telegram_id, username, email, password_hash, 
-		       role, full_name, is_active, created_at, updated_at
+		       role, full_name, is_active, language, created_at, updated_at
 		FROM users WHERE telegram_id = $1`
 
 	user := &models.User{}
 	var tgID sql.NullInt64
-	var username, email, passwordHash, fullName sql.NullString
+	var username, email, passwordHash, fullName, language sql.NullString
 
 	err := DB.QueryRow(query, telegramID).Scan(
 		&user.ID, &user.OrganizationID, &tgID, &username, &email,
-		&passwordHash, &user.Role, &fullName, &user.IsActive,
+		&passwordHash, &user.Role, &fullName, &user.IsActive, &language,
 		&user.CreatedAt, &user.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
@@ -81,6 +84,9 @@ func GetUserByTelegramID(telegramID int64) (*models.User, error) {
 	if fullName.Valid {
 		user.FullName = &fullName.String
 	}
+	if language.Valid {
+		user.Language = &language.String
+	}
 
 	return user, nil
 }
@@ -88,16 +94,16 @@ func GetUserByTelegramID(telegramID int64) (*models.User, error) {
 func GetUserByEmail(email string) (*models.User, error) {
 	query := `
 		SELECT id, organization_id, telegram_id, username, email, password_hash, 
-		       role, full_name, is_active, created_at, updated_at
+		       role, full_name, is_active, language, created_at, updated_at
 		FROM users WHERE email = $1`
 
 	user := &models.User{}
 	var telegramID sql.NullInt64
-	var username, emailVal, passwordHash, fullName sql.NullString
+	var username, emailVal, passwordHash, fullName, language sql.NullString
 
 	err := DB.QueryRow(query, email).Scan(
 		&user.ID, &user.OrganizationID, &telegramID, &username, &emailVal,
-		&passwordHash, &user.Role, &fullName, &user.IsActive,
+		&passwordHash, &user.Role, &fullName, &user.IsActive, &language,
 		&user.CreatedAt, &user.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
@@ -122,6 +128,9 @@ func GetUserByEmail(email string) (*models.User, error) {
 	if fullName.Valid {
 		user.FullName = &fullName.String
 	}
+	if language.Valid {
+		user.Language = &language.String
+	}
 
 	return user, nil
 }
@@ -129,13 +138,13 @@ func GetUserByEmail(email string) (*models.User, error) {
 func CreateUser(user *models.User) error {
 	query := `
 		INSERT INTO users (organization_id, telegram_id, username, email, password_hash, 
-		                  role, full_name, is_active)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		                  role, full_name, is_active, language)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		RETURNING id, created_at, updated_at`
 
 	err := DB.QueryRow(query,
 		user.OrganizationID, user.TelegramID, user.Username, user.Email,
-		user.PasswordHash, user.Role, user.FullName, user.IsActive,
+		user.PasswordHash, user.Role, user.FullName, user.IsActive, user.Language,
 	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
 
 	return err
@@ -147,10 +156,30 @@ func UpdateUserTelegramID(userID int, telegramID int64) error {
 	return err
 }
 
+// UpdateUserLanguage sets the user's language; nil falls back to the organization's default.
+func UpdateUserLanguage(userID int, language *string) error {
+	query := `UPDATE users SET language = $1, updated_at = $2 WHERE id = $3`
+	_, err := DB.Exec(query, language, time.Now(), userID)
+	return err
+}
+
+// GetUserLanguage returns the language chosen by the user or else their
+// organization's default.
+func GetUserLanguage(userID int) (string, error) {
+	query := `
+		SELECT COALESCE(u.language, o.language)
+		FROM users u JOIN organizations o ON o.id = u.organization_id
+		WHERE u.id = $1`
+
+	var language string
+	err := DB.QueryRow(query, userID).Scan(&language)
+	return language, err
+}
+
 func GetUsersByOrganization(orgID int) ([]*models.User, error) {
 	query := `
 		SELECT id, organization_id, telegram_id, username, email, password_hash, 
-		       role, full_name, is_active, created_at, updated_at
+		       role, full_name, is_active, language, created_at, updated_at
 		FROM users WHERE organization_id = $1 AND is_active = TRUE
 		ORDER BY created_at DESC`
 
@@ -164,11 +193,11 @@ func GetUsersByOrganization(orgID int) ([]*models.User, error) {
 	for rows.Next() {
 		user := &models.User{}
 		var telegramID sql.NullInt64
-		var username, email, passwordHash, fullName sql.NullString
+		var username, email, passwordHash, fullName, language sql.NullString
 
 		err := rows.Scan(
 			&user.ID, &user.OrganizationID, &telegramID, &username, &email,
-			&passwordHash, &user.Role, &fullName, &user.IsActive,
+			&passwordHash, &user.Role, &fullName, &user.IsActive, &language,
 			&user.CreatedAt, &user.UpdatedAt,
 		)
 		if err != nil {
@@ -190,9 +219,42 @@ func GetUsersByOrganization(orgID int) ([]*models.User, error) {
 		if fullName.Valid {
 			user.FullName = &fullName.String
 		}
+		if language.Valid {
+			user.Language = &language.String
+		}
 
 		users = append(users, user)
 	}
 
 	return users, rows.Err()
 }
+
+// GetUserICSToken returns the user's feed token, or "" if the feed is off.
+func GetUserICSToken(userID int) (string, error) {
+	var token sql.NullString
+	err := DB.QueryRow(`SELECT ics_token FROM users WHERE id = $1`, userID).Scan(&token)
+	return token.String, err
+}
+
+// SetUserICSToken sets or, with an empty token, removes the user's feed token.
+func SetUserICSToken(userID int, token string) error {
+	var value *string
+	if token != "" {
+		value = &token
+	}
+	_, err := DB.Exec(`UPDATE users SET ics_token = $1, updated_at = $2 WHERE id = $3`, value, time.Now(), userID)
+	return err
+}
+
+// GetUserByICSToken returns the active user owning a feed token, or nil.
+func GetUserByICSToken(token string) (*models.User, error) {
+	var id int
+	err := DB.QueryRow(`SELECT id FROM users WHERE ics_token = $1 AND is_active = TRUE`, token).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return GetUserByID(id)
+}
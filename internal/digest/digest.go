@@ -0,0 +1,231 @@
+// Package digest builds the daily and weekly ticket summaries operators get
+// from the bot and on the web: active tickets by age, unassigned tickets, SLA
+// breaches, tickets waiting on the customer and the number of resolved ones.
+package digest
+
+import (
+	"context"
+	"fmt"
+	"helpdesk/internal/db"
+	"helpdesk/internal/models"
+	"helpdesk/internal/schedule"
+	"helpdesk/internal/sla"
+	"log"
+	"time"
+)
+
+// Digest sections.
+const (
+	SectionAge        = "age"
+	SectionUnassigned = "unassigned"
+	SectionSLA        = "sla"
+	SectionWaiting    = "waiting"
+	SectionResolved   = "resolved"
+)
+
+// Sections lists the sections in the order they are shown.
+var Sections = []string{SectionAge, SectionUnassigned, SectionSLA, SectionWaiting, SectionResolved}
+
+// Frequencies.
+const (
+	Off    = "off"
+	Daily  = "daily"
+	Weekly = "weekly"
+)
+
+// MaxDelay is how late a digest may still be sent, e.g. after a restart. A
+// digest missed for longer is skipped until its next time.
+const MaxDelay = 3 * time.Hour
+
+// oldestCount is how many of the oldest active tickets the age section lists.
+const oldestCount = 5
+
+// ageLimits bound the age buckets of models.Digest.Ages.
+var ageLimits = []time.Duration{24 * time.Hour, 3 * 24 * time.Hour, 7 * 24 * time.Hour}
+
+// IsValidSection reports whether s is one of Sections.
+func IsValidSection(s string) bool {
+	for _, v := range Sections {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultSettings are the settings of an operator who never chose any.
+func DefaultSettings(userID int) *models.DigestSettings {
+	return &models.DigestSettings{
+		UserID:    userID,
+		Frequency: Off,
+		SendTime:  "09:00",
+		Weekday:   int(time.Monday),
+		Sections:  append([]string{}, Sections...),
+	}
+}
+
+// location is the organization's timezone.
+func location(orgID int) (*time.Location, error) {
+	org, err := db.GetOrganizationByID(orgID)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := time.LoadLocation(org.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", org.Timezone, err)
+	}
+	return loc, nil
+}
+
+func midnight(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// Build collects the sections of an organization's digest as of now. The
+// resolved count covers the previous day, or the previous seven days of a
+// weekly digest, in the organization's timezone.
+func Build(orgID int, sections []string, weekly bool, now time.Time) (*models.Digest, error) {
+	loc, err := location(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &models.Digest{OrganizationID: orgID, Weekly: weekly, Sections: sections, GeneratedAt: now.In(loc)}
+
+	if d.Includes(SectionAge) || d.Includes(SectionUnassigned) || d.Includes(SectionSLA) {
+		active, err := db.GetActiveTicketsByOrganization(orgID)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range active {
+			bucket := len(ageLimits)
+			for i, limit := range ageLimits {
+				if now.Sub(t.CreatedAt) < limit {
+					bucket = i
+					break
+				}
+			}
+			d.Ages[bucket]++
+			if len(d.Oldest) < oldestCount {
+				d.Oldest = append(d.Oldest, t)
+			}
+			if t.AssignedAgentID == nil {
+				d.Unassigned = append(d.Unassigned, t)
+			}
+			if sla.State(t, now) == sla.StateBreached {
+				d.Breached = append(d.Breached, t)
+			}
+		}
+	}
+
+	if d.Includes(SectionWaiting) {
+		if d.Waiting, err = db.GetTicketsAwaitingCustomer(orgID); err != nil {
+			return nil, err
+		}
+	}
+
+	if d.Includes(SectionResolved) {
+		d.ResolvedTo = midnight(now.In(loc))
+		days := 1
+		if weekly {
+			days = 7
+		}
+		d.ResolvedFrom = d.ResolvedTo.AddDate(0, 0, -days)
+		if d.Resolved, err = db.CountTicketsResolvedBetween(orgID, d.ResolvedFrom, d.ResolvedTo); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// lastSlot returns the latest time at or before now the settings ask for a
+// digest, now being in the organization's timezone.
+func lastSlot(s *models.DigestSettings, now time.Time) (time.Time, error) {
+	clock, err := schedule.ParseClock(s.SendTime)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	day := midnight(now)
+	slot := func(d time.Time) time.Time { return schedule.At(d, clock) }
+
+	if s.Frequency == Weekly {
+		back := (int(day.Weekday()) - s.Weekday + 7) % 7
+		day = day.AddDate(0, 0, -back)
+		if slot(day).After(now) {
+			day = day.AddDate(0, 0, -7)
+		}
+		return slot(day), nil
+	}
+
+	if slot(day).After(now) {
+		day = day.AddDate(0, 0, -1)
+	}
+	return slot(day), nil
+}
+
+// Due reports whether the digest of the settings should be sent now.
+func Due(s *models.DigestSettings, now time.Time) (bool, error) {
+	if s.Frequency != Daily && s.Frequency != Weekly {
+		return false, nil
+	}
+	slot, err := lastSlot(s, now)
+	if err != nil {
+		return false, err
+	}
+	if now.Sub(slot) > MaxDelay {
+		return false, nil
+	}
+	return s.LastSentAt == nil || s.LastSentAt.Before(slot), nil
+}
+
+// SendDue sends the digests whose time has come. send delivers the digest to
+// the operator and reports whether it was delivered. It stops early when ctx
+// is done.
+func SendDue(ctx context.Context, send func(user *models.User, d *models.Digest) bool) error {
+	list, err := db.GetEnabledDigestSettings()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, s := range list {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		user, err := db.GetUserByID(s.UserID)
+		if err != nil {
+			log.Printf("Error loading digest recipient %d: %v", s.UserID, err)
+			continue
+		}
+		loc, err := location(user.OrganizationID)
+		if err != nil {
+			log.Printf("Error loading timezone of organization %d: %v", user.OrganizationID, err)
+			continue
+		}
+
+		due, err := Due(s, now.In(loc))
+		if err != nil {
+			log.Printf("Invalid digest settings of user %d: %v", s.UserID, err)
+			continue
+		}
+		if !due {
+			continue
+		}
+
+		d, err := Build(user.OrganizationID, s.Sections, s.Frequency == Weekly, now)
+		if err != nil {
+			log.Printf("Error building digest for user %d: %v", s.UserID, err)
+			continue
+		}
+		if !send(user, d) {
+			continue
+		}
+		if err := db.MarkDigestSent(s.UserID, now); err != nil {
+			log.Printf("Error recording digest sent to user %d: %v", s.UserID, err)
+		}
+	}
+	return nil
+}
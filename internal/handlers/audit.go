@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"helpdesk/internal/db"
+	"helpdesk/internal/tickets"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// AuditExportHandler streams the organization's audit log as CSV.
+// Query parameters: from and to (YYYY-MM-DD, to is inclusive, default the
+// last 30 days) and an optional ticket_id.
+func AuditExportHandler(w http.ResponseWriter, r *http.Request) {
+	orgID := getOrganizationID(r)
+
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			http.Error(w, "Invalid from date", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			http.Error(w, "Invalid to date", http.StatusBadRequest)
+			return
+		}
+		to = t.AddDate(0, 0, 1)
+	}
+
+	ticketID := 0
+	if v := r.URL.Query().Get("ticket_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid ticket ID", http.StatusBadRequest)
+			return
+		}
+		ticketID = id
+	}
+
+	events, err := db.GetAuditEventsByOrganization(orgID, from, to, ticketID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	users, err := db.GetUsersByOrganization(orgID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	names := displayNames(users)
+	lang := getLanguage(r)
+
+	filename := fmt.Sprintf("audit_%s_%s.csv", from.Format("20060102"), to.AddDate(0, 0, -1).Format("20060102"))
+	if ticketID != 0 {
+		filename = fmt.Sprintf("audit_ticket_%d.csv", ticketID)
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time", "ticket_id", "actor_id", "actor", "channel", "action", "before", "after", "summary"})
+	for _, e := range events {
+		ticket, actorID, actor, before, after := "", "", "", "", ""
+		if e.TicketID != nil {
+			ticket = strconv.Itoa(*e.TicketID)
+		}
+		if e.ActorID != nil {
+			actorID = strconv.Itoa(*e.ActorID)
+			actor = names[*e.ActorID]
+		}
+		if e.Before != nil {
+			before = *e.Before
+		}
+		if e.After != nil {
+			after = *e.After
+		}
+		cw.Write([]string{
+			e.CreatedAt.Format(time.RFC3339), ticket, actorID, actor, e.Channel, e.Action,
+			before, after, tickets.DescribeEvent(orgID, e, names, lang),
+		})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		log.Printf("Error writing audit export: %v", err)
+	}
+}
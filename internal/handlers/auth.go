@@ -4,13 +4,19 @@ import (
 	"fmt"
 	"helpdesk/internal/auth"
 	"helpdesk/internal/db"
+	"helpdesk/internal/i18n"
 	"net/http"
+	"strings"
 	"time"
 )
 
 func LoginHandler(w http.ResponseWriter, r *http.Request) {
+	lang := requestLanguage(r)
+
 	if r.Method == "GET" {
-		renderTemplate(w, "login.html", nil)
+		renderTemplate(w, "login.html", map[string]interface{}{
+			"Lang": lang,
+		})
 		return
 	}
 
@@ -19,7 +25,8 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 
 	if email == "" || password == "" {
 		renderTemplate(w, "login.html", map[string]interface{}{
-			"Error": "Email и пароль обязательны",
+			"Error": i18n.T(lang, "web.login.error.required"),
+			"Lang":  lang,
 		})
 		return
 	}
@@ -28,7 +35,8 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	if err != nil || user == nil {
 		fmt.Printf("Login failed: user not found or error - email: %s, err: %v\n", email, err)
 		renderTemplate(w, "login.html", map[string]interface{}{
-			"Error": "Неверный email или пароль",
+			"Error": i18n.T(lang, "web.login.error.invalid"),
+			"Lang":  lang,
 		})
 		return
 	}
@@ -36,21 +44,23 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	if user.PasswordHash == nil || !auth.CheckPassword(password, *user.PasswordHash) {
 		fmt.Printf("Login failed: password check failed - email: %s, hash exists: %v\n", email, user.PasswordHash != nil)
 		renderTemplate(w, "login.html", map[string]interface{}{
-			"Error": "Неверный email или пароль",
+			"Error": i18n.T(lang, "web.login.error.invalid"),
+			"Lang":  lang,
 		})
 		return
 	}
 
 	if !user.IsActive {
 		renderTemplate(w, "login.html", map[string]interface{}{
-			"Error": "Аккаунт деактивирован",
+			"Error": i18n.T(lang, "web.login.error.inactive"),
+			"Lang":  lang,
 		})
 		return
 	}
 
 	sessionID, err := auth.CreateSession(user.ID, user.OrganizationID, user.Role)
 	if err != nil {
-		http.Error(w, "Ошибка создания сессии", http.StatusInternalServerError)
+		http.Error(w, i18n.T(lang, "web.login.error.session"), http.StatusInternalServerError)
 		return
 	}
 
@@ -103,18 +113,17 @@ func RequireAuth(w http.ResponseWriter, r *http.Request) {
 	r.Header.Set("X-User-Role", session.Role)
 }
 
-// requireRole is a helper that can be used in future for role-based access control
-// Currently not used, but kept for potential future use
-func requireRole(role string) func(http.HandlerFunc) http.HandlerFunc {
-	return func(next http.HandlerFunc) http.HandlerFunc {
-		return func(w http.ResponseWriter, r *http.Request) {
+// RequireRole restricts a route to users with the given role. Admins always pass.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			userRole := r.Header.Get("X-User-Role")
 			if userRole != role && userRole != "admin" {
-				http.Error(w, "Доступ запрещен", http.StatusForbidden)
+				http.Error(w, i18n.T(getLanguage(r), "web.error.forbidden"), http.StatusForbidden)
 				return
 			}
-			next(w, r)
-		}
+			next.ServeHTTP(w, r)
+		})
 	}
 }
 
@@ -135,3 +144,25 @@ func getOrganizationID(r *http.Request) int {
 func getUserRole(r *http.Request) string {
 	return r.Header.Get("X-User-Role")
 }
+
+// getLanguage returns the language the logged in user reads the interface in:
+// their own choice, else their organization's.
+func getLanguage(r *http.Request) string {
+	lang, err := db.GetUserLanguage(getUserID(r))
+	if err != nil || !i18n.Supported(lang) {
+		return requestLanguage(r)
+	}
+	return lang
+}
+
+// requestLanguage picks the language of an anonymous visitor from the
+// browser's Accept-Language header.
+func requestLanguage(r *http.Request) string {
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, _, _ := strings.Cut(part, ";")
+		if lang := i18n.Normalize(tag); lang != "" {
+			return lang
+		}
+	}
+	return i18n.Default
+}
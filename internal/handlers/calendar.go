@@ -1,18 +1,40 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"helpdesk/internal/auth"
+	"helpdesk/internal/bot"
 	"helpdesk/internal/calendar"
+	"helpdesk/internal/db"
+	"helpdesk/internal/i18n"
+	"helpdesk/internal/models"
+	"helpdesk/internal/tickets"
+	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func GoogleCalendarAuthHandler(w http.ResponseWriter, r *http.Request) {
-	orgID := getOrganizationID(r)
-	state := fmt.Sprintf("%d", orgID)
-	
+	cookie, err := r.Cookie("session")
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	state, err := auth.NewOAuthState(cookie.Value, getOrganizationID(r))
+	if err != nil {
+		log.Printf("Error creating OAuth state: %v", err)
+		http.Error(w, i18n.T(getLanguage(r), "web.calendar.error.start"), http.StatusInternalServerError)
+		return
+	}
+
 	authURL := calendar.GetAuthURL(state)
 	if authURL == "" {
-		http.Error(w, "Google Calendar not configured", http.StatusInternalServerError)
+		http.Error(w, i18n.T(getLanguage(r), "web.calendar.error.not_configured"), http.StatusServiceUnavailable)
 		return
 	}
 
@@ -20,24 +42,358 @@ func GoogleCalendarAuthHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func GoogleCalendarCallbackHandler(w http.ResponseWriter, r *http.Request) {
-	code := r.URL.Query().Get("code")
-	if code == "" {
-		http.Error(w, "Authorization code not provided", http.StatusBadRequest)
+	query := r.URL.Query()
+
+	cookie, err := r.Cookie("session")
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
 
-	orgID := getOrganizationID(r)
+	orgID, err := auth.VerifyOAuthState(query.Get("state"), cookie.Value)
+	if err != nil || orgID != getOrganizationID(r) {
+		log.Printf("Rejected Google OAuth callback for organization %d: state mismatch (%v)", getOrganizationID(r), err)
+		http.Error(w, i18n.T(getLanguage(r), "web.calendar.error.state"), http.StatusBadRequest)
+		return
+	}
+
+	// The admin declined the consent screen
+	if reason := query.Get("error"); reason != "" {
+		log.Printf("Google OAuth for organization %d failed: %s", orgID, reason)
+		http.Redirect(w, r, "/settings/calendar?error=denied", http.StatusSeeOther)
+		return
+	}
+
+	code := query.Get("code")
+	if code == "" {
+		http.Error(w, i18n.T(getLanguage(r), "web.calendar.error.no_code"), http.StatusBadRequest)
+		return
+	}
 
 	token, err := calendar.ExchangeCode(code)
 	if err != nil {
-		http.Error(w, "Failed to exchange code: "+err.Error(), http.StatusInternalServerError)
+		log.Printf("Error exchanging Google OAuth code for organization %d: %v", orgID, err)
+		http.Redirect(w, r, "/settings/calendar?error=exchange", http.StatusSeeOther)
 		return
 	}
 
 	if err := calendar.SaveToken(orgID, token); err != nil {
-		http.Error(w, "Failed to save token: "+err.Error(), http.StatusInternalServerError)
+		log.Printf("Error saving Google token for organization %d: %v", orgID, err)
+		http.Redirect(w, r, "/settings/calendar?error=exchange", http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, "/settings/calendar", http.StatusSeeOther)
+}
+
+// CalendarSettingsHandler shows the organization's calendar provider and its
+// connection, and selects the Google calendar appointments are created in.
+func CalendarSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	orgID := getOrganizationID(r)
+
+	if r.Method == "POST" {
+		var calendarID *string
+		if v := strings.TrimSpace(r.FormValue("calendar_id")); v != "" && v != "primary" {
+			calendars, err := calendar.ListCalendars(orgID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if !hasCalendar(calendars, v) {
+				http.Error(w, "Unknown calendar", http.StatusBadRequest)
+				return
+			}
+			calendarID = &v
+		}
+		if err := db.UpdateOrganizationCalendarID(orgID, calendarID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/settings/calendar", http.StatusSeeOther)
+		return
+	}
+
+	org, err := db.GetOrganizationByID(orgID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Provider": org.CalendarProvider,
+		"Error":    r.URL.Query().Get("error"),
+		"UserRole": getUserRole(r),
+		"Lang":     getLanguage(r),
+	}
+
+	if org.CalendarProvider == calendar.ProviderCalDAV {
+		account, err := db.GetCalDAVAccount(orgID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data["CalDAV"] = account
+		renderTemplate(w, "calendar.html", data)
 		return
 	}
 
-	http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+	token, err := db.GetGoogleCalendarToken(orgID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data["Configured"] = calendar.Enabled()
+	data["Connected"] = token != nil
+	data["CalendarID"] = calendar.CalendarID(org)
+	if token != nil && token.BrokenAt != nil {
+		data["BrokenAt"] = *token.BrokenAt
+		data["BrokenReason"] = token.BrokenReason
+	} else if token != nil {
+		data["ConnectedAt"] = token.CreatedAt
+		calendars, err := calendar.ListCalendars(orgID)
+		if err != nil {
+			log.Printf("Error listing calendars for organization %d: %v", orgID, err)
+			data["ListError"] = true
+		}
+		data["Calendars"] = calendars
+	}
+
+	renderTemplate(w, "calendar.html", data)
+}
+
+// hasCalendar reports whether id is one of the listed calendars.
+func hasCalendar(calendars []calendar.CalendarInfo, id string) bool {
+	for _, c := range calendars {
+		if c.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func DisconnectCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	orgID := getOrganizationID(r)
+	if err := calendar.Disconnect(orgID); err != nil {
+		log.Printf("Error disconnecting Google Calendar for organization %d: %v", orgID, err)
+		http.Error(w, i18n.T(getLanguage(r), "web.calendar.error.disconnect"), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/settings/calendar", http.StatusSeeOther)
+}
+
+// CalendarProviderHandler selects the calendar provider of the organization.
+// Appointments already created stay in the previous calendar.
+func CalendarProviderHandler(w http.ResponseWriter, r *http.Request) {
+	provider := r.FormValue("provider")
+	if provider != calendar.ProviderGoogle && provider != calendar.ProviderCalDAV {
+		http.Error(w, "Invalid provider", http.StatusBadRequest)
+		return
+	}
+
+	if err := db.UpdateOrganizationCalendarProvider(getOrganizationID(r), provider); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/settings/calendar", http.StatusSeeOther)
+}
+
+// CalDAVSettingsHandler saves the CalDAV account after checking that the
+// server accepts it. An empty password keeps the saved one.
+func CalDAVSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	orgID := getOrganizationID(r)
+
+	account := &models.CalDAVAccount{
+		OrganizationID: orgID,
+		CalendarURL:    strings.TrimSpace(r.FormValue("calendar_url")),
+		Username:       strings.TrimSpace(r.FormValue("username")),
+		Password:       r.FormValue("password"),
+	}
+	if u, err := url.Parse(account.CalendarURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		http.Redirect(w, r, "/settings/calendar?error=caldav_url", http.StatusSeeOther)
+		return
+	}
+
+	if err := calendar.CheckPublicURL(account.CalendarURL); err != nil {
+		log.Printf("Rejected CalDAV URL for organization %d: %v", orgID, err)
+		http.Redirect(w, r, "/settings/calendar?error=caldav_host", http.StatusSeeOther)
+		return
+	}
+
+	if account.Password == "" {
+		saved, err := db.GetCalDAVAccount(orgID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if saved != nil {
+			account.Password = saved.Password
+		}
+	}
+
+	if err := calendar.NewCalDAVProvider(account.CalendarURL, account.Username, account.Password).Check(); err != nil {
+		log.Printf("CalDAV check for organization %d failed: %v", orgID, err)
+		http.Redirect(w, r, "/settings/calendar?error=caldav", http.StatusSeeOther)
+		return
+	}
+
+	if err := db.SaveCalDAVAccount(account); err != nil {
+		log.Printf("Error saving CalDAV account for organization %d: %v", orgID, err)
+		http.Error(w, i18n.T(getLanguage(r), "web.calendar.error.caldav_save"), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/settings/calendar", http.StatusSeeOther)
+}
+
+func DisconnectCalDAVHandler(w http.ResponseWriter, r *http.Request) {
+	orgID := getOrganizationID(r)
+	if err := db.DeleteCalDAVAccount(orgID); err != nil {
+		log.Printf("Error removing CalDAV account for organization %d: %v", orgID, err)
+		http.Error(w, i18n.T(getLanguage(r), "web.calendar.error.disconnect"), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/settings/calendar", http.StatusSeeOther)
+}
+
+// appointmentView is an appointment with its description for the ticket page.
+type appointmentView struct {
+	Event   *models.TicketEvent
+	Summary string
+}
+
+func appointmentViews(ticketID int, lang string) ([]appointmentView, error) {
+	events, err := db.GetTicketEventsByTicket(ticketID)
+	if err != nil {
+		return nil, err
+	}
+
+	var views []appointmentView
+	for _, e := range events {
+		views = append(views, appointmentView{Event: e, Summary: tickets.AppointmentSummary(e).In(lang)})
+	}
+	return views, nil
+}
+
+func ScheduleAppointmentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ticketID, err := strconv.Atoi(r.FormValue("ticket_id"))
+	if err != nil {
+		http.Error(w, "Invalid ticket ID", http.StatusBadRequest)
+		return
+	}
+
+	ticket, err := db.GetTicketByID(ticketID)
+	if err != nil {
+		http.Error(w, "Ticket not found", http.StatusNotFound)
+		return
+	}
+
+	orgID := getOrganizationID(r)
+	if ticket.OrganizationID != orgID {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	if getUserRole(r) == "customer" {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	minutes, err := strconv.Atoi(r.FormValue("duration"))
+	if err != nil || minutes <= 0 {
+		http.Error(w, "Invalid duration", http.StatusBadRequest)
+		return
+	}
+
+	start, err := tickets.ParseAppointmentTime(orgID, r.FormValue("date"), r.FormValue("time"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	event, err := tickets.ScheduleAppointment(ticket, r.FormValue("kind"), start, time.Duration(minutes)*time.Minute, webActor(r))
+	if err != nil {
+		if errors.Is(err, tickets.ErrInvalidAppointment) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Failed to schedule appointment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	bot.NotifyCustomer(ticket, i18n.M("bot.customer.appointment_scheduled", ticket.ID, tickets.AppointmentSummary(event)))
+
+	http.Redirect(w, r, fmt.Sprintf("/ticket/%d", ticketID), http.StatusSeeOther)
+}
+
+// UpdateAppointmentHandler reschedules an appointment to a new date and time,
+// keeping its duration, or cancels it, in the calendar and on the ticket.
+func UpdateAppointmentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	eventID, err := strconv.Atoi(r.FormValue("event_id"))
+	if err != nil {
+		http.Error(w, "Invalid appointment ID", http.StatusBadRequest)
+		return
+	}
+
+	event, err := db.GetTicketEventByID(eventID)
+	if err != nil {
+		http.Error(w, "Appointment not found", http.StatusNotFound)
+		return
+	}
+
+	orgID := getOrganizationID(r)
+	if event.OrganizationID != orgID || getUserRole(r) == "customer" {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	ticket, err := db.GetTicketByID(event.TicketID)
+	if err != nil {
+		http.Error(w, "Ticket not found", http.StatusNotFound)
+		return
+	}
+
+	var notice i18n.Message
+	switch r.FormValue("action") {
+	case "reschedule":
+		start, err := tickets.ParseAppointmentTime(orgID, r.FormValue("date"), r.FormValue("time"))
+		if err == nil {
+			err = tickets.RescheduleAppointment(ticket, event, start, event.EndsAt.Sub(event.StartsAt), webActor(r))
+		}
+		if err != nil {
+			appointmentError(w, err)
+			return
+		}
+		notice = i18n.M("bot.customer.appointment_rescheduled", ticket.ID, tickets.AppointmentSummary(event))
+	case "cancel":
+		if err := tickets.CancelAppointment(ticket, event, webActor(r)); err != nil {
+			appointmentError(w, err)
+			return
+		}
+		notice = i18n.M("bot.customer.appointment_cancelled", ticket.ID, tickets.AppointmentSummary(event))
+	default:
+		http.Error(w, "Invalid action", http.StatusBadRequest)
+		return
+	}
+
+	bot.NotifyCustomer(ticket, notice)
+
+	http.Redirect(w, r, fmt.Sprintf("/ticket/%d", ticket.ID), http.StatusSeeOther)
+}
+
+func appointmentError(w http.ResponseWriter, err error) {
+	if errors.Is(err, tickets.ErrInvalidAppointment) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, "Failed to update appointment: "+err.Error(), http.StatusInternalServerError)
 }
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"helpdesk/internal/db"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// csatPeriods are the report periods in days.
+var csatPeriods = []int{7, 30, 90, 365}
+
+const csatDefaultDays = 30
+
+// csatCommentLimit is how many of the latest comments the report shows.
+const csatCommentLimit = 50
+
+// scoreShare is a bar of the score distribution.
+type scoreShare struct {
+	Score   int
+	Count   int
+	Percent float64
+}
+
+// CSATReportHandler shows the customer ratings of the organization's tickets
+// and lets admins choose whether a rating closes a resolved ticket.
+func CSATReportHandler(w http.ResponseWriter, r *http.Request) {
+	orgID := getOrganizationID(r)
+
+	if r.Method == "POST" {
+		if err := db.UpdateOrganizationCSATAutoClose(orgID, r.FormValue("auto_close") == "on"); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/reports/csat", http.StatusSeeOther)
+		return
+	}
+
+	days := csatDefaultDays
+	if v, err := strconv.Atoi(r.URL.Query().Get("days")); err == nil {
+		for _, p := range csatPeriods {
+			if p == v {
+				days = v
+			}
+		}
+	}
+	since := time.Now().AddDate(0, 0, -days)
+
+	org, err := db.GetOrganizationByID(orgID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	stats, err := db.GetCSATStats(orgID, since)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	agents, err := db.GetAgentCSAT(orgID, since)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	comments, err := db.GetRatingComments(orgID, since, csatCommentLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Highest score first
+	var shares []scoreShare
+	for score := 5; score >= 1; score-- {
+		shares = append(shares, scoreShare{Score: score, Count: stats.Scores[score-1], Percent: percent(stats.Scores[score-1], stats.Count)})
+	}
+
+	data := map[string]interface{}{
+		"Days":      days,
+		"Periods":   csatPeriods,
+		"Stats":     stats,
+		"Satisfied": percent(stats.Scores[3]+stats.Scores[4], stats.Count),
+		"Shares":    shares,
+		"Agents":    agents,
+		"Comments":  comments,
+		"AutoClose": org.CSATAutoClose,
+		"UserRole":  getUserRole(r),
+		"Lang":      getLanguage(r),
+	}
+
+	renderTemplate(w, "csat.html", data)
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(total)
+}
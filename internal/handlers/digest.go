@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"helpdesk/internal/db"
+	"helpdesk/internal/digest"
+	"helpdesk/internal/models"
+	"helpdesk/internal/schedule"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DigestHandler shows the operator's ticket digest, the weekly one with
+// period=weekly, and lets them choose when the bot sends it and which
+// sections it has.
+func DigestHandler(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r)
+
+	if r.Method == "POST" {
+		settings := digest.DefaultSettings(userID)
+		settings.Frequency = r.FormValue("frequency")
+		if settings.Frequency != digest.Off && settings.Frequency != digest.Daily && settings.Frequency != digest.Weekly {
+			http.Error(w, "Invalid frequency", http.StatusBadRequest)
+			return
+		}
+		if _, err := schedule.ParseClock(r.FormValue("send_time")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		settings.SendTime = r.FormValue("send_time")
+		weekday, err := strconv.Atoi(r.FormValue("weekday"))
+		if err != nil || weekday < 0 || weekday > 6 {
+			http.Error(w, "Invalid weekday", http.StatusBadRequest)
+			return
+		}
+		settings.Weekday = weekday
+
+		settings.Sections = nil
+		for _, s := range digest.Sections {
+			if r.FormValue("section_"+s) == "on" {
+				settings.Sections = append(settings.Sections, s)
+			}
+		}
+		if len(settings.Sections) == 0 {
+			http.Error(w, "Choose at least one section", http.StatusBadRequest)
+			return
+		}
+
+		if err := db.SaveDigestSettings(settings); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/digest", http.StatusSeeOther)
+		return
+	}
+
+	user, err := db.GetUserByID(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	org, err := db.GetOrganizationByID(user.OrganizationID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	settings, err := db.GetDigestSettings(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if settings == nil {
+		settings = digest.DefaultSettings(userID)
+	}
+
+	lang := getLanguage(r)
+	weekly := r.URL.Query().Get("period") == digest.Weekly
+	d, err := digest.Build(user.OrganizationID, settings.Sections, weekly, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Ticket lists of the sections that have one
+	lists := map[string][]*models.Ticket{
+		digest.SectionUnassigned: d.Unassigned,
+		digest.SectionSLA:        d.Breached,
+		digest.SectionWaiting:    d.Waiting,
+	}
+
+	chosen := make(map[string]bool)
+	for _, s := range settings.Sections {
+		chosen[s] = true
+	}
+
+	data := map[string]interface{}{
+		"Digest":       d,
+		"Lists":        lists,
+		"StatusLabels": statusLabels(user.OrganizationID, lang),
+		"Settings":     settings,
+		"Chosen":       chosen,
+		"Sections":     digest.Sections,
+		"Frequencies":  []string{digest.Off, digest.Daily, digest.Weekly},
+		"Weekdays":     []int{1, 2, 3, 4, 5, 6, 0},
+		"Timezone":     org.Timezone,
+		"Telegram":     user.TelegramID != nil,
+		"UserRole":     getUserRole(r),
+		"Lang":         lang,
+	}
+
+	renderTemplate(w, "digest.html", data)
+}
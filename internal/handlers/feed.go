@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"fmt"
+	"helpdesk/internal/auth"
+	"helpdesk/internal/db"
+	"helpdesk/internal/i18n"
+	"helpdesk/internal/ics"
+	"helpdesk/internal/models"
+	"helpdesk/internal/tickets"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// feedHistory is how far back the feed lists past appointments.
+const feedHistory = 30 * 24 * time.Hour
+
+// slaMarker is the length of the events marking SLA due dates.
+const slaMarker = 15 * time.Minute
+
+// agentFeed collects the agent's appointments and the SLA due dates of the
+// tickets assigned to them.
+func agentFeed(agent *models.User, lang string) ([]ics.Event, error) {
+	appointments, err := db.GetTicketEventsForAgent(agent.ID, time.Now().Add(-feedHistory))
+	if err != nil {
+		return nil, err
+	}
+
+	titles := make(map[int]string)
+	title := func(ticketID int) string {
+		if t, ok := titles[ticketID]; ok {
+			return t
+		}
+		t := ""
+		if ticket, err := db.GetTicketByID(ticketID); err == nil {
+			t = ticket.Title
+		}
+		titles[ticketID] = t
+		return t
+	}
+
+	var events []ics.Event
+	for _, a := range appointments {
+		summary := i18n.T(lang, "feed.appointment.visit", a.TicketID, title(a.TicketID))
+		if a.Kind == tickets.AppointmentCall {
+			summary = i18n.T(lang, "feed.appointment.call", a.TicketID, title(a.TicketID))
+		}
+		events = append(events, ics.Event{
+			UID:         fmt.Sprintf("appointment-%d@helpdesk", a.ID),
+			Start:       a.StartsAt,
+			End:         a.EndsAt,
+			Summary:     summary,
+			Description: i18n.T(lang, "feed.ticket", a.TicketID),
+			Cancelled:   a.Status == "cancelled",
+			Updated:     a.UpdatedAt,
+		})
+	}
+
+	assigned, err := db.GetTicketsByAgent(agent.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range assigned {
+		if t.FirstResponseDueAt != nil && t.FirstRespondedAt == nil {
+			events = append(events, ics.Event{
+				UID:         fmt.Sprintf("sla-first-response-%d@helpdesk", t.ID),
+				Start:       *t.FirstResponseDueAt,
+				End:         t.FirstResponseDueAt.Add(slaMarker),
+				Summary:     i18n.T(lang, "feed.sla.first_response", t.ID, t.Title),
+				Description: i18n.T(lang, "feed.sla.first_response_due", t.ID),
+				Updated:     t.UpdatedAt,
+			})
+		}
+		if t.ResolutionDueAt != nil && t.ResolvedAt == nil {
+			events = append(events, ics.Event{
+				UID:         fmt.Sprintf("sla-resolution-%d@helpdesk", t.ID),
+				Start:       *t.ResolutionDueAt,
+				End:         t.ResolutionDueAt.Add(slaMarker),
+				Summary:     i18n.T(lang, "feed.sla.resolution", t.ID, t.Title),
+				Description: i18n.T(lang, "feed.sla.resolution_due", t.ID),
+				Updated:     t.UpdatedAt,
+			})
+		}
+	}
+
+	return events, nil
+}
+
+// AgentFeedHandler serves an agent's ICS feed. The secret token in the URL is
+// the only credential, so calendar clients can subscribe without logging in.
+func AgentFeedHandler(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+	if token == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	agent, err := db.GetUserByICSToken(token)
+	if err != nil {
+		log.Printf("Error looking up ICS feed: %v", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	if agent == nil || agent.Role == "customer" {
+		http.NotFound(w, r)
+		return
+	}
+
+	lang, err := db.GetUserLanguage(agent.ID)
+	if err != nil {
+		lang = i18n.Default
+	}
+
+	events, err := agentFeed(agent, lang)
+	if err != nil {
+		log.Printf("Error building ICS feed for user %d: %v", agent.ID, err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	name := "Helpdesk"
+	if agent.FullName != nil && *agent.FullName != "" {
+		name = "Helpdesk — " + *agent.FullName
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := ics.Write(w, name, events); err != nil {
+		log.Printf("Error writing ICS feed for user %d: %v", agent.ID, err)
+	}
+}
+
+// FeedSettingsHandler lets agents turn their feed on, renew its secret address
+// or turn it off.
+func FeedSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r)
+
+	if r.Method == "POST" {
+		token := ""
+		if r.FormValue("action") != "revoke" {
+			var err error
+			if token, err = auth.GenerateSessionID(); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		if err := db.SetUserICSToken(userID, token); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/settings/feed", http.StatusSeeOther)
+		return
+	}
+
+	token, err := db.GetUserICSToken(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"UserRole": getUserRole(r),
+		"Lang":     getLanguage(r),
+	}
+	if token != "" {
+		scheme := "http"
+		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+		data["FeedURL"] = fmt.Sprintf("%s://%s/calendar/agent/%s.ics", scheme, r.Host, token)
+	}
+
+	renderTemplate(w, "feed.html", data)
+}
@@ -1,17 +1,45 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"helpdesk/internal/db"
+	"helpdesk/internal/i18n"
 	"helpdesk/internal/models"
+	"helpdesk/internal/richtext"
+	"helpdesk/internal/sla"
+	"helpdesk/internal/tickets"
 	"html/template"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
+	"time"
 )
 
-var templates *template.Template
+// templates holds one template set per language and page. Every page is parsed
+// together with base.html on its own so that their "content" blocks don't
+// override each other.
+var templates map[string]map[string]*template.Template
+
+var templateFuncs = template.FuncMap{
+	"deref": func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	},
+	"derefInt": func(i *int) int {
+		if i == nil {
+			return 0
+		}
+		return *i
+	},
+	// markdown renders the Markdown subset of agent replies, as the bot does
+	"markdown": func(s string) template.HTML {
+		return template.HTML(richtext.Markdown(s))
+	},
+}
 
 func InitTemplates() error {
 	tmplFiles, err := filepath.Glob("templates/*.html")
@@ -19,41 +47,121 @@ func InitTemplates() error {
 		return err
 	}
 
-	templates, err = template.ParseFiles(tmplFiles...)
-	return err
+	templates = make(map[string]map[string]*template.Template)
+	for _, lang := range i18n.Languages {
+		lang := lang
+		funcs := template.FuncMap{
+			"t": func(key string, args ...interface{}) string {
+				return i18n.T(lang, key, args...)
+			},
+		}
+
+		templates[lang] = make(map[string]*template.Template)
+		for _, file := range tmplFiles {
+			name := filepath.Base(file)
+			if name == "base.html" {
+				continue
+			}
+
+			tmpl, err := template.New(name).Funcs(templateFuncs).Funcs(funcs).ParseFiles("templates/base.html", file)
+			if err != nil {
+				return err
+			}
+			templates[lang][name] = tmpl
+		}
+	}
+
+	return nil
 }
 
+// renderTemplate renders the page in the language given as "Lang" in data.
 func renderTemplate(w http.ResponseWriter, tmpl string, data interface{}) {
-	if templates == nil {
+	lang := i18n.Default
+	if m, ok := data.(map[string]interface{}); ok {
+		if l, ok := m["Lang"].(string); ok && i18n.Supported(l) {
+			lang = l
+		}
+	}
+
+	t, ok := templates[lang][tmpl]
+	if !ok {
 		http.Error(w, "Templates not initialized", http.StatusInternalServerError)
 		return
 	}
 
-	err := templates.ExecuteTemplate(w, tmpl, data)
+	err := t.ExecuteTemplate(w, tmpl, data)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
 
+// webActor describes the logged in user as the author of a ticket change.
+func webActor(r *http.Request) tickets.Actor {
+	userID := getUserID(r)
+	return tickets.Actor{UserID: &userID, Role: getUserRole(r), Channel: tickets.ChannelWeb}
+}
+
+// displayNames maps user IDs to the name shown in the interface.
+func displayNames(users []*models.User) map[int]string {
+	names := make(map[int]string)
+	for _, u := range users {
+		switch {
+		case u.FullName != nil && *u.FullName != "":
+			names[u.ID] = *u.FullName
+		case u.Email != nil:
+			names[u.ID] = *u.Email
+		case u.Username != nil:
+			names[u.ID] = "@" + *u.Username
+		}
+	}
+	return names
+}
+
+// statusLabels maps every status code known to the organization to its label in lang.
+func statusLabels(orgID int, lang string) map[string]string {
+	labels := make(map[string]string)
+	statuses, err := tickets.Statuses(orgID)
+	if err != nil {
+		return labels
+	}
+	for _, s := range statuses {
+		labels[s.Code] = s.Label
+		if s.Label == "" {
+			labels[s.Code] = i18n.T(lang, "status."+s.Code)
+		}
+	}
+	return labels
+}
+
 func DashboardHandler(w http.ResponseWriter, r *http.Request) {
 	orgID := getOrganizationID(r)
 	userRole := getUserRole(r)
+	lang := getLanguage(r)
 
 	statusFilter := r.URL.Query().Get("status")
 	if statusFilter == "" {
 		statusFilter = "all"
 	}
 
-	tickets, err := db.GetTicketsByOrganization(orgID, statusFilter)
+	ticketList, err := db.GetTicketsByOrganization(orgID, statusFilter)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	now := time.Now()
+	slaStates := make(map[int]string)
+	for _, t := range ticketList {
+		slaStates[t.ID] = sla.State(t, now)
+	}
+
 	data := map[string]interface{}{
-		"Tickets":     tickets,
+		"Tickets":      ticketList,
+		"SLA":          slaStates,
 		"StatusFilter": statusFilter,
-		"UserRole":    userRole,
+		"StatusLabels": statusLabels(orgID, lang),
+		"UserRole":     userRole,
+		"Lang":         lang,
 	}
 
 	renderTemplate(w, "dashboard.html", data)
@@ -98,11 +206,58 @@ func TicketHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	allowedStatuses, err := tickets.AllowedStatuses(orgID, ticket.Status, webActor(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	userNames := displayNames(users)
+	lang := getLanguage(r)
+
+	timeline, err := tickets.Timeline(ticket, messages, userNames, lang)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	appointments, err := appointmentViews(ticketID, lang)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var category *models.TicketCategory
+	if ticket.CategoryID != nil {
+		category, _ = db.GetTicketCategory(orgID, *ticket.CategoryID)
+	}
+	fields, err := db.GetTicketFields(ticketID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rating, err := db.GetTicketRating(ticketID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	data := map[string]interface{}{
-		"Ticket":   ticket,
-		"Messages": messages,
-		"Users":    users,
-		"UserRole": getUserRole(r),
+		"Ticket":          ticket,
+		"Category":        category,
+		"Fields":          fields,
+		"StatusBase":      tickets.BaseStatus(orgID, ticket.Status),
+		"SLAState":        sla.State(ticket, time.Now()),
+		"StatusLabels":    statusLabels(orgID, lang),
+		"AllowedStatuses": allowedStatuses,
+		"Timeline":        timeline,
+		"Appointments":    appointments,
+		"Rating":          rating,
+		"UserNames":       userNames,
+		"Messages":        messages,
+		"Users":           users,
+		"UserRole":        getUserRole(r),
+		"Lang":            lang,
 	}
 
 	renderTemplate(w, "ticket.html", data)
@@ -149,14 +304,17 @@ func AddMessageHandler(w http.ResponseWriter, r *http.Request) {
 		IsFromCustomer: userRole == "customer",
 	}
 
-	if err := db.CreateMessage(message); err != nil {
+	if err := tickets.AddMessage(ticket, message, webActor(r)); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	// Update ticket status if needed
-	if ticket.Status == "open" && userRole != "customer" {
-		db.UpdateTicketStatus(ticketID, "in_progress")
+	if userRole != "customer" {
+		if err := tickets.StartWork(ticket, webActor(r)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 	}
 
 	http.Redirect(w, r, fmt.Sprintf("/ticket/%d", ticketID), http.StatusSeeOther)
@@ -199,7 +357,60 @@ func UpdateTicketStatusHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := db.UpdateTicketStatus(ticketID, status); err != nil {
+	if err := tickets.ChangeStatus(ticket, status, webActor(r)); err != nil {
+		if errors.Is(err, tickets.ErrInvalidTransition) || errors.Is(err, tickets.ErrUnknownStatus) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, tickets.ErrStatusChanged) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/ticket/%d", ticketID), http.StatusSeeOther)
+}
+
+func UpdateTicketPriorityHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ticketIDStr := r.FormValue("ticket_id")
+	ticketID, err := strconv.Atoi(ticketIDStr)
+	if err != nil {
+		http.Error(w, "Invalid ticket ID", http.StatusBadRequest)
+		return
+	}
+
+	priority := r.FormValue("priority")
+	if !models.IsValidPriority(priority) {
+		http.Error(w, "Invalid priority", http.StatusBadRequest)
+		return
+	}
+
+	ticket, err := db.GetTicketByID(ticketID)
+	if err != nil {
+		http.Error(w, "Ticket not found", http.StatusNotFound)
+		return
+	}
+
+	orgID := getOrganizationID(r)
+	if ticket.OrganizationID != orgID {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	userRole := getUserRole(r)
+	if userRole == "customer" {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	if err := tickets.ChangePriority(ticket, priority, webActor(r)); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -239,7 +450,7 @@ func AssignTicketHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := db.AssignTicket(ticketID, agentID); err != nil {
+	if err := tickets.Assign(ticket, agentID, webActor(r)); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
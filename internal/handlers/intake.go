@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"helpdesk/internal/db"
+	"helpdesk/internal/models"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// intakeCategory is a ticket category with its intake questions.
+type intakeCategory struct {
+	Category  *models.TicketCategory
+	Questions []*models.IntakeQuestion
+}
+
+// IntakeSettingsHandler lists the categories the bot offers on /start with
+// their questions and adds new categories.
+func IntakeSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	orgID := getOrganizationID(r)
+
+	if r.Method == "POST" {
+		name := strings.TrimSpace(r.FormValue("name"))
+		sortOrder, _ := strconv.Atoi(r.FormValue("sort_order"))
+		if name == "" || len([]rune(name)) > 100 {
+			http.Error(w, "Invalid category name", http.StatusBadRequest)
+			return
+		}
+
+		category := &models.TicketCategory{OrganizationID: orgID, Name: name, SortOrder: sortOrder}
+		if err := db.CreateTicketCategory(category); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, "/settings/intake", http.StatusSeeOther)
+		return
+	}
+
+	categories, err := db.GetTicketCategories(orgID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	questions, err := db.GetIntakeQuestions(orgID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var views []intakeCategory
+	for _, c := range categories {
+		view := intakeCategory{Category: c}
+		for _, q := range questions {
+			if q.CategoryID == c.ID {
+				view.Questions = append(view.Questions, q)
+			}
+		}
+		views = append(views, view)
+	}
+
+	data := map[string]interface{}{
+		"Categories": views,
+		"KindLabels": questionKindLabels,
+		"UserRole":   getUserRole(r),
+		"Lang":       getLanguage(r),
+	}
+
+	renderTemplate(w, "intake.html", data)
+}
+
+// questionKindLabels maps question kinds to the catalog keys of their names.
+var questionKindLabels = map[string]string{
+	models.QuestionText:     "web.intake.kind.text",
+	models.QuestionChoice:   "web.intake.kind.choice",
+	models.QuestionPriority: "web.intake.kind.priority",
+	models.QuestionContact:  "web.intake.kind.contact",
+}
+
+func DeleteCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := db.DeleteTicketCategory(getOrganizationID(r), id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings/intake", http.StatusSeeOther)
+}
+
+func AddIntakeQuestionHandler(w http.ResponseWriter, r *http.Request) {
+	orgID := getOrganizationID(r)
+
+	categoryID, err := strconv.Atoi(r.FormValue("category_id"))
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+	category, err := db.GetTicketCategory(orgID, categoryID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if category == nil {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+
+	q := &models.IntakeQuestion{
+		CategoryID: categoryID,
+		Label:      strings.TrimSpace(r.FormValue("label")),
+		Prompt:     strings.TrimSpace(r.FormValue("prompt")),
+		Kind:       r.FormValue("kind"),
+		Required:   r.FormValue("required") == "on",
+	}
+	q.SortOrder, _ = strconv.Atoi(r.FormValue("sort_order"))
+	for _, o := range strings.Split(r.FormValue("options"), "\n") {
+		if o = strings.TrimSpace(o); o != "" {
+			q.Options = append(q.Options, o)
+		}
+	}
+
+	if _, ok := questionKindLabels[q.Kind]; !ok || q.Label == "" || len([]rune(q.Label)) > 100 {
+		http.Error(w, "Invalid question", http.StatusBadRequest)
+		return
+	}
+	if q.Prompt == "" {
+		q.Prompt = q.Label + "?"
+	}
+	if q.Kind == models.QuestionChoice && len(q.Options) == 0 {
+		http.Error(w, "A choice question needs options", http.StatusBadRequest)
+		return
+	}
+	if q.Kind != models.QuestionChoice {
+		q.Options = nil
+	}
+
+	if err := db.CreateIntakeQuestion(q); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings/intake", http.StatusSeeOther)
+}
+
+func DeleteIntakeQuestionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid question ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := db.DeleteIntakeQuestion(getOrganizationID(r), id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings/intake", http.StatusSeeOther)
+}
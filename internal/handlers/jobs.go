@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"helpdesk/internal/db"
+	"helpdesk/internal/jobs"
+	"helpdesk/internal/models"
+	"net/http"
+	"time"
+)
+
+// jobRunsLimit is how many of the latest runs the jobs page shows.
+const jobRunsLimit = 100
+
+// jobView is a line of the jobs table.
+type jobView struct {
+	jobs.Status
+	LastRun *models.JobRun
+}
+
+// runView is a line of the run history.
+type runView struct {
+	*models.JobRun
+	Duration string // empty while running
+}
+
+// JobsHandler shows the background jobs with their last runs and the run
+// history, of one job if the job parameter is given.
+func JobsHandler(w http.ResponseWriter, r *http.Request) {
+	var list []jobView
+	for _, s := range jobs.Statuses() {
+		last, err := db.GetJobRuns(s.Name, 1)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		view := jobView{Status: s}
+		if len(last) > 0 {
+			view.LastRun = last[0]
+		}
+		list = append(list, view)
+	}
+
+	job := r.URL.Query().Get("job")
+	runs, err := db.GetJobRuns(job, jobRunsLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var views []runView
+	for _, run := range runs {
+		view := runView{JobRun: run}
+		if run.FinishedAt != nil {
+			view.Duration = run.FinishedAt.Sub(run.StartedAt).Round(time.Millisecond).String()
+		}
+		views = append(views, view)
+	}
+
+	data := map[string]interface{}{
+		"Jobs":     list,
+		"Job":      job,
+		"Runs":     views,
+		"UserRole": getUserRole(r),
+		"Lang":     getLanguage(r),
+	}
+
+	renderTemplate(w, "jobs.html", data)
+}
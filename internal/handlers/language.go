@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"helpdesk/internal/db"
+	"helpdesk/internal/i18n"
+	"net/http"
+)
+
+// languageOption is a language of the selects on the language page.
+type languageOption struct {
+	Code string
+	Name string
+}
+
+// LanguageSettingsHandler lets a user choose their interface language. Admins
+// also choose the organization's default, used by everyone who chose none
+// and for the texts of the operators' group.
+func LanguageSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r)
+	orgID := getOrganizationID(r)
+
+	if r.Method == "POST" {
+		var language *string
+		if v := r.FormValue("language"); v != "" {
+			if !i18n.Supported(v) {
+				http.Error(w, "Invalid language", http.StatusBadRequest)
+				return
+			}
+			language = &v
+		}
+		if err := db.UpdateUserLanguage(userID, language); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if v := r.FormValue("org_language"); v != "" && getUserRole(r) == "admin" {
+			if !i18n.Supported(v) {
+				http.Error(w, "Invalid language", http.StatusBadRequest)
+				return
+			}
+			if err := db.UpdateOrganizationLanguage(orgID, v); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		http.Redirect(w, r, "/settings/language", http.StatusSeeOther)
+		return
+	}
+
+	user, err := db.GetUserByID(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	org, err := db.GetOrganizationByID(orgID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var languages []languageOption
+	for _, code := range i18n.Languages {
+		languages = append(languages, languageOption{Code: code, Name: i18n.T(code, "language.name")})
+	}
+
+	data := map[string]interface{}{
+		"Languages":   languages,
+		"Language":    user.Language,
+		"OrgLanguage": org.Language,
+		"UserRole":    getUserRole(r),
+		"Lang":        getLanguage(r),
+	}
+
+	renderTemplate(w, "language.html", data)
+}
@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"fmt"
+	"helpdesk/internal/db"
+	"helpdesk/internal/i18n"
+	"helpdesk/internal/models"
+	"helpdesk/internal/schedule"
+	"helpdesk/internal/tickets"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var statusCodePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,49}$`)
+
+func StatusSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	orgID := getOrganizationID(r)
+
+	if r.Method == "POST" {
+		code := strings.TrimSpace(r.FormValue("code"))
+		label := strings.TrimSpace(r.FormValue("label"))
+		baseStatus := r.FormValue("base_status")
+		sortOrder, _ := strconv.Atoi(r.FormValue("sort_order"))
+
+		if !statusCodePattern.MatchString(code) || label == "" || !tickets.IsBaseStatus(baseStatus) {
+			http.Error(w, "Invalid status", http.StatusBadRequest)
+			return
+		}
+		if tickets.IsBaseStatus(code) {
+			http.Error(w, "Status code is reserved", http.StatusBadRequest)
+			return
+		}
+
+		status := &models.TicketStatus{
+			OrganizationID: orgID,
+			Code:           code,
+			Label:          label,
+			BaseStatus:     baseStatus,
+			SortOrder:      sortOrder,
+		}
+		if err := db.CreateTicketStatus(status); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, "/settings/statuses", http.StatusSeeOther)
+		return
+	}
+
+	statuses, err := tickets.Statuses(orgID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	org, err := db.GetOrganizationByID(orgID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	lang := getLanguage(r)
+
+	data := map[string]interface{}{
+		"Statuses":      statuses,
+		"StatusLabels":  statusLabels(orgID, lang),
+		"AutoCloseDays": org.AutoCloseDays,
+		"UserRole":      getUserRole(r),
+		"Lang":          lang,
+	}
+
+	renderTemplate(w, "statuses.html", data)
+}
+
+func DeleteStatusHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid status ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := db.DeleteTicketStatus(getOrganizationID(r), id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings/statuses", http.StatusSeeOther)
+}
+
+// AutoCloseSettingsHandler sets after how many days without a customer reply
+// resolved tickets are closed; 0 turns auto-closing off.
+func AutoCloseSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	days, err := strconv.Atoi(r.FormValue("auto_close_days"))
+	if err != nil || days < 0 || days > 365 {
+		http.Error(w, "Invalid number of days", http.StatusBadRequest)
+		return
+	}
+
+	if err := db.UpdateOrganizationAutoCloseDays(getOrganizationID(r), days); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings/statuses", http.StatusSeeOther)
+}
+
+func SLASettingsHandler(w http.ResponseWriter, r *http.Request) {
+	orgID := getOrganizationID(r)
+
+	if r.Method == "POST" {
+		for _, priority := range models.TicketPriorities {
+			policy := &models.SLAPolicy{
+				OrganizationID: orgID,
+				Priority:       priority,
+				BusinessHours:  r.FormValue("business_hours_"+priority) != "",
+			}
+
+			var err error
+			if policy.FirstResponseMinutes, err = optionalMinutes(r.FormValue("first_response_" + priority)); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if policy.ResolutionMinutes, err = optionalMinutes(r.FormValue("resolution_" + priority)); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			if err := db.SaveSLAPolicy(policy); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		http.Redirect(w, r, "/settings/sla", http.StatusSeeOther)
+		return
+	}
+
+	policies, err := db.GetSLAPolicies(orgID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	byPriority := make(map[string]*models.SLAPolicy)
+	for _, p := range policies {
+		byPriority[p.Priority] = p
+	}
+	var rows []*models.SLAPolicy
+	for _, priority := range models.TicketPriorities {
+		if p, ok := byPriority[priority]; ok {
+			rows = append(rows, p)
+		} else {
+			rows = append(rows, &models.SLAPolicy{OrganizationID: orgID, Priority: priority})
+		}
+	}
+
+	data := map[string]interface{}{
+		"Policies": rows,
+		"UserRole": getUserRole(r),
+		"Lang":     getLanguage(r),
+	}
+
+	renderTemplate(w, "sla.html", data)
+}
+
+// optionalMinutes parses a minutes field where an empty value means "no target".
+func optionalMinutes(v string) (*int, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return nil, nil
+	}
+	m, err := strconv.Atoi(v)
+	if err != nil || m <= 0 {
+		return nil, fmt.Errorf("invalid minutes value %q", v)
+	}
+	return &m, nil
+}
+
+// workingDay is a row of the business hours form.
+type workingDay struct {
+	Weekday int
+	Name    string
+	Enabled bool
+	Start   string
+	End     string
+}
+
+func BusinessHoursSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	orgID := getOrganizationID(r)
+	// Week starts on Monday in the form
+	order := []int{1, 2, 3, 4, 5, 6, 0}
+	lang := getLanguage(r)
+	name := func(wd int) string { return i18n.T(lang, fmt.Sprintf("weekday.%d", wd)) }
+
+	if r.Method == "POST" {
+		timezone := strings.TrimSpace(r.FormValue("timezone"))
+		if _, err := time.LoadLocation(timezone); err != nil || timezone == "" {
+			http.Error(w, "Invalid timezone", http.StatusBadRequest)
+			return
+		}
+
+		var hours []*models.BusinessHours
+		for _, wd := range order {
+			if r.FormValue(fmt.Sprintf("enabled_%d", wd)) == "" {
+				continue
+			}
+			start := r.FormValue(fmt.Sprintf("start_%d", wd))
+			end := r.FormValue(fmt.Sprintf("end_%d", wd))
+			startOffset, err := schedule.ParseClock(start)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			endOffset, err := schedule.ParseClock(end)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if endOffset <= startOffset {
+				http.Error(w, fmt.Sprintf("%s: end must be after start", name(wd)), http.StatusBadRequest)
+				return
+			}
+			hours = append(hours, &models.BusinessHours{OrganizationID: orgID, Weekday: wd, StartTime: start, EndTime: end})
+		}
+
+		if err := db.UpdateOrganizationTimezone(orgID, timezone); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := db.ReplaceBusinessHours(orgID, hours); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, "/settings/hours", http.StatusSeeOther)
+		return
+	}
+
+	org, err := db.GetOrganizationByID(orgID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	hours, err := db.GetBusinessHours(orgID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	byWeekday := make(map[int]*models.BusinessHours)
+	for _, h := range hours {
+		byWeekday[h.Weekday] = h
+	}
+
+	var days []workingDay
+	for _, wd := range order {
+		day := workingDay{Weekday: wd, Name: name(wd), Start: "09:00", End: "18:00"}
+		if h, ok := byWeekday[wd]; ok {
+			day.Enabled = true
+			day.Start = h.StartTime
+			day.End = h.EndTime
+		}
+		days = append(days, day)
+	}
+
+	holidays, err := db.GetHolidays(orgID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Timezone": org.Timezone,
+		"Days":     days,
+		"Holidays": holidays,
+		"UserRole": getUserRole(r),
+		"Lang":     lang,
+	}
+
+	renderTemplate(w, "hours.html", data)
+}
+
+func AddHolidayHandler(w http.ResponseWriter, r *http.Request) {
+	date, err := time.Parse("2006-01-02", r.FormValue("date"))
+	if err != nil {
+		http.Error(w, "Invalid date", http.StatusBadRequest)
+		return
+	}
+
+	if err := db.CreateHoliday(getOrganizationID(r), date, strings.TrimSpace(r.FormValue("name"))); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings/hours", http.StatusSeeOther)
+}
+
+func DeleteHolidayHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid holiday ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := db.DeleteHoliday(getOrganizationID(r), id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings/hours", http.StatusSeeOther)
+}
@@ -0,0 +1,190 @@
+// Package i18n holds the texts of the bot and the web interface. Every
+// language is a locales/<lang>.json file mapping message keys to fmt formats.
+package i18n
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Default is the language of organizations and users that chose none.
+const Default = "ru"
+
+// Languages lists the loaded languages, Default first.
+var Languages []string
+
+var catalogs = make(map[string]map[string]string)
+
+// Init loads locales/*.json and refuses catalogs that miss a key present in
+// another language or disagree on a message's arguments.
+func Init() error {
+	loaded, err := load("locales/*.json")
+	if err != nil {
+		return err
+	}
+
+	if err := check(loaded); err != nil {
+		return err
+	}
+
+	catalogs = loaded
+	Languages = nil
+	for lang := range loaded {
+		Languages = append(Languages, lang)
+	}
+	sort.Slice(Languages, func(i, j int) bool {
+		if Languages[i] == Default || Languages[j] == Default {
+			return Languages[i] == Default
+		}
+		return Languages[i] < Languages[j]
+	})
+	return nil
+}
+
+// load reads the catalogs matching pattern, keyed by language.
+func load(pattern string) (map[string]map[string]string, error) {
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	loaded := make(map[string]map[string]string)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		messages := make(map[string]string)
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		loaded[strings.TrimSuffix(filepath.Base(file), ".json")] = messages
+	}
+	return loaded, nil
+}
+
+// verbRE matches the fmt verbs of a message, "%%" included so that it can be skipped.
+var verbRE = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+func verbs(format string) []string {
+	var found []string
+	for _, v := range verbRE.FindAllString(format, -1) {
+		if v != "%%" {
+			found = append(found, v)
+		}
+	}
+	return found
+}
+
+// check verifies that every key exists in every language with the same fmt verbs.
+func check(loaded map[string]map[string]string) error {
+	if _, ok := loaded[Default]; !ok {
+		return fmt.Errorf("locales/%s.json not found", Default)
+	}
+
+	var problems []string
+	for lang, messages := range loaded {
+		for other, otherMessages := range loaded {
+			if other == lang {
+				continue
+			}
+			for key, format := range otherMessages {
+				text, ok := messages[key]
+				if !ok {
+					problems = append(problems, fmt.Sprintf("%s: missing %q", lang, key))
+					continue
+				}
+				if strings.Join(verbs(text), " ") != strings.Join(verbs(format), " ") {
+					problems = append(problems, fmt.Sprintf("%s: %q has arguments %v, %s has %v", lang, key, verbs(text), other, verbs(format)))
+				}
+			}
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("incomplete message catalogs:\n%s", strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// Supported reports whether lang is a loaded language.
+func Supported(lang string) bool {
+	_, ok := catalogs[lang]
+	return ok
+}
+
+// Normalize maps a language tag such as Telegram's language_code or an
+// Accept-Language entry ("en-US") to a loaded language, "" if there is none.
+func Normalize(tag string) string {
+	lang, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+	lang, _, _ = strings.Cut(lang, "_")
+	if Supported(lang) {
+		return lang
+	}
+	return ""
+}
+
+// Pick returns the first supported of the given languages, Default if none is.
+func Pick(langs ...string) string {
+	for _, lang := range langs {
+		if Supported(lang) {
+			return lang
+		}
+	}
+	return Default
+}
+
+// T renders the message key in lang, falling back to Default and then to the
+// key itself. Localizer arguments are rendered in the same language.
+func T(lang, key string, args ...interface{}) string {
+	format := Format(lang, key)
+	if len(args) == 0 {
+		return format
+	}
+
+	rendered := make([]interface{}, len(args))
+	for i, arg := range args {
+		if l, ok := arg.(Localizer); ok {
+			arg = l.In(lang)
+		}
+		rendered[i] = arg
+	}
+	return fmt.Sprintf(format, rendered...)
+}
+
+// Format returns the fmt format of the message key in lang, falling back to
+// Default and then to the key itself.
+func Format(lang, key string) string {
+	if format, ok := catalogs[lang][key]; ok {
+		return format
+	}
+	if format, ok := catalogs[Default][key]; ok {
+		return format
+	}
+	return key
+}
+
+// Localizer is text rendered in the language of its reader.
+type Localizer interface {
+	In(lang string) string
+}
+
+// Message is a catalog message with its arguments, for text composed before
+// its readers and their languages are known.
+type Message struct {
+	Key  string
+	Args []interface{}
+}
+
+func M(key string, args ...interface{}) Message {
+	return Message{Key: key, Args: args}
+}
+
+func (m Message) In(lang string) string {
+	return T(lang, m.Key, m.Args...)
+}
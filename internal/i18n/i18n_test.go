@@ -0,0 +1,139 @@
+package i18n
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func loadRepoCatalogs(t *testing.T) map[string]map[string]string {
+	t.Helper()
+	loaded, err := load("../../locales/*.json")
+	if err != nil {
+		t.Fatalf("loading catalogs: %v", err)
+	}
+	if len(loaded) < 2 {
+		t.Fatalf("found %d catalogs in locales/, want at least 2", len(loaded))
+	}
+	return loaded
+}
+
+func TestCatalogsAgree(t *testing.T) {
+	if err := check(loadRepoCatalogs(t)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckReportsProblems(t *testing.T) {
+	err := check(map[string]map[string]string{
+		"ru": {"a": "%d тикетов", "b": "есть"},
+		"en": {"a": "%s tickets"},
+	})
+	if err == nil {
+		t.Fatal("check accepted catalogs with a missing key and mismatched arguments")
+	}
+	for _, want := range []string{`en: missing "b"`, `"a" has arguments [%s]`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("check error does not mention %s:\n%v", want, err)
+		}
+	}
+}
+
+// keyRE matches a complete message key such as "bot.intake.skip". Literals
+// ending in a dot or an underscore are prefixes completed at run time and
+// are not checked.
+var keyRE = regexp.MustCompile(`^[a-z][a-z0-9_]*(\.[a-z0-9_]*[a-z0-9])+$`)
+
+// templateKeyRE matches the literal key of a {{t "key" ...}} call.
+var templateKeyRE = regexp.MustCompile(`\bt\s+"([^"]+)"`)
+
+// usedKeys collects the literal message keys in the Go sources under
+// internal/ and in templates/, mapped to where they are used. Go string
+// literals count as keys when they start with a prefix the catalogs use.
+func usedKeys(t *testing.T, prefixes map[string]bool) map[string]string {
+	t.Helper()
+	used := make(map[string]string)
+
+	fset := token.NewFileSet()
+	err := filepath.WalkDir("..", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return err
+		}
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return err
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			lit, ok := n.(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				return true
+			}
+			v, err := strconv.Unquote(lit.Value)
+			if err != nil || !keyRE.MatchString(v) || strings.HasSuffix(v, ".html") {
+				return true
+			}
+			prefix, _, _ := strings.Cut(v, ".")
+			if prefixes[prefix] {
+				used[v] = fset.Position(lit.Pos()).String()
+			}
+			return true
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("scanning Go sources: %v", err)
+	}
+
+	templates, err := filepath.Glob("../../templates/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range templates {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range templateKeyRE.FindAllStringSubmatch(string(data), -1) {
+			used[m[1]] = path
+		}
+	}
+	return used
+}
+
+func TestUsedKeysExist(t *testing.T) {
+	loaded := loadRepoCatalogs(t)
+
+	prefixes := make(map[string]bool)
+	for _, messages := range loaded {
+		for key := range messages {
+			prefix, _, _ := strings.Cut(key, ".")
+			prefixes[prefix] = true
+		}
+	}
+
+	used := usedKeys(t, prefixes)
+	if len(used) == 0 {
+		t.Fatal("found no message keys in the sources")
+	}
+
+	var missing []string
+	for key, where := range used {
+		for lang, messages := range loaded {
+			if _, ok := messages[key]; !ok {
+				missing = append(missing, where+": "+lang+" has no "+strconv.Quote(key))
+			}
+		}
+	}
+	sort.Strings(missing)
+	for _, m := range missing {
+		t.Error(m)
+	}
+}
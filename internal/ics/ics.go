@@ -0,0 +1,119 @@
+// Package ics reads and writes iCalendar (RFC 5545) data.
+package ics
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Event is a VEVENT.
+type Event struct {
+	UID         string
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Description string
+	Attendees   []string // email addresses
+	Cancelled   bool
+	Transparent bool // does not block time
+	Updated     time.Time
+}
+
+// escape escapes a TEXT value.
+func escape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return r.Replace(s)
+}
+
+// fold splits a content line into lines of at most 75 octets without
+// breaking UTF-8 sequences.
+func fold(line string) string {
+	var sb strings.Builder
+	n := 0
+	for _, r := range line {
+		size := len(string(r))
+		if n+size > 75 {
+			sb.WriteString("\r\n ")
+			n = 1
+		}
+		sb.WriteRune(r)
+		n += size
+	}
+	sb.WriteString("\r\n")
+	return sb.String()
+}
+
+func stamp(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+type writer struct {
+	sb strings.Builder
+}
+
+func (w *writer) line(format string, args ...interface{}) {
+	w.sb.WriteString(fold(fmt.Sprintf(format, args...)))
+}
+
+func (w *writer) event(e Event) {
+	updated := e.Updated
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+
+	w.line("BEGIN:VEVENT")
+	w.line("UID:%s", e.UID)
+	w.line("DTSTAMP:%s", stamp(updated))
+	w.line("DTSTART:%s", stamp(e.Start))
+	w.line("DTEND:%s", stamp(e.End))
+	w.line("SUMMARY:%s", escape(e.Summary))
+	if e.Description != "" {
+		w.line("DESCRIPTION:%s", escape(e.Description))
+	}
+	for _, email := range e.Attendees {
+		w.line("ATTENDEE;ROLE=REQ-PARTICIPANT:mailto:%s", email)
+	}
+	if e.Cancelled {
+		w.line("STATUS:CANCELLED")
+	} else {
+		w.line("STATUS:CONFIRMED")
+	}
+	if e.Transparent {
+		w.line("TRANSP:TRANSPARENT")
+	}
+	w.line("END:VEVENT")
+}
+
+// Write renders a published calendar feed named name with the given events.
+func Write(out io.Writer, name string, events []Event) error {
+	w := &writer{}
+	w.line("BEGIN:VCALENDAR")
+	w.line("VERSION:2.0")
+	w.line("PRODID:-//Helpdesk//Appointments//RU")
+	w.line("CALSCALE:GREGORIAN")
+	w.line("METHOD:PUBLISH")
+	w.line("X-WR-CALNAME:%s", escape(name))
+	for _, e := range events {
+		w.event(e)
+	}
+	w.line("END:VCALENDAR")
+
+	_, err := io.WriteString(out, w.sb.String())
+	return err
+}
+
+// WriteObject renders a calendar object resource holding a single event, as
+// stored on a CalDAV server.
+func WriteObject(out io.Writer, e Event) error {
+	w := &writer{}
+	w.line("BEGIN:VCALENDAR")
+	w.line("VERSION:2.0")
+	w.line("PRODID:-//Helpdesk//Appointments//RU")
+	w.event(e)
+	w.line("END:VCALENDAR")
+
+	_, err := io.WriteString(out, w.sb.String())
+	return err
+}
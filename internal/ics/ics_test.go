@@ -0,0 +1,81 @@
+package ics
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteObjectParseRoundTrip(t *testing.T) {
+	start := time.Date(2026, 10, 21, 11, 0, 0, 0, time.UTC)
+	events := []Event{
+		{
+			UID:         "a1b2c3",
+			Start:       start,
+			End:         start.Add(time.Hour),
+			Summary:     "Visit: #42 Printer; jams, again",
+			Description: "Ticket #42\n\nC:\\queue is stuck — " + strings.Repeat("длинный текст ", 10),
+			Attendees:   []string{"agent@example.com"},
+		},
+		{
+			UID:         "cancelled",
+			Start:       start,
+			End:         start.Add(30 * time.Minute),
+			Summary:     "Call",
+			Cancelled:   true,
+			Transparent: true,
+		},
+	}
+
+	for _, want := range events {
+		t.Run(want.UID, func(t *testing.T) {
+			var sb strings.Builder
+			if err := WriteObject(&sb, want); err != nil {
+				t.Fatalf("WriteObject: %v", err)
+			}
+			for _, line := range strings.Split(sb.String(), "\r\n") {
+				if len(line) > 75 {
+					t.Errorf("line longer than 75 octets: %q", line)
+				}
+			}
+
+			got, err := Parse(sb.String())
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if len(got) != 1 {
+				t.Fatalf("Parse returned %d events, want 1", len(got))
+			}
+			if !reflect.DeepEqual(got[0], want) {
+				t.Errorf("round trip:\n got %+v\nwant %+v", got[0], want)
+			}
+		})
+	}
+}
+
+func TestParseTimes(t *testing.T) {
+	data := "BEGIN:VCALENDAR\r\n" +
+		"BEGIN:VEVENT\r\nUID:tz\r\nDTSTART;TZID=Europe/Moscow:20261021T140000\r\nDTEND;TZID=Europe/Moscow:20261021T150000\r\n" +
+		"BEGIN:VALARM\r\nDTSTART:20261021T130000Z\r\nEND:VALARM\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nUID:day\r\nDTSTART;VALUE=DATE:20261022\r\nEND:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+
+	events, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Parse returned %d events, want 2", len(events))
+	}
+
+	if want := time.Date(2026, 10, 21, 11, 0, 0, 0, time.UTC); !events[0].Start.Equal(want) {
+		t.Errorf("TZID start = %v, want %v", events[0].Start, want)
+	}
+	if want := time.Date(2026, 10, 21, 12, 0, 0, 0, time.UTC); !events[0].End.Equal(want) {
+		t.Errorf("TZID end = %v, want %v", events[0].End, want)
+	}
+	if got := events[1].End.Sub(events[1].Start); got != 24*time.Hour {
+		t.Errorf("all-day event lasts %v, want 24h", got)
+	}
+}
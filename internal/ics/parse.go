@@ -0,0 +1,138 @@
+package ics
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// contentLine is a property such as DTSTART;TZID=Europe/Moscow:20261021T140000.
+type contentLine struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// unfold joins continuation lines and splits the data into content lines.
+func unfold(data string) []string {
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	var lines []string
+	for _, l := range strings.Split(data, "\n") {
+		if (strings.HasPrefix(l, " ") || strings.HasPrefix(l, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += l[1:]
+			continue
+		}
+		if l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
+
+func parseLine(l string) contentLine {
+	head, value, _ := strings.Cut(l, ":")
+	parts := strings.Split(head, ";")
+	cl := contentLine{name: strings.ToUpper(parts[0]), params: make(map[string]string), value: value}
+	for _, p := range parts[1:] {
+		k, v, _ := strings.Cut(p, "=")
+		cl.params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+	}
+	return cl
+}
+
+func unescape(s string) string {
+	r := strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+	return r.Replace(s)
+}
+
+// parseTime reads a DATE-TIME in UTC, with a TZID or floating (taken as
+// UTC), or a DATE.
+func parseTime(cl contentLine) (t time.Time, allDay bool, err error) {
+	loc := time.UTC
+	if tzid := cl.params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+
+	switch {
+	case cl.params["VALUE"] == "DATE" || len(cl.value) == 8:
+		t, err = time.ParseInLocation("20060102", cl.value, loc)
+		return t, true, err
+	case strings.HasSuffix(cl.value, "Z"):
+		t, err = time.Parse("20060102T150405Z", cl.value)
+	default:
+		t, err = time.ParseInLocation("20060102T150405", cl.value, loc)
+	}
+	return t, false, err
+}
+
+// Parse reads the VEVENTs of iCalendar data. Recurrence rules are not
+// expanded; events without an end last until their start (a day for all-day
+// events).
+func Parse(data string) ([]Event, error) {
+	var events []Event
+	var cur *Event
+	var hasEnd, allDay bool
+	depth := 0 // nesting inside the current VEVENT, e.g. VALARM
+
+	for _, l := range unfold(data) {
+		cl := parseLine(l)
+
+		switch {
+		case cl.name == "BEGIN" && strings.EqualFold(cl.value, "VEVENT"):
+			cur = &Event{}
+			hasEnd, allDay = false, false
+			depth = 0
+			continue
+		case cur == nil:
+			continue
+		case cl.name == "BEGIN":
+			depth++
+			continue
+		case cl.name == "END" && strings.EqualFold(cl.value, "VEVENT"):
+			if !hasEnd {
+				cur.End = cur.Start
+				if allDay {
+					cur.End = cur.Start.AddDate(0, 0, 1)
+				}
+			}
+			events = append(events, *cur)
+			cur = nil
+			continue
+		case cl.name == "END":
+			depth--
+			continue
+		case depth > 0:
+			continue
+		}
+
+		var err error
+		switch cl.name {
+		case "UID":
+			cur.UID = cl.value
+		case "SUMMARY":
+			cur.Summary = unescape(cl.value)
+		case "DESCRIPTION":
+			cur.Description = unescape(cl.value)
+		case "STATUS":
+			cur.Cancelled = strings.EqualFold(cl.value, "CANCELLED")
+		case "TRANSP":
+			cur.Transparent = strings.EqualFold(cl.value, "TRANSPARENT")
+		case "ATTENDEE":
+			if v := strings.TrimPrefix(strings.ToLower(cl.value), "mailto:"); v != "" {
+				cur.Attendees = append(cur.Attendees, v)
+			}
+		case "DTSTART":
+			cur.Start, allDay, err = parseTime(cl)
+		case "DTEND":
+			cur.End, _, err = parseTime(cl)
+			hasEnd = true
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", cl.name, cl.value, err)
+		}
+	}
+
+	return events, nil
+}
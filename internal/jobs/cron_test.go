@@ -0,0 +1,97 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// October 19, 2026 is a Monday
+	at := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2026, month, day, hour, min, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"90s", at(10, 19, 10, 0), at(10, 19, 10, 0).Add(90 * time.Second)},
+		{"@every 1h", at(10, 19, 10, 7), at(10, 19, 11, 7)},
+		{"@hourly", at(10, 19, 10, 7), at(10, 19, 11, 0)},
+		{"@daily", at(10, 19, 10, 0), at(10, 20, 0, 0)},
+		{"@weekly", at(10, 19, 10, 0), at(10, 25, 0, 0)},
+		{"@monthly", at(10, 19, 10, 0), at(11, 1, 0, 0)},
+
+		// The next run is strictly after the given time
+		{"30 10 * * *", at(10, 19, 10, 30), at(10, 20, 10, 30)},
+		{"30 10 * * *", at(10, 19, 10, 29).Add(30 * time.Second), at(10, 19, 10, 30)},
+
+		// Ranges, lists and steps
+		{"*/15 9-18 * * 1-5", at(10, 19, 8, 50), at(10, 19, 9, 0)},
+		{"*/15 9-18 * * 1-5", at(10, 19, 9, 1), at(10, 19, 9, 15)},
+		{"*/15 9-18 * * 1-5", at(10, 19, 18, 50), at(10, 20, 9, 0)},
+		{"*/15 9-18 * * 1-5", at(10, 23, 18, 45), at(10, 26, 9, 0)},
+		{"5/20 * * * *", at(10, 19, 10, 26), at(10, 19, 10, 45)},
+		{"0-30/10 * * * *", at(10, 19, 10, 31), at(10, 19, 11, 0)},
+		{"0 8,17 * * *", at(10, 19, 10, 0), at(10, 19, 17, 0)},
+		{"0 0 1 1,7 *", at(10, 19, 10, 0), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+
+		// Sunday is both 0 and 7
+		{"0 0 * * 0", at(10, 19, 10, 0), at(10, 25, 0, 0)},
+		{"0 0 * * 7", at(10, 19, 10, 0), at(10, 25, 0, 0)},
+		{"0 0 * * 5-7", at(10, 19, 10, 0), at(10, 23, 0, 0)},
+
+		// A restricted day of month and day of week match either
+		{"0 12 21 * 5", at(10, 19, 10, 0), at(10, 21, 12, 0)},
+		{"0 12 21 * 5", at(10, 21, 12, 0), at(10, 23, 12, 0)},
+		// With either unrestricted only the other counts
+		{"0 12 21 * *", at(10, 19, 10, 0), at(10, 21, 12, 0)},
+		{"0 12 * * 5", at(10, 19, 10, 0), at(10, 23, 12, 0)},
+		{"0 12 */10 * *", at(10, 19, 10, 0), at(10, 21, 12, 0)},
+
+		// Rare but possible dates
+		{"0 0 29 2 *", at(3, 1, 0, 0), time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", at(9, 1, 0, 0), at(10, 31, 0, 0)},
+	}
+
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.spec, err)
+			continue
+		}
+		if got := s.Next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("Parse(%q).Next(%v) = %v, want %v", tt.spec, tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"0s",
+		"-1m",
+		"@every 0s",
+		"@yearly",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"a * * * *",
+		"1-x * * * *",
+		// Impossible dates never match
+		"0 0 30 2 *",
+		"0 0 31 4,6,9,11 *",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) accepted an invalid schedule", spec)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+// Package jobs runs periodic background work such as SLA checks and calendar
+// sync. Every job has a cron-like schedule and runs on one instance only: the
+// one holding the job's Postgres advisory lock, which another instance takes
+// over when the holder goes away. Runs are recorded in job_runs.
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"helpdesk/internal/db"
+	"helpdesk/internal/models"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// RunRetention is how long the history of job runs is kept, see CleanupRuns.
+const RunRetention = 14 * 24 * time.Hour
+
+// Job is a registered background job.
+type Job struct {
+	Name     string
+	Spec     string
+	schedule Schedule
+	run      func(ctx context.Context) error
+	lockKey  int64
+
+	mu   sync.Mutex
+	next time.Time
+	// conn holds the job's lock while this instance runs the job
+	conn *sql.Conn
+}
+
+// Status is what this instance knows about a job.
+type Status struct {
+	Name    string
+	Spec    string
+	Next    time.Time
+	Leading bool // this instance holds the job's lock
+}
+
+var (
+	registered []*Job
+	instance   = instanceName()
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+)
+
+// instanceName identifies this process in the run history.
+func instanceName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// Register adds a job to run on the schedule spec, see Parse. Jobs are
+// registered before Start; names must be unique as they name the lock.
+func Register(name, spec string, run func(ctx context.Context) error) error {
+	schedule, err := Parse(spec)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", name, err)
+	}
+	for _, j := range registered {
+		if j.Name == name {
+			return fmt.Errorf("job %s is already registered", name)
+		}
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte("helpdesk/jobs/" + name))
+	registered = append(registered, &Job{
+		Name:     name,
+		Spec:     spec,
+		schedule: schedule,
+		run:      run,
+		lockKey:  int64(h.Sum64()),
+	})
+	return nil
+}
+
+// Start runs the registered jobs in the background until Stop.
+func Start() {
+	var ctx context.Context
+	ctx, cancel = context.WithCancel(context.Background())
+	for _, j := range registered {
+		wg.Add(1)
+		go j.loop(ctx)
+	}
+	log.Printf("Started %d background job(s) on %s", len(registered), instance)
+}
+
+// Stop cancels the jobs and waits for running ones to return and release
+// their locks, or until ctx is done.
+func Stop(ctx context.Context) error {
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Statuses lists the registered jobs.
+func Statuses() []Status {
+	var list []Status
+	for _, j := range registered {
+		j.mu.Lock()
+		list = append(list, Status{Name: j.Name, Spec: j.Spec, Next: j.next, Leading: j.conn != nil})
+		j.mu.Unlock()
+	}
+	return list
+}
+
+func (j *Job) loop(ctx context.Context) {
+	defer wg.Done()
+	defer j.release()
+
+	for {
+		next := j.schedule.Next(time.Now())
+		j.mu.Lock()
+		j.next = next
+		j.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if j.lead(ctx) {
+			j.execute(ctx)
+		}
+	}
+}
+
+// lead reports whether this instance holds the job's lock, taking it if it
+// is free.
+func (j *Job) lead(ctx context.Context) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.conn != nil {
+		err := j.conn.PingContext(ctx)
+		if err == nil {
+			return true
+		}
+		// The session, and with it the lock, is gone
+		log.Printf("Lost the lock of job %s: %v", j.Name, err)
+		j.conn.Close()
+		j.conn = nil
+	}
+
+	conn, err := db.LockJob(ctx, j.lockKey)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			log.Printf("Error taking the lock of job %s: %v", j.Name, err)
+		}
+		return false
+	}
+	if conn == nil {
+		return false
+	}
+	j.conn = conn
+	log.Printf("Job %s now runs on this instance", j.Name)
+
+	// Runs of the previous holder that never finished
+	if err := db.FailUnfinishedJobRuns(j.Name, "interrupted"); err != nil {
+		log.Printf("Error closing unfinished runs of job %s: %v", j.Name, err)
+	}
+	return true
+}
+
+func (j *Job) release() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.conn == nil {
+		return
+	}
+	if err := db.UnlockJob(j.conn, j.lockKey); err != nil {
+		log.Printf("Error releasing the lock of job %s: %v", j.Name, err)
+	}
+	j.conn = nil
+}
+
+func (j *Job) execute(ctx context.Context) {
+	run := &models.JobRun{JobName: j.Name, Instance: instance}
+	if err := db.CreateJobRun(run); err != nil {
+		log.Printf("Error recording run of job %s: %v", j.Name, err)
+		run = nil
+	}
+
+	err := j.safeRun(ctx)
+	if err != nil {
+		log.Printf("Job %s failed: %v", j.Name, err)
+	}
+
+	if run != nil {
+		if err := db.FinishJobRun(run.ID, err); err != nil {
+			log.Printf("Error recording end of job %s: %v", j.Name, err)
+		}
+	}
+}
+
+func (j *Job) safeRun(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return j.run(ctx)
+}
+
+// CleanupRuns deletes the history of runs older than RunRetention.
+func CleanupRuns(ctx context.Context) error {
+	n, err := db.DeleteJobRunsBefore(time.Now().Add(-RunRetention))
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.Printf("Deleted %d old job run(s)", n)
+	}
+	return nil
+}
@@ -7,6 +7,11 @@ type Organization struct {
 	Name            string    `json:"name"`
 	TelegramChatID  *int64    `json:"telegram_chat_id"`
 	GoogleCalendarID *string  `json:"google_calendar_id"`
+	CalendarProvider string   `json:"calendar_provider"` // google, caldav
+	Timezone        string    `json:"timezone"`
+	Language        string    `json:"language"`
+	CSATAutoClose   bool      `json:"csat_auto_close"` // close resolved tickets once rated
+	AutoCloseDays   int       `json:"auto_close_days"` // 0: resolved tickets stay resolved
 	CreatedAt       time.Time `json:"created_at"`
 	UpdatedAt       time.Time `json:"updated_at"`
 }
@@ -21,6 +26,7 @@ type User struct {
 	Role           string    `json:"role"`
 	FullName       *string   `json:"full_name"`
 	IsActive       bool      `json:"is_active"`
+	Language       *string   `json:"language"` // nil: the organization's default
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
 }
@@ -36,8 +42,35 @@ type Ticket struct {
 	Priority        string    `json:"priority"`
 	TelegramMessageID *int    `json:"telegram_message_id"`
 	TelegramChatID  *int64    `json:"telegram_chat_id"`
+	CategoryID      *int      `json:"category_id"`
 	CreatedAt       time.Time `json:"created_at"`
 	UpdatedAt       time.Time `json:"updated_at"`
+
+	// SLA timers, set from the organization's policy for the ticket priority
+	FirstResponseDueAt *time.Time `json:"first_response_due_at"`
+	ResolutionDueAt    *time.Time `json:"resolution_due_at"`
+	FirstRespondedAt   *time.Time `json:"first_responded_at"`
+	ResolvedAt         *time.Time `json:"resolved_at"`
+
+	// When operators were warned that a timer is about to expire and when
+	// they were told it has
+	FirstResponseWarnedAt         *time.Time `json:"first_response_warned_at"`
+	ResolutionWarnedAt            *time.Time `json:"resolution_warned_at"`
+	FirstResponseBreachNotifiedAt *time.Time `json:"first_response_breach_notified_at"`
+	ResolutionBreachNotifiedAt    *time.Time `json:"resolution_breach_notified_at"`
+}
+
+// TicketPriorities lists the allowed ticket priorities from lowest to highest.
+var TicketPriorities = []string{"low", "medium", "high", "urgent"}
+
+// IsValidPriority reports whether p is one of TicketPriorities.
+func IsValidPriority(p string) bool {
+	for _, v := range TicketPriorities {
+		if v == p {
+			return true
+		}
+	}
+	return false
 }
 
 type Message struct {
@@ -47,6 +80,7 @@ type Message struct {
 	Content          string    `json:"content"`
 	TelegramMessageID *int     `json:"telegram_message_id"`
 	IsFromCustomer   bool      `json:"is_from_customer"`
+	IsSystem         bool      `json:"is_system"` // written by the helpdesk itself
 	CreatedAt        time.Time `json:"created_at"`
 }
 
@@ -67,6 +101,208 @@ type GoogleCalendarToken struct {
 	RefreshToken   *string   `json:"-"`
 	TokenType      *string   `json:"token_type"`
 	Expiry         *time.Time `json:"expiry"`
+	BrokenAt       *time.Time `json:"broken_at"` // refresh token rejected by Google
+	BrokenReason   *string    `json:"broken_reason"`
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
 }
+
+type TicketStatus struct {
+	ID             int       `json:"id"`
+	OrganizationID int       `json:"organization_id"`
+	Code           string    `json:"code"`
+	Label          string    `json:"label"`
+	BaseStatus     string    `json:"base_status"`
+	SortOrder      int       `json:"sort_order"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type TicketStatusChange struct {
+	ID         int       `json:"id"`
+	TicketID   int       `json:"ticket_id"`
+	FromStatus *string   `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	ChangedBy  *int      `json:"changed_by"`
+	Channel    string    `json:"channel"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type AuditEvent struct {
+	ID             int       `json:"id"`
+	OrganizationID int       `json:"organization_id"`
+	TicketID       *int      `json:"ticket_id"`
+	ActorID        *int      `json:"actor_id"`
+	Channel        string    `json:"channel"`
+	Action         string    `json:"action"`
+	Before         *string   `json:"before"`
+	After          *string   `json:"after"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type SLAPolicy struct {
+	ID                   int       `json:"id"`
+	OrganizationID       int       `json:"organization_id"`
+	Priority             string    `json:"priority"`
+	FirstResponseMinutes *int      `json:"first_response_minutes"`
+	ResolutionMinutes    *int      `json:"resolution_minutes"`
+	BusinessHours        bool      `json:"business_hours"`
+	CreatedAt            time.Time `json:"created_at"`
+	UpdatedAt            time.Time `json:"updated_at"`
+}
+
+type BusinessHours struct {
+	ID             int    `json:"id"`
+	OrganizationID int    `json:"organization_id"`
+	Weekday        int    `json:"weekday"`    // 0 = Sunday
+	StartTime      string `json:"start_time"` // HH:MM
+	EndTime        string `json:"end_time"`   // HH:MM
+}
+
+type Holiday struct {
+	ID             int       `json:"id"`
+	OrganizationID int       `json:"organization_id"`
+	Date           time.Time `json:"date"`
+	Name           *string   `json:"name"`
+}
+
+// TicketEvent is an appointment scheduled from a ticket.
+type TicketEvent struct {
+	ID              int       `json:"id"`
+	TicketID        int       `json:"ticket_id"`
+	OrganizationID  int       `json:"organization_id"`
+	ExternalEventID *string   `json:"external_event_id"` // ID in the organization's calendar provider
+	Kind            string    `json:"kind"`              // visit, call
+	StartsAt        time.Time `json:"starts_at"`
+	EndsAt          time.Time `json:"ends_at"`
+	Status          string    `json:"status"` // scheduled, cancelled
+	AgentID         *int      `json:"agent_id"`
+	CreatedBy       *int      `json:"created_by"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// CalDAVAccount is the CalDAV calendar collection an organization's
+// appointments are stored in.
+type CalDAVAccount struct {
+	OrganizationID int       `json:"organization_id"`
+	CalendarURL    string    `json:"calendar_url"`
+	Username       string    `json:"username"`
+	Password       string    `json:"-"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type TicketCategory struct {
+	ID             int       `json:"id"`
+	OrganizationID int       `json:"organization_id"`
+	Name           string    `json:"name"`
+	SortOrder      int       `json:"sort_order"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Intake question kinds.
+const (
+	QuestionText     = "text"
+	QuestionChoice   = "choice"
+	QuestionPriority = "priority"
+	QuestionContact  = "contact"
+)
+
+// IntakeQuestion is asked by the bot when a customer opens a ticket in its category.
+type IntakeQuestion struct {
+	ID         int       `json:"id"`
+	CategoryID int       `json:"category_id"`
+	Label      string    `json:"label"`  // field name on the ticket, e.g. "Устройство"
+	Prompt     string    `json:"prompt"` // question shown to the customer
+	Kind       string    `json:"kind"`
+	Options    []string  `json:"options"` // choices of a choice question
+	Required   bool      `json:"required"`
+	SortOrder  int       `json:"sort_order"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// TicketField is an answer given during intake.
+type TicketField struct {
+	ID        int    `json:"id"`
+	TicketID  int    `json:"ticket_id"`
+	Label     string `json:"label"`
+	Value     string `json:"value"`
+	SortOrder int    `json:"sort_order"`
+}
+
+// TicketRating is the customer's satisfaction rating of a resolved ticket.
+type TicketRating struct {
+	TicketID       int       `json:"ticket_id"`
+	OrganizationID int       `json:"organization_id"`
+	CustomerID     *int      `json:"customer_id"`
+	AgentID        *int      `json:"agent_id"` // the ticket's agent when it was rated
+	Score          int       `json:"score"`    // 1 to 5
+	Comment        *string   `json:"comment"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// CSATStats aggregates the ratings of an organization or an agent.
+type CSATStats struct {
+	Count   int     `json:"count"`
+	Average float64 `json:"average"`
+	Scores  [5]int  `json:"scores"` // number of ratings per score, 1 first
+}
+
+// AgentCSAT is an agent's line of the CSAT report.
+type AgentCSAT struct {
+	AgentID *int   `json:"agent_id"` // nil for tickets rated without an agent
+	Name    string `json:"name"`
+	CSATStats
+}
+
+// JobRun is one run of a background job.
+type JobRun struct {
+	ID         int        `json:"id"`
+	JobName    string     `json:"job_name"`
+	Instance   string     `json:"instance"` // host:pid of the process that ran it
+	Status     string     `json:"status"`   // running, succeeded, failed
+	Error      *string    `json:"error"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+// DigestSettings is an operator's choice of the ticket digest the bot sends.
+type DigestSettings struct {
+	UserID     int        `json:"user_id"`
+	Frequency  string     `json:"frequency"` // off, daily, weekly
+	SendTime   string     `json:"send_time"` // HH:MM in the organization's timezone
+	Weekday    int        `json:"weekday"`   // 0 = Sunday, for weekly digests
+	Sections   []string   `json:"sections"`
+	LastSentAt *time.Time `json:"last_sent_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// Digest summarizes an organization's tickets for an operator.
+type Digest struct {
+	OrganizationID int       `json:"organization_id"`
+	Weekly         bool      `json:"weekly"`
+	Sections       []string  `json:"sections"`
+	GeneratedAt    time.Time `json:"generated_at"`
+
+	Ages       [4]int    `json:"ages"` // active tickets younger than 1, 3, 7 days and older
+	Oldest     []*Ticket `json:"oldest"`
+	Unassigned []*Ticket `json:"unassigned"`
+	Breached   []*Ticket `json:"breached"` // active tickets with a breached SLA timer
+	Waiting    []*Ticket `json:"waiting"`  // active tickets last answered by an agent
+	Resolved   int       `json:"resolved"`
+	// ResolvedFrom and ResolvedTo bound the period of Resolved: the day before
+	// a daily digest, the seven days before a weekly one
+	ResolvedFrom time.Time `json:"resolved_from"`
+	ResolvedTo   time.Time `json:"resolved_to"`
+}
+
+// Includes reports whether the digest shows the section.
+func (d *Digest) Includes(section string) bool {
+	for _, s := range d.Sections {
+		if s == section {
+			return true
+		}
+	}
+	return false
+}
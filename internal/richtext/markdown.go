@@ -0,0 +1,204 @@
+package richtext
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Markdown renders the subset of Markdown agents may use in replies:
+//
+//	**bold**  *italic*  _italic_  ~~strikethrough~~  `code`
+//	[text](https://example.com)
+//	```
+//	preformatted block
+//	```
+//
+// Everything else, unclosed markers included, is shown as written.
+func Markdown(s string) HTML {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	lines := strings.Split(s, "\n")
+
+	var out []string
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) > 0 {
+			out = append(out, inline(strings.Join(paragraph, "\n")))
+			paragraph = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		if strings.HasPrefix(strings.TrimSpace(lines[i]), "```") {
+			if end := closingFence(lines, i+1); end > 0 {
+				flush()
+				out = append(out, "<pre>"+string(Escape(strings.Join(lines[i+1:end], "\n")))+"</pre>")
+				i = end
+				continue
+			}
+		}
+		paragraph = append(paragraph, lines[i])
+	}
+	flush()
+
+	return HTML(strings.Join(out, "\n"))
+}
+
+// closingFence returns the line closing a code block opened before from, 0 if there is none.
+func closingFence(lines []string, from int) int {
+	for i := from; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == "```" {
+			return i
+		}
+	}
+	return 0
+}
+
+// spans are the emphasis markers, longer ones first so that "**" is not
+// taken for two "*".
+var spans = []struct {
+	marker string
+	tag    string
+}{
+	{"**", "b"},
+	{"~~", "s"},
+	{"*", "i"},
+	{"_", "i"},
+}
+
+// linkSchemes are the URL schemes allowed in links.
+var linkSchemes = []string{"https://", "http://", "mailto:", "tg://"}
+
+func inline(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		rest := s[i:]
+
+		if rest[0] == '`' {
+			if end := strings.IndexByte(rest[1:], '`'); end > 0 {
+				b.WriteString("<code>" + string(Escape(rest[1:1+end])) + "</code>")
+				i += end + 2
+				continue
+			}
+		}
+
+		if rest[0] == '[' {
+			if text, url, n, ok := link(rest); ok {
+				b.WriteString(`<a href="` + escapeAttr(url) + `">` + inline(text) + "</a>")
+				i += n
+				continue
+			}
+		}
+
+		if n, ok := span(&b, s, i); ok {
+			i += n
+			continue
+		}
+
+		_, size := utf8.DecodeRuneInString(rest)
+		b.WriteString(string(Escape(rest[:size])))
+		i += size
+	}
+	return b.String()
+}
+
+// span writes the emphasis starting at s[i], if any, and returns its length.
+func span(b *strings.Builder, s string, i int) (int, bool) {
+	for _, sp := range spans {
+		if !strings.HasPrefix(s[i:], sp.marker) {
+			continue
+		}
+		open := i + len(sp.marker)
+		if len(sp.marker) == 1 && open < len(s) && s[open] == sp.marker[0] {
+			// "__init__" is a name, not an emphasis
+			b.WriteString(string(Escape(s[i : open+1])))
+			return 2, true
+		}
+		if !opens(s, i, open) {
+			// A marker that does not open is shown as written
+			b.WriteString(string(Escape(sp.marker)))
+			return len(sp.marker), true
+		}
+		for from := open + 1; from < len(s); {
+			j := strings.Index(s[from:], sp.marker)
+			if j < 0 {
+				break
+			}
+			j += from
+			if closes(s, j, j+len(sp.marker)) && s[j-1] != sp.marker[0] {
+				b.WriteString("<" + sp.tag + ">" + inline(s[open:j]) + "</" + sp.tag + ">")
+				return j + len(sp.marker) - i, true
+			}
+			from = j + 1
+		}
+		b.WriteString(string(Escape(sp.marker)))
+		return len(sp.marker), true
+	}
+	return 0, false
+}
+
+// opens reports whether the marker at s[start:end] can open an emphasis: it
+// is followed by a non-space and does not stand inside a word.
+func opens(s string, start, end int) bool {
+	if end >= len(s) {
+		return false
+	}
+	next, _ := utf8.DecodeRuneInString(s[end:])
+	if unicode.IsSpace(next) {
+		return false
+	}
+	if start > 0 {
+		prev, _ := utf8.DecodeLastRuneInString(s[:start])
+		if isWordRune(prev) {
+			return false
+		}
+	}
+	return true
+}
+
+// closes reports whether the marker at s[start:end] can close an emphasis:
+// it follows a non-space and is not followed by a word.
+func closes(s string, start, end int) bool {
+	prev, _ := utf8.DecodeLastRuneInString(s[:start])
+	if unicode.IsSpace(prev) {
+		return false
+	}
+	if end < len(s) {
+		next, _ := utf8.DecodeRuneInString(s[end:])
+		if isWordRune(next) {
+			return false
+		}
+	}
+	return true
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// link parses "[text](url)" at the start of s and returns its length.
+func link(s string) (text, url string, n int, ok bool) {
+	mid := strings.Index(s, "](")
+	if mid < 0 || strings.ContainsAny(s[1:mid], "\n[") {
+		return "", "", 0, false
+	}
+	end := strings.IndexByte(s[mid+2:], ')')
+	if end < 0 {
+		return "", "", 0, false
+	}
+	text, url = s[1:mid], s[mid+2:mid+2+end]
+	if text == "" || strings.ContainsAny(url, " \n") || !allowedURL(url) {
+		return "", "", 0, false
+	}
+	return text, url, mid + 3 + end, true
+}
+
+func allowedURL(url string) bool {
+	lower := strings.ToLower(url)
+	for _, scheme := range linkSchemes {
+		if strings.HasPrefix(lower, scheme) && len(lower) > len(scheme) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package richtext
+
+import "testing"
+
+func TestMarkdown(t *testing.T) {
+	tests := []struct {
+		in   string
+		want HTML
+	}{
+		{"plain", "plain"},
+		{"**bold** *italic* _italic_ ~~gone~~", "<b>bold</b> <i>italic</i> <i>italic</i> <s>gone</s>"},
+		{"`a <b> & c`", "<code>a &lt;b&gt; &amp; c</code>"},
+		{"`**not bold**`", "<code>**not bold**</code>"},
+
+		// Nested markers
+		{"**bold _and italic_**", "<b>bold <i>and italic</i></b>"},
+		{"_italic **and bold**_", "<i>italic <b>and bold</b></i>"},
+		{"~~**both**~~", "<s><b>both</b></s>"},
+
+		// Unclosed markers are shown as written
+		{"**bold", "**bold"},
+		{"*italic", "*italic"},
+		{"a ~~b", "a ~~b"},
+		{"`code", "`code"},
+		{"**bold *italic**", "<b>bold *italic</b>"},
+
+		// Markers that do not open or close an emphasis
+		{"2 * 3 * 4", "2 * 3 * 4"},
+		{"snake_case_name", "snake_case_name"},
+		{"__init__", "__init__"},
+		{"file_name.go and _this_", "file_name.go and <i>this</i>"},
+		{"*not closed *", "*not closed *"},
+		{"**", "**"},
+
+		// Links
+		{"[site](https://example.com)", `<a href="https://example.com">site</a>`},
+		{"see [**docs**](http://example.com/a?b=1&c=2).", `see <a href="http://example.com/a?b=1&amp;c=2"><b>docs</b></a>.`},
+		{`[q](https://example.com/"x")`, `<a href="https://example.com/&quot;x&quot;">q</a>`},
+		{"[mail](mailto:help@example.com)", `<a href="mailto:help@example.com">mail</a>`},
+		{"[x](javascript:alert(1))", "[x](javascript:alert(1))"},
+		{"[x](JavaScript:alert(1))", "[x](JavaScript:alert(1))"},
+		{"[x](data:text/html,<b>)", "[x](data:text/html,&lt;b&gt;)"},
+		{"[x](/relative)", "[x](/relative)"},
+		{"[x](https://)", "[x](https://)"},
+		{"[](https://example.com)", "[](https://example.com)"},
+		{"[x](https://exa mple.com)", "[x](https://exa mple.com)"},
+
+		// HTML in the input is escaped
+		{"<script>alert(1)</script>", "&lt;script&gt;alert(1)&lt;/script&gt;"},
+		{"**<i>**", "<b>&lt;i&gt;</b>"},
+		{"a &amp; b", "a &amp;amp; b"},
+
+		// Code blocks
+		{"```\nif a < b {\n    **x**\n}\n```", "<pre>if a &lt; b {\n    **x**\n}</pre>"},
+		{"before\n```go\ncode\n```\nafter *it*", "before\n<pre>code</pre>\nafter <i>it</i>"},
+		{"```\nunclosed", "```\nunclosed"},
+		{"line one\r\nline two", "line one\nline two"},
+	}
+	for _, tt := range tests {
+		if got := Markdown(tt.in); got != tt.want {
+			t.Errorf("Markdown(%q)\n got %q\nwant %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+// Package richtext builds text in the HTML subset understood by Telegram
+// (b, i, s, code, pre and a). The same markup is valid HTML for the web
+// interface, so messages look alike in both.
+package richtext
+
+import "strings"
+
+// HTML is text in the Telegram HTML subset, with user content escaped.
+type HTML string
+
+var escaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// Escape turns plain text into HTML showing it as is.
+func Escape(s string) HTML {
+	return HTML(escaper.Replace(s))
+}
+
+// escapeAttr escapes an attribute value written in double quotes.
+func escapeAttr(s string) string {
+	return strings.ReplaceAll(escaper.Replace(s), `"`, "&quot;")
+}
+
+// Bold shows plain text in bold.
+func Bold(s string) HTML {
+	return "<b>" + Escape(s) + "</b>"
+}
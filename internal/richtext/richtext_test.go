@@ -0,0 +1,30 @@
+package richtext
+
+import "testing"
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		in   string
+		want HTML
+	}{
+		{"", ""},
+		{"plain text", "plain text"},
+		{"a < b && c > d", "a &lt; b &amp;&amp; c &gt; d"},
+		{"<b>not bold</b>", "&lt;b&gt;not bold&lt;/b&gt;"},
+		{"&amp; stays literal", "&amp;amp; stays literal"},
+		{`"quotes" and 'apostrophes'`, `"quotes" and 'apostrophes'`},
+		{"Привет 😀", "Привет 😀"},
+	}
+	for _, tt := range tests {
+		if got := Escape(tt.in); got != tt.want {
+			t.Errorf("Escape(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	if got, want := Bold("<x>"), HTML("<b>&lt;x&gt;</b>"); got != want {
+		t.Errorf("Bold(%q) = %q, want %q", "<x>", got, want)
+	}
+	if got, want := escapeAttr(`a"b<c&`), `a&quot;b&lt;c&amp;`; got != want {
+		t.Errorf("escapeAttr = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,149 @@
+package richtext
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Len is the length of h in UTF-16 code units, the unit of Telegram's
+// message limits. Markup is counted too, so a text whose Len fits the limit
+// always fits after Telegram parses it.
+func Len(h HTML) int {
+	n := 0
+	for _, r := range string(h) {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// token is a tag, an entity or a single character of HTML.
+type token struct {
+	text string
+	tag  string // name of the tag, "" for text
+	open bool
+}
+
+func tokenize(h HTML) []token {
+	s := string(h)
+	var tokens []token
+	for i := 0; i < len(s); {
+		var t token
+		switch s[i] {
+		case '<':
+			if end := strings.IndexByte(s[i:], '>'); end > 0 {
+				t.text = s[i : i+end+1]
+				name := strings.TrimPrefix(t.text[1:len(t.text)-1], "/")
+				if sp := strings.IndexByte(name, ' '); sp >= 0 {
+					name = name[:sp]
+				}
+				t.tag, t.open = name, t.text[1] != '/'
+			}
+		case '&':
+			if end := strings.IndexByte(s[i:], ';'); end > 0 && end <= 8 {
+				t.text = s[i : i+end+1]
+			}
+		}
+		if t.text == "" {
+			_, size := utf8.DecodeRuneInString(s[i:])
+			t.text = s[i : i+size]
+		}
+		tokens = append(tokens, t)
+		i += len(t.text)
+	}
+	return tokens
+}
+
+// closing closes the open tags, innermost first.
+func closing(open []token) string {
+	var b strings.Builder
+	for i := len(open) - 1; i >= 0; i-- {
+		b.WriteString("</" + open[i].tag + ">")
+	}
+	return b.String()
+}
+
+func reopening(open []token) string {
+	var b strings.Builder
+	for _, t := range open {
+		b.WriteString(t.text)
+	}
+	return b.String()
+}
+
+// Split cuts h into parts of at most limit UTF-16 code units, preferring to
+// cut after a line and then after a word. Tags open at a cut are closed at
+// the end of the part and opened again at the start of the next one.
+func Split(h HTML, limit int) []HTML {
+	if Len(h) <= limit {
+		return []HTML{h}
+	}
+
+	tokens := tokenize(h)
+	var parts []HTML
+	var open []token
+	for start := 0; start < len(tokens); {
+		prefix := reopening(open)
+		size := Len(HTML(prefix))
+		stack := append([]token(nil), open...)
+
+		end := start
+		lineEnd, wordEnd := -1, -1
+		var lineStack, wordStack []token
+		for i := start; i < len(tokens); i++ {
+			t := tokens[i]
+			next := stack
+			switch {
+			case t.tag != "" && t.open:
+				next = append(append([]token(nil), stack...), t)
+			case t.tag != "" && len(stack) > 0:
+				next = stack[:len(stack)-1]
+			}
+			n := Len(HTML(t.text))
+			if size+n+Len(HTML(closing(next))) > limit && i > start {
+				break
+			}
+			size += n
+			stack = next
+			end = i + 1
+
+			// Cuts in the first half of a part would waste the rest of it
+			if size >= limit/2 {
+				switch t.text {
+				case "\n":
+					lineEnd, lineStack = end, stack
+				case " ":
+					wordEnd, wordStack = end, stack
+				}
+			}
+		}
+
+		if end < len(tokens) {
+			switch {
+			case lineEnd > 0:
+				end, stack = lineEnd, lineStack
+			case wordEnd > 0:
+				end, stack = wordEnd, wordStack
+			}
+			// A tag opened right at the cut goes to the next part
+			for end > start+1 && tokens[end-1].tag != "" && tokens[end-1].open {
+				end--
+				stack = stack[:len(stack)-1]
+			}
+		}
+
+		var b strings.Builder
+		b.WriteString(prefix)
+		for _, t := range tokens[start:end] {
+			b.WriteString(t.text)
+		}
+		parts = append(parts, HTML(strings.TrimRight(b.String(), " \n")+closing(stack)))
+
+		open = stack
+		start = end
+	}
+	return parts
+}
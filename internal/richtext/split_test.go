@@ -0,0 +1,136 @@
+package richtext
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestLen(t *testing.T) {
+	tests := []struct {
+		in   HTML
+		want int
+	}{
+		{"", 0},
+		{"abc", 3},
+		{"Привет", 6},
+		{"😀", 2},
+		{"a😀b", 4},
+		{"<b>й</b>", 8},
+		{"&amp;", 5},
+	}
+	for _, tt := range tests {
+		if got := Len(tt.in); got != tt.want {
+			t.Errorf("Len(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name  string
+		in    HTML
+		limit int
+		want  []HTML
+	}{
+		{"fits", "<b>short</b>", 20, []HTML{"<b>short</b>"}},
+		{"at line", "first line\nsecond line", 15, []HTML{"first line", "second line"}},
+		{"at word", "aaaa bbbb cccc", 10, []HTML{"aaaa bbbb", "cccc"}},
+		{"in word", "abcdefghij", 4, []HTML{"abcd", "efgh", "ij"}},
+		{"entity kept whole", "xxxxxxxxx&amp;yyyy", 10, []HTML{"xxxxxxxxx", "&amp;yyyy"}},
+		{"tag kept whole", `ab<a href="https://x.io">c</a>`, 28, []HTML{"ab", `<a href="https://x.io">c</a>`}},
+		{"tag reopened", "<b>aaaa bbbb cccc</b>", 20, []HTML{"<b>aaaa bbbb</b>", "<b>cccc</b>"}},
+		{"nested tags reopened", "<b>bold <i>both words here</i></b> plain", 24,
+			[]HTML{"<b>bold <i>both</i></b>", "<b><i>words</i></b>", "<b><i>here</i></b> plain"}},
+		{"link reopened", `<a href="https://x.io">aaaa bbbb</a>`, 35,
+			[]HTML{`<a href="https://x.io">aaaa</a>`, `<a href="https://x.io">bbbb</a>`}},
+		{"emoji kept whole", "😀😀😀", 5, []HTML{"😀😀", "😀"}},
+	}
+	for _, tt := range tests {
+		got := Split(tt.in, tt.limit)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Split(%q, %d)\n got %q\nwant %q", tt.name, tt.in, tt.limit, got, tt.want)
+		}
+		for _, part := range got {
+			if Len(part) > tt.limit {
+				t.Errorf("%s: part %q is %d units long, over %d", tt.name, part, Len(part), tt.limit)
+			}
+		}
+	}
+}
+
+var tagRE = regexp.MustCompile(`<(/?)([a-z]+)[^>]*>`)
+
+// checkBalanced reports tags in part that are closed without being open or
+// left open at its end.
+func checkBalanced(t *testing.T, part HTML) {
+	t.Helper()
+	var open []string
+	for _, m := range tagRE.FindAllStringSubmatch(string(part), -1) {
+		if m[1] == "" {
+			open = append(open, m[2])
+			continue
+		}
+		if len(open) == 0 || open[len(open)-1] != m[2] {
+			t.Errorf("part closes <%s> it has not opened: %q", m[2], part)
+			return
+		}
+		open = open[:len(open)-1]
+	}
+	if len(open) > 0 {
+		t.Errorf("part leaves %v open: %q", open, part)
+	}
+}
+
+func TestSplitTelegramLimit(t *testing.T) {
+	const limit = 4096
+
+	// Emoji take two UTF-16 units each
+	exact := HTML(strings.Repeat("😀", limit/2))
+	if parts := Split(exact, limit); len(parts) != 1 {
+		t.Errorf("%d emoji split into %d parts, want 1", limit/2, len(parts))
+	}
+
+	over := HTML("a" + strings.Repeat("😀", limit/2))
+	parts := Split(over, limit)
+	if len(parts) != 2 {
+		t.Fatalf("%d units split into %d parts, want 2", Len(over), len(parts))
+	}
+	if Len(parts[0]) != limit-1 || Len(parts[1]) != 2 {
+		t.Errorf("parts are %d and %d units long, want %d and 2", Len(parts[0]), Len(parts[1]), limit-1)
+	}
+	if joined := parts[0] + parts[1]; joined != over {
+		t.Error("parts do not add up to the text")
+	}
+
+	// A long formatted reply: every part fits, is valid UTF-8, keeps entities
+	// whole and has balanced tags
+	var b strings.Builder
+	for i := 0; b.Len() < 5*limit; i++ {
+		b.WriteString("<b>Шаг</b> 😀 <i>проверьте <a href=\"https://example.com/?a=1&amp;b=2\">ссылку</a> &amp; <code>x &lt; y</code></i>")
+		if i%7 == 0 {
+			b.WriteString("\n")
+		} else {
+			b.WriteString(" ")
+		}
+	}
+	entityRE := regexp.MustCompile(`&[a-z]*$|^[a-z]*;`)
+	for _, part := range Split(HTML(b.String()), limit) {
+		if Len(part) > limit {
+			t.Errorf("part is %d units long, over %d", Len(part), limit)
+		}
+		if !utf8.ValidString(string(part)) {
+			t.Error("part is not valid UTF-8")
+		}
+		text := tagRE.ReplaceAllString(string(part), "")
+		if strings.ContainsAny(text, "<>") {
+			t.Errorf("part has a broken tag: %q", part)
+		}
+		if entityRE.MatchString(text) {
+			t.Errorf("part has a broken entity: %q", part)
+		}
+		checkBalanced(t, part)
+	}
+}
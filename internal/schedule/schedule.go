@@ -0,0 +1,169 @@
+// Package schedule answers when an organization's support team is working,
+// based on its weekly business hours, holidays and timezone.
+package schedule
+
+import (
+	"fmt"
+	"helpdesk/internal/db"
+	"strings"
+	"time"
+)
+
+// interval is a working window as offsets from local midnight.
+type interval struct {
+	start, end time.Duration
+}
+
+// Schedule is an organization's working time.
+type Schedule struct {
+	Location *time.Location
+	hours    map[time.Weekday]interval
+	holidays map[string]string // YYYY-MM-DD -> name
+}
+
+// ForOrganization loads the organization's schedule. Organizations without
+// configured hours are open around the clock.
+func ForOrganization(orgID int) (*Schedule, error) {
+	org, err := db.GetOrganizationByID(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := time.LoadLocation(org.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", org.Timezone, err)
+	}
+
+	hours, err := db.GetBusinessHours(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	holidays, err := db.GetHolidays(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Schedule{
+		Location: loc,
+		hours:    make(map[time.Weekday]interval),
+		holidays: make(map[string]string),
+	}
+	for _, h := range hours {
+		start, err := ParseClock(h.StartTime)
+		if err != nil {
+			return nil, err
+		}
+		end, err := ParseClock(h.EndTime)
+		if err != nil {
+			return nil, err
+		}
+		if end > start {
+			s.hours[time.Weekday(h.Weekday)] = interval{start, end}
+		}
+	}
+	for _, h := range holidays {
+		name := ""
+		if h.Name != nil {
+			name = *h.Name
+		}
+		s.holidays[h.Date.Format("2006-01-02")] = name
+	}
+
+	return s, nil
+}
+
+// ParseClock parses "HH:MM" into an offset from midnight.
+func ParseClock(v string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(v))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", v)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// At returns the time of day clock, an offset as returned by ParseClock, on
+// the day of t in t's location. It follows the wall clock, so on days when
+// DST starts or ends it is not simply midnight plus clock.
+func At(t time.Time, clock time.Duration) time.Time {
+	h, m := int(clock/time.Hour), int(clock%time.Hour/time.Minute)
+	return time.Date(t.Year(), t.Month(), t.Day(), h, m, 0, 0, t.Location())
+}
+
+// AlwaysOpen reports whether no working hours are configured.
+func (s *Schedule) AlwaysOpen() bool {
+	return len(s.hours) == 0
+}
+
+// window returns the working interval of the day containing t, in the
+// schedule's timezone.
+func (s *Schedule) window(t time.Time) (start, end time.Time, ok bool) {
+	local := t.In(s.Location)
+	if _, holiday := s.holidays[local.Format("2006-01-02")]; holiday {
+		return time.Time{}, time.Time{}, false
+	}
+
+	iv, ok := s.hours[local.Weekday()]
+	if !ok {
+		return time.Time{}, time.Time{}, false
+	}
+
+	return At(local, iv.start), At(local, iv.end), true
+}
+
+func nextMidnight(t time.Time, loc *time.Location) time.Time {
+	local := t.In(loc)
+	return time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, loc)
+}
+
+// IsOpen reports whether t falls into working time.
+func (s *Schedule) IsOpen(t time.Time) bool {
+	if s.AlwaysOpen() {
+		return true
+	}
+	start, end, ok := s.window(t)
+	return ok && !t.Before(start) && t.Before(end)
+}
+
+// NextOpen returns t if it is working time, otherwise the start of the next
+// working interval. It gives up after a year of days off.
+func (s *Schedule) NextOpen(t time.Time) time.Time {
+	if s.AlwaysOpen() {
+		return t
+	}
+
+	cur := t
+	for i := 0; i < 366; i++ {
+		if start, end, ok := s.window(cur); ok && cur.Before(end) {
+			if cur.Before(start) {
+				return start
+			}
+			return cur
+		}
+		cur = nextMidnight(cur, s.Location)
+	}
+	return t
+}
+
+// Add returns the moment d of working time after start.
+func (s *Schedule) Add(start time.Time, d time.Duration) time.Time {
+	if s.AlwaysOpen() {
+		return start.Add(d)
+	}
+
+	cur := start
+	for i := 0; i < 366*5; i++ {
+		if open, end, ok := s.window(cur); ok && cur.Before(end) {
+			if cur.Before(open) {
+				cur = open
+			}
+			if avail := end.Sub(cur); d <= avail {
+				return cur.Add(d)
+			} else {
+				d -= avail
+			}
+		}
+		cur = nextMidnight(cur, s.Location)
+	}
+	return start.Add(d)
+}
@@ -0,0 +1,211 @@
+// Package secrets encrypts sensitive values such as OAuth tokens before they
+// are stored. Every value gets its own data key (envelope encryption); the
+// data key is wrapped with a master key from TOKEN_ENCRYPTION_KEYS. Both are
+// bound to the organization and column the value is stored in, so a value
+// copied to another row or column does not decrypt.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// prefix marks encrypted values: enc:v1:<key id>:<wrapped data key>:<ciphertext>.
+const prefix = "enc:v1:"
+
+var (
+	ErrUnknownKey   = errors.New("value encrypted with unknown master key")
+	ErrNotEncrypted = errors.New("value is not encrypted")
+)
+
+// keys holds the master keys by ID. activeKey encrypts new values, the others
+// are kept to decrypt values written before a rotation.
+var keys map[string][]byte
+var activeKey string
+
+// Init reads the master keys from TOKEN_ENCRYPTION_KEYS, a comma-separated
+// list of id:base64key entries with 32-byte keys. The first key is used for
+// new values. Without keys values are stored as plain text, which is refused
+// when required is set.
+func Init(required bool) error {
+	keys = make(map[string][]byte)
+	activeKey = ""
+
+	v := strings.TrimSpace(os.Getenv("TOKEN_ENCRYPTION_KEYS"))
+	if v == "" {
+		if required {
+			return errors.New("TOKEN_ENCRYPTION_KEYS is not set")
+		}
+		return nil
+	}
+
+	for _, entry := range strings.Split(v, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || id == "" {
+			return fmt.Errorf("invalid TOKEN_ENCRYPTION_KEYS entry %q, expected id:base64key", entry)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return fmt.Errorf("key %q must be 32 bytes encoded in base64", id)
+		}
+		if _, dup := keys[id]; dup {
+			return fmt.Errorf("duplicate key id %q", id)
+		}
+		keys[id] = key
+		if activeKey == "" {
+			activeKey = id
+		}
+	}
+	return nil
+}
+
+// Enabled reports whether master keys are configured.
+func Enabled() bool {
+	return activeKey != ""
+}
+
+// additionalData binds a value to the organization and column it is stored in.
+func additionalData(orgID int, column string) []byte {
+	return []byte(fmt.Sprintf("%s:%d", column, orgID))
+}
+
+func seal(key, plaintext, ad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, ad), nil
+}
+
+func open(key, sealed, ad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, ad)
+}
+
+// Encrypt encrypts a value stored in column of the organization's row with a
+// fresh data key wrapped by the active master key. Without configured keys
+// the value is returned unchanged.
+func Encrypt(plaintext string, orgID int, column string) (string, error) {
+	if !Enabled() {
+		return plaintext, nil
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	ad := additionalData(orgID, column)
+	wrapped, err := seal(keys[activeKey], dataKey, ad)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(dataKey, []byte(plaintext), ad)
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawStdEncoding
+	return prefix + activeKey + ":" + enc.EncodeToString(wrapped) + ":" + enc.EncodeToString(ciphertext), nil
+}
+
+// Decrypt reverses Encrypt for the same organization and column. Plain
+// text is refused once keys are configured; Rewrap encrypts values stored
+// before that.
+func Decrypt(value string, orgID int, column string) (string, error) {
+	if !IsEncrypted(value) {
+		if Enabled() {
+			return "", ErrNotEncrypted
+		}
+		return value, nil
+	}
+	return decrypt(strings.TrimPrefix(value, prefix), additionalData(orgID, column))
+}
+
+// decrypt opens <key id>:<wrapped data key>:<ciphertext>.
+func decrypt(value string, ad []byte) (string, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return "", errors.New("malformed encrypted value")
+	}
+	key, ok := keys[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrUnknownKey, parts[0])
+	}
+
+	enc := base64.RawStdEncoding
+	wrapped, err := enc.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("malformed encrypted value: %w", err)
+	}
+	ciphertext, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("malformed encrypted value: %w", err)
+	}
+
+	dataKey, err := open(key, wrapped, ad)
+	if err != nil {
+		return "", fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	plaintext, err := open(dataKey, ciphertext, ad)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// Rewrap encrypts a value that NeedsRewrap with the active master key: plain
+// text or a value under a retired key.
+func Rewrap(value string, orgID int, column string) (string, error) {
+	plain := value
+	if IsEncrypted(value) {
+		var err error
+		if plain, err = Decrypt(value, orgID, column); err != nil {
+			return "", err
+		}
+	}
+	return Encrypt(plain, orgID, column)
+}
+
+// IsEncrypted reports whether value was produced by Encrypt.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// NeedsRewrap reports whether value should be encrypted again: it is plain
+// text while keys are configured or uses a master key that is no longer
+// active.
+func NeedsRewrap(value string) bool {
+	if !Enabled() {
+		return false
+	}
+	if !strings.HasPrefix(value, prefix) {
+		return true
+	}
+	id, _, _ := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	return id != activeKey
+}
@@ -0,0 +1,175 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testKey returns a 32-byte master key filled with b, encoded for
+// TOKEN_ENCRYPTION_KEYS.
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+func setKeys(t *testing.T, value string) {
+	t.Helper()
+	t.Setenv("TOKEN_ENCRYPTION_KEYS", value)
+	if err := Init(false); err != nil {
+		t.Fatalf("Init(%q): %v", value, err)
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	setKeys(t, "k1:"+testKey(1))
+
+	for _, plain := range []string{"ya29.access-token", "", "пароль: с двоеточием"} {
+		value, err := Encrypt(plain, 7, "access_token")
+		if err != nil {
+			t.Fatalf("Encrypt(%q): %v", plain, err)
+		}
+		if !IsEncrypted(value) || !strings.HasPrefix(value, prefix+"k1:") {
+			t.Errorf("Encrypt(%q) = %q, want a value under key k1", plain, value)
+		}
+		if plain != "" && strings.Contains(value, plain) {
+			t.Errorf("Encrypt(%q) = %q contains the plain text", plain, value)
+		}
+		got, err := Decrypt(value, 7, "access_token")
+		if err != nil || got != plain {
+			t.Errorf("Decrypt(Encrypt(%q)) = %q, %v", plain, got, err)
+		}
+	}
+
+	// Every value gets a fresh data key and nonce
+	a, _ := Encrypt("same", 7, "access_token")
+	b, _ := Encrypt("same", 7, "access_token")
+	if a == b {
+		t.Error("two encryptions of the same value are equal")
+	}
+}
+
+func TestDecryptChecksPlace(t *testing.T) {
+	setKeys(t, "k1:"+testKey(1))
+
+	value, err := Encrypt("secret", 7, "access_token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		orgID  int
+		column string
+	}{
+		{8, "access_token"},
+		{7, "refresh_token"},
+		{70, "access_token"},
+	} {
+		if got, err := Decrypt(value, tt.orgID, tt.column); err == nil {
+			t.Errorf("Decrypt in %s:%d = %q, want an error", tt.column, tt.orgID, got)
+		}
+	}
+}
+
+func TestDecryptRejects(t *testing.T) {
+	setKeys(t, "k1:"+testKey(1))
+
+	if _, err := Decrypt("ya29.plain", 7, "access_token"); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("Decrypt of plain text: %v, want ErrNotEncrypted", err)
+	}
+	for _, value := range []string{prefix + "k1:abc", prefix + "k1:!!!:abc", prefix + "k1:YWJj:YWJj"} {
+		if _, err := Decrypt(value, 7, "access_token"); err == nil {
+			t.Errorf("Decrypt(%q) accepted a malformed value", value)
+		}
+	}
+	if _, err := Decrypt(prefix+"k9:YWJj:YWJj", 7, "access_token"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Decrypt under an unknown key: %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestWithoutKeys(t *testing.T) {
+	setKeys(t, "")
+
+	value, err := Encrypt("plain", 7, "access_token")
+	if err != nil || value != "plain" {
+		t.Errorf("Encrypt without keys = %q, %v; want the value unchanged", value, err)
+	}
+	if got, err := Decrypt("plain", 7, "access_token"); err != nil || got != "plain" {
+		t.Errorf("Decrypt without keys = %q, %v", got, err)
+	}
+	if NeedsRewrap("plain") {
+		t.Error("NeedsRewrap without keys")
+	}
+
+	t.Setenv("TOKEN_ENCRYPTION_KEYS", "")
+	if err := Init(true); err == nil {
+		t.Error("Init(true) accepted missing keys")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	setKeys(t, "old:"+testKey(1))
+	value, err := Encrypt("secret", 7, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if NeedsRewrap(value) {
+		t.Error("NeedsRewrap of a value under the active key")
+	}
+
+	// A new key goes first; the old one stays to read existing values
+	setKeys(t, "new:"+testKey(2)+",old:"+testKey(1))
+	if got, err := Decrypt(value, 7, "password"); err != nil || got != "secret" {
+		t.Errorf("Decrypt under the retired key = %q, %v", got, err)
+	}
+	if !NeedsRewrap(value) {
+		t.Error("value under the retired key does not need a rewrap")
+	}
+
+	rewrapped, err := Rewrap(value, 7, "password")
+	if err != nil {
+		t.Fatalf("Rewrap: %v", err)
+	}
+	if !strings.HasPrefix(rewrapped, prefix+"new:") || NeedsRewrap(rewrapped) {
+		t.Errorf("Rewrap = %q, want a value under key new", rewrapped)
+	}
+	if got, err := Decrypt(rewrapped, 7, "password"); err != nil || got != "secret" {
+		t.Errorf("Decrypt after Rewrap = %q, %v", got, err)
+	}
+
+	// Once the old key is gone its values no longer decrypt
+	setKeys(t, "new:"+testKey(2))
+	if _, err := Decrypt(value, 7, "password"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Decrypt under a removed key: %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestRewrapPlainText(t *testing.T) {
+	setKeys(t, "k1:"+testKey(1))
+
+	if !NeedsRewrap("ya29.plain") {
+		t.Error("plain text does not need a rewrap")
+	}
+	value, err := Rewrap("ya29.plain", 7, "access_token")
+	if err != nil {
+		t.Fatalf("Rewrap: %v", err)
+	}
+	if got, err := Decrypt(value, 7, "access_token"); err != nil || got != "ya29.plain" {
+		t.Errorf("Decrypt after Rewrap = %q, %v", got, err)
+	}
+}
+
+func TestInitRejects(t *testing.T) {
+	for _, value := range []string{
+		"nokey",
+		":" + testKey(1),
+		"k1:not-base64!",
+		"k1:" + base64.StdEncoding.EncodeToString([]byte("short")),
+		"k1:" + testKey(1) + ",k1:" + testKey(2),
+	} {
+		t.Setenv("TOKEN_ENCRYPTION_KEYS", value)
+		if err := Init(false); err == nil {
+			t.Errorf("Init accepted TOKEN_ENCRYPTION_KEYS=%q", value)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Package sla computes first response and resolution due dates from the
+// organization's SLA policies and warns operators before they expire.
+package sla
+
+import (
+	"context"
+	"fmt"
+	"helpdesk/internal/db"
+	"helpdesk/internal/i18n"
+	"helpdesk/internal/models"
+	"helpdesk/internal/richtext"
+	"helpdesk/internal/schedule"
+	"log"
+	"os"
+	"time"
+)
+
+// Ticket SLA states shown in the interface.
+const (
+	StateNone     = ""
+	StateOK       = "ok"
+	StateWarning  = "warning"
+	StateBreached = "breached"
+)
+
+// WarningBefore is how long before a due date a timer counts as near breach
+// and operators are warned.
+var WarningBefore = 30 * time.Minute
+
+// Calendar adds working time to a moment.
+type Calendar interface {
+	// Add returns the moment d of working time after start.
+	Add(start time.Time, d time.Duration) time.Time
+}
+
+// AlwaysOpen counts every hour of the day.
+type AlwaysOpen struct{}
+
+func (AlwaysOpen) Add(start time.Time, d time.Duration) time.Time { return start.Add(d) }
+
+// calendarFor returns the calendar used for policies counting business hours.
+func calendarFor(orgID int) Calendar {
+	s, err := schedule.ForOrganization(orgID)
+	if err != nil {
+		log.Printf("Error loading schedule for organization %d: %v", orgID, err)
+		return AlwaysOpen{}
+	}
+	return s
+}
+
+func Init() error {
+	if v := os.Getenv("SLA_WARNING_BEFORE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid SLA_WARNING_BEFORE: %w", err)
+		}
+		WarningBefore = d
+	}
+	return nil
+}
+
+// Apply computes the ticket's due dates from the policy for its priority,
+// counting from ticket creation, and stores them. Tickets without a policy get
+// no timers.
+func Apply(ticket *models.Ticket) error {
+	policy, err := db.GetSLAPolicy(ticket.OrganizationID, ticket.Priority)
+	if err != nil {
+		return err
+	}
+
+	var firstResponseDue, resolutionDue *time.Time
+	if policy != nil {
+		var cal Calendar = AlwaysOpen{}
+		if policy.BusinessHours {
+			cal = calendarFor(ticket.OrganizationID)
+		}
+		if policy.FirstResponseMinutes != nil {
+			due := cal.Add(ticket.CreatedAt, time.Duration(*policy.FirstResponseMinutes)*time.Minute)
+			firstResponseDue = &due
+		}
+		if policy.ResolutionMinutes != nil {
+			due := cal.Add(ticket.CreatedAt, time.Duration(*policy.ResolutionMinutes)*time.Minute)
+			resolutionDue = &due
+		}
+	}
+
+	if err := db.UpdateTicketSLADueDates(ticket.ID, firstResponseDue, resolutionDue); err != nil {
+		return err
+	}
+	ticket.FirstResponseDueAt = firstResponseDue
+	ticket.ResolutionDueAt = resolutionDue
+	return nil
+}
+
+// timerState reports the state of one timer that is met once done is set.
+func timerState(due, done *time.Time, now time.Time) string {
+	if due == nil {
+		return StateNone
+	}
+	if done != nil {
+		if done.After(*due) {
+			return StateBreached
+		}
+		return StateOK
+	}
+	if now.After(*due) {
+		return StateBreached
+	}
+	if now.Add(WarningBefore).After(*due) {
+		return StateWarning
+	}
+	return StateOK
+}
+
+// State returns the worst state of the ticket's SLA timers.
+func State(ticket *models.Ticket, now time.Time) string {
+	rank := map[string]int{StateNone: 0, StateOK: 1, StateWarning: 2, StateBreached: 3}
+
+	state := timerState(ticket.FirstResponseDueAt, ticket.FirstRespondedAt, now)
+	if s := timerState(ticket.ResolutionDueAt, ticket.ResolvedAt, now); rank[s] > rank[state] {
+		state = s
+	}
+	return state
+}
+
+// CheckEscalations warns operators once about every running timer that will
+// expire within WarningBefore and tells them once more when it has expired.
+// Outside the organization's working time notices are held back until work
+// resumes. It stops early when ctx is done.
+func CheckEscalations(ctx context.Context, notify func(text i18n.Message)) error {
+	now := time.Now()
+	tickets, err := db.GetTicketsWithSLADue(now, now.Add(WarningBefore))
+	if err != nil {
+		return err
+	}
+
+	working := make(map[int]bool)
+	for _, t := range tickets {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		open, ok := working[t.OrganizationID]
+		if !ok {
+			s, err := schedule.ForOrganization(t.OrganizationID)
+			open = err != nil || s.IsOpen(now)
+			working[t.OrganizationID] = open
+		}
+		if !open {
+			continue
+		}
+
+		if t.FirstRespondedAt == nil {
+			escalate(t, "first_response", t.FirstResponseDueAt, t.FirstResponseWarnedAt, t.FirstResponseBreachNotifiedAt, now, notify,
+				db.MarkTicketFirstResponseEscalated, db.MarkTicketFirstResponseBreachNotified)
+		}
+		if t.ResolvedAt == nil {
+			escalate(t, "resolution", t.ResolutionDueAt, t.ResolutionWarnedAt, t.ResolutionBreachNotifiedAt, now, notify,
+				db.MarkTicketResolutionEscalated, db.MarkTicketResolutionBreachNotified)
+		}
+	}
+
+	return nil
+}
+
+// escalate sends the breach notice of an expired timer or the warning of one
+// about to expire, unless it was already sent, and marks it sent.
+func escalate(t *models.Ticket, timer string, due, warned, breachNotified *time.Time, now time.Time,
+	notify func(text i18n.Message), markWarned, markBreached func(ticketID int) error) {
+	if due == nil {
+		return
+	}
+
+	mark := markWarned
+	switch {
+	case due.Before(now):
+		if breachNotified != nil {
+			return
+		}
+		mark = markBreached
+	case due.Before(now.Add(WarningBefore)):
+		if warned != nil {
+			return
+		}
+	default:
+		return
+	}
+
+	notify(escalationText(t, timer, *due, now))
+	if err := mark(t.ID); err != nil {
+		log.Printf("Error marking SLA escalation for ticket #%d: %v", t.ID, err)
+	}
+}
+
+// escalationText warns about the timer ("first_response" or "resolution").
+func escalationText(t *models.Ticket, timer string, due, now time.Time) i18n.Message {
+	if now.After(due) {
+		return i18n.M("sla.breached."+timer, t.ID, due.Format("02.01 15:04"), richtext.Bold(t.Title), t.ID)
+	}
+	return i18n.M("sla.warning."+timer, t.ID, int(due.Sub(now).Minutes())+1, due.Format("02.01 15:04"), richtext.Bold(t.Title), t.ID)
+}
@@ -0,0 +1,207 @@
+package tickets
+
+import (
+	"helpdesk/internal/db"
+	"helpdesk/internal/i18n"
+	"helpdesk/internal/models"
+	"helpdesk/internal/sla"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Audit event actions.
+const (
+	ActionCreated         = "ticket_created"
+	ActionStatusChanged   = "status_changed"
+	ActionPriorityChanged = "priority_changed"
+	ActionAssigned        = "assigned"
+	ActionMessageAdded    = "message_added"
+	ActionRated           = "rated"
+
+	ActionAppointmentScheduled   = "appointment_scheduled"
+	ActionAppointmentRescheduled = "appointment_rescheduled"
+	ActionAppointmentCancelled   = "appointment_cancelled"
+)
+
+// record writes an audit event. Failures are logged rather than returned: the
+// mutation itself has already been applied.
+func record(ticket *models.Ticket, actor Actor, action string, before, after *string) {
+	event := &models.AuditEvent{
+		OrganizationID: ticket.OrganizationID,
+		TicketID:       &ticket.ID,
+		ActorID:        actor.UserID,
+		Channel:        actor.Channel,
+		Action:         action,
+		Before:         before,
+		After:          after,
+	}
+	if err := db.CreateAuditEvent(event); err != nil {
+		log.Printf("Error recording %s for ticket #%d: %v", action, ticket.ID, err)
+	}
+}
+
+// Create stores a new ticket.
+func Create(ticket *models.Ticket, actor Actor) error {
+	if err := db.CreateTicket(ticket); err != nil {
+		return err
+	}
+	record(ticket, actor, ActionCreated, nil, &ticket.Title)
+
+	if err := sla.Apply(ticket); err != nil {
+		log.Printf("Error applying SLA policy to ticket #%d: %v", ticket.ID, err)
+	}
+	return nil
+}
+
+// AddMessage stores a message on the ticket.
+func AddMessage(ticket *models.Ticket, message *models.Message, actor Actor) error {
+	message.TicketID = ticket.ID
+	if err := db.CreateMessage(message); err != nil {
+		return err
+	}
+	id := strconv.Itoa(message.ID)
+	record(ticket, actor, ActionMessageAdded, nil, &id)
+
+	// The first agent message stops the first response timer
+	if !message.IsFromCustomer && !message.IsSystem && ticket.FirstRespondedAt == nil {
+		if err := db.SetTicketFirstResponse(ticket.ID, message.CreatedAt); err != nil {
+			log.Printf("Error recording first response for ticket #%d: %v", ticket.ID, err)
+		} else {
+			ticket.FirstRespondedAt = &message.CreatedAt
+		}
+	}
+
+	// A customer writing about a resolved ticket still needs help
+	if message.IsFromCustomer && BaseStatus(ticket.OrganizationID, ticket.Status) == StatusResolved {
+		if err := ChangeStatus(ticket, StatusOpen, actor); err != nil {
+			log.Printf("Error reopening ticket #%d: %v", ticket.ID, err)
+		} else if OnReopened != nil {
+			OnReopened(ticket)
+		}
+	}
+	return nil
+}
+
+// ChangePriority validates and applies a new priority.
+func ChangePriority(ticket *models.Ticket, priority string, actor Actor) error {
+	if ticket.Priority == priority {
+		return nil
+	}
+	if err := db.UpdateTicketPriority(ticket.ID, priority); err != nil {
+		return err
+	}
+	before := ticket.Priority
+	ticket.Priority = priority
+	record(ticket, actor, ActionPriorityChanged, &before, &priority)
+
+	if err := sla.Apply(ticket); err != nil {
+		log.Printf("Error applying SLA policy to ticket #%d: %v", ticket.ID, err)
+	}
+	return nil
+}
+
+// TimelineEntry is either a message or an audit event on a ticket.
+type TimelineEntry struct {
+	At      time.Time
+	Message *models.Message
+	Event   *models.AuditEvent
+	// Summary describes Event in words
+	Summary string
+}
+
+// Timeline interleaves the ticket's messages with its audit events in time
+// order. userNames resolves actor and agent IDs to display names.
+func Timeline(ticket *models.Ticket, messages []*models.Message, userNames map[int]string, lang string) ([]*TimelineEntry, error) {
+	events, err := db.GetAuditEventsByTicket(ticket.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*TimelineEntry
+	for _, m := range messages {
+		entries = append(entries, &TimelineEntry{At: m.CreatedAt, Message: m})
+	}
+	for _, e := range events {
+		// Messages are shown themselves
+		if e.Action == ActionMessageAdded {
+			continue
+		}
+		entries = append(entries, &TimelineEntry{
+			At:      e.CreatedAt,
+			Event:   e,
+			Summary: DescribeEvent(ticket.OrganizationID, e, userNames, lang),
+		})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].At.Before(entries[j].At) })
+	return entries, nil
+}
+
+// eventTime formats an RFC 3339 audit value for display.
+func eventTime(v *string) string {
+	if v == nil {
+		return "—"
+	}
+	if t, err := time.Parse(time.RFC3339, *v); err == nil {
+		return t.Format("02.01.2006 15:04")
+	}
+	return *v
+}
+
+// PriorityLabel names a priority in lang; unknown values are shown as they are.
+func PriorityLabel(priority, lang string) string {
+	if !models.IsValidPriority(priority) {
+		return priority
+	}
+	return i18n.T(lang, "priority."+priority)
+}
+
+// DescribeEvent renders an audit event as a short sentence in lang.
+func DescribeEvent(orgID int, e *models.AuditEvent, userNames map[int]string, lang string) string {
+	value := func(v *string) string {
+		if v == nil {
+			return "—"
+		}
+		return *v
+	}
+	name := func(v *string) string {
+		if v == nil {
+			return "—"
+		}
+		if id, err := strconv.Atoi(*v); err == nil {
+			if n, ok := userNames[id]; ok {
+				return n
+			}
+		}
+		return "#" + *v
+	}
+
+	switch e.Action {
+	case ActionCreated:
+		return i18n.T(lang, "event.created")
+	case ActionStatusChanged:
+		return i18n.T(lang, "event.status_changed", StatusLabel(orgID, value(e.Before), lang), StatusLabel(orgID, value(e.After), lang))
+	case ActionPriorityChanged:
+		return i18n.T(lang, "event.priority_changed", PriorityLabel(value(e.Before), lang), PriorityLabel(value(e.After), lang))
+	case ActionAssigned:
+		if e.Before == nil {
+			return i18n.T(lang, "event.assigned", name(e.After))
+		}
+		return i18n.T(lang, "event.reassigned", name(e.Before), name(e.After))
+	case ActionMessageAdded:
+		return i18n.T(lang, "event.message_added", value(e.After))
+	case ActionRated:
+		return i18n.T(lang, "event.rated", value(e.After))
+	case ActionAppointmentScheduled:
+		kind, at, _ := strings.Cut(value(e.After), " ")
+		return i18n.T(lang, "event.appointment_scheduled."+appointmentKind(kind), eventTime(&at))
+	case ActionAppointmentRescheduled:
+		return i18n.T(lang, "event.appointment_rescheduled", eventTime(e.Before), eventTime(e.After))
+	case ActionAppointmentCancelled:
+		return i18n.T(lang, "event.appointment_cancelled", eventTime(e.Before))
+	}
+	return e.Action
+}
@@ -0,0 +1,264 @@
+package tickets
+
+import (
+	"errors"
+	"fmt"
+	"helpdesk/internal/calendar"
+	"helpdesk/internal/db"
+	"helpdesk/internal/i18n"
+	"helpdesk/internal/models"
+	"log"
+	"strings"
+	"time"
+)
+
+// Appointment kinds.
+const (
+	AppointmentVisit = "visit"
+	AppointmentCall  = "call"
+)
+
+var ErrInvalidAppointment = errors.New("invalid appointment")
+
+// organizationLocation returns the organization's timezone, UTC if unset.
+func organizationLocation(orgID int) (*time.Location, error) {
+	org, err := db.GetOrganizationByID(orgID)
+	if err != nil {
+		return nil, err
+	}
+	if org.Timezone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(org.Timezone)
+}
+
+// ParseAppointmentTime reads a date (YYYY-MM-DD or DD.MM.YYYY) and a time
+// (HH:MM) in the organization's timezone.
+func ParseAppointmentTime(orgID int, date, clock string) (time.Time, error) {
+	loc, err := organizationLocation(orgID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	value := strings.TrimSpace(date) + " " + strings.TrimSpace(clock)
+	for _, layout := range []string{"2006-01-02 15:04", "02.01.2006 15:04"} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: cannot parse date %q and time %q", ErrInvalidAppointment, date, clock)
+}
+
+// ScheduleAppointment creates a calendar event for the ticket, invites the
+// assigned agent and links the event to the ticket.
+func ScheduleAppointment(ticket *models.Ticket, kind string, start time.Time, duration time.Duration, actor Actor) (*models.TicketEvent, error) {
+	if kind != AppointmentVisit && kind != AppointmentCall {
+		return nil, fmt.Errorf("%w: unknown kind %q", ErrInvalidAppointment, kind)
+	}
+	if duration <= 0 {
+		return nil, fmt.Errorf("%w: duration must be positive", ErrInvalidAppointment)
+	}
+	if start.Before(time.Now()) {
+		return nil, fmt.Errorf("%w: start is in the past", ErrInvalidAppointment)
+	}
+
+	end := start.Add(duration)
+	e, err := calendarEvent(ticket, kind, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := calendar.ForOrganization(ticket.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	externalID, err := provider.CreateEvent(e)
+	if err != nil {
+		return nil, err
+	}
+
+	event := &models.TicketEvent{
+		TicketID:        ticket.ID,
+		OrganizationID:  ticket.OrganizationID,
+		ExternalEventID: &externalID,
+		Kind:            kind,
+		StartsAt:        start,
+		EndsAt:          end,
+		Status:          "scheduled",
+		AgentID:         ticket.AssignedAgentID,
+		CreatedBy:       actor.UserID,
+	}
+	if err := db.CreateTicketEvent(event); err != nil {
+		return nil, err
+	}
+
+	after := kind + " " + start.Format(time.RFC3339)
+	record(ticket, actor, ActionAppointmentScheduled, nil, &after)
+
+	return event, nil
+}
+
+// calendarEvent describes the ticket's appointment for the calendar, with
+// the assigned agent invited.
+func calendarEvent(ticket *models.Ticket, kind string, start, end time.Time) (*calendar.Event, error) {
+	var attendees []string
+	if ticket.AssignedAgentID != nil {
+		agent, err := db.GetUserByID(*ticket.AssignedAgentID)
+		if err != nil {
+			return nil, err
+		}
+		if agent.Email != nil && *agent.Email != "" {
+			attendees = append(attendees, *agent.Email)
+		}
+	}
+
+	lang := organizationLanguage(ticket.OrganizationID)
+	description := i18n.T(lang, "appointment.description", ticket.ID)
+	if ticket.Description != nil && *ticket.Description != "" {
+		description += "\n\n" + *ticket.Description
+	}
+
+	return &calendar.Event{
+		Title:       i18n.T(lang, "appointment.title."+appointmentKind(kind), ticket.ID, ticket.Title),
+		Description: description,
+		Start:       start,
+		End:         end,
+		Attendees:   attendees,
+	}, nil
+}
+
+// appointmentKind maps legacy and unknown kinds to a visit.
+func appointmentKind(kind string) string {
+	if kind == AppointmentCall {
+		return AppointmentCall
+	}
+	return AppointmentVisit
+}
+
+// organizationLanguage is the language of texts the whole organization reads,
+// such as calendar events and system messages.
+func organizationLanguage(orgID int) string {
+	org, err := db.GetOrganizationByID(orgID)
+	if err != nil {
+		return i18n.Default
+	}
+	return i18n.Pick(org.Language)
+}
+
+// AppointmentSummary describes an appointment in the organization's timezone,
+// e.g. "выезд специалиста 21.10.2026 с 14:00 до 15:00 (Europe/Moscow)".
+func AppointmentSummary(event *models.TicketEvent) i18n.Message {
+	loc, err := organizationLocation(event.OrganizationID)
+	if err != nil {
+		loc = time.UTC
+	}
+	start := event.StartsAt.In(loc)
+	end := event.EndsAt.In(loc)
+
+	return i18n.M("appointment.summary."+appointmentKind(event.Kind),
+		start.Format("02.01.2006"), start.Format("15:04"), end.Format("15:04"), loc.String())
+}
+
+// postSystemMessage adds a message written by the helpdesk itself to the
+// ticket, in the organization's language.
+func postSystemMessage(ticket *models.Ticket, text i18n.Message, actor Actor) {
+	msg := &models.Message{Content: text.In(organizationLanguage(ticket.OrganizationID)), IsSystem: true}
+	if err := AddMessage(ticket, msg, actor); err != nil {
+		log.Printf("Error posting system message on ticket #%d: %v", ticket.ID, err)
+	}
+}
+
+// RescheduleAppointment moves a scheduled appointment to new times in the
+// calendar and on the ticket.
+func RescheduleAppointment(ticket *models.Ticket, event *models.TicketEvent, start time.Time, duration time.Duration, actor Actor) error {
+	if event.Status != "scheduled" || event.ExternalEventID == nil {
+		return fmt.Errorf("%w: not scheduled", ErrInvalidAppointment)
+	}
+	if duration <= 0 {
+		return fmt.Errorf("%w: duration must be positive", ErrInvalidAppointment)
+	}
+	if start.Before(time.Now()) {
+		return fmt.Errorf("%w: start is in the past", ErrInvalidAppointment)
+	}
+
+	end := start.Add(duration)
+	e, err := calendarEvent(ticket, event.Kind, start, end)
+	if err != nil {
+		return err
+	}
+	provider, err := calendar.ForOrganization(ticket.OrganizationID)
+	if err != nil {
+		return err
+	}
+	if err := provider.UpdateEvent(*event.ExternalEventID, e); err != nil {
+		return err
+	}
+
+	return RecordReschedule(ticket, event, start, end, actor)
+}
+
+// CancelAppointment removes a scheduled appointment from the calendar and
+// marks it cancelled on the ticket.
+func CancelAppointment(ticket *models.Ticket, event *models.TicketEvent, actor Actor) error {
+	if event.Status != "scheduled" || event.ExternalEventID == nil {
+		return fmt.Errorf("%w: not scheduled", ErrInvalidAppointment)
+	}
+
+	provider, err := calendar.ForOrganization(ticket.OrganizationID)
+	if err != nil {
+		return err
+	}
+	if err := provider.DeleteEvent(*event.ExternalEventID); err != nil {
+		return err
+	}
+
+	return RecordCancel(ticket, event, actor)
+}
+
+// RecordReschedule moves an appointment to new times, restoring it if it was
+// cancelled, and notes the change on the ticket. The calendar is not touched,
+// e.g. because the change was made there.
+func RecordReschedule(ticket *models.Ticket, event *models.TicketEvent, start, end time.Time, actor Actor) error {
+	if event.Status == "scheduled" && event.StartsAt.Equal(start) && event.EndsAt.Equal(end) {
+		return nil
+	}
+
+	before := AppointmentSummary(event)
+	wasCancelled := event.Status == "cancelled"
+	prevStart := event.StartsAt.Format(time.RFC3339)
+
+	event.StartsAt = start
+	event.EndsAt = end
+	event.Status = "scheduled"
+	if err := db.UpdateTicketEvent(event); err != nil {
+		return err
+	}
+
+	after := start.Format(time.RFC3339)
+	record(ticket, actor, ActionAppointmentRescheduled, &prevStart, &after)
+
+	if wasCancelled {
+		postSystemMessage(ticket, i18n.M("appointment.restored", AppointmentSummary(event)), actor)
+	} else {
+		postSystemMessage(ticket, i18n.M("appointment.rescheduled", before, AppointmentSummary(event)), actor)
+	}
+	return nil
+}
+
+// RecordCancel marks an appointment as cancelled and notes it on the ticket
+// without touching the calendar.
+func RecordCancel(ticket *models.Ticket, event *models.TicketEvent, actor Actor) error {
+	if event.Status == "cancelled" {
+		return nil
+	}
+
+	event.Status = "cancelled"
+	if err := db.UpdateTicketEvent(event); err != nil {
+		return err
+	}
+
+	before := event.StartsAt.Format(time.RFC3339)
+	record(ticket, actor, ActionAppointmentCancelled, &before, nil)
+	postSystemMessage(ticket, i18n.M("appointment.cancelled", AppointmentSummary(event)), actor)
+	return nil
+}
@@ -0,0 +1,33 @@
+package tickets
+
+import (
+	"context"
+	"helpdesk/internal/db"
+	"helpdesk/internal/i18n"
+	"helpdesk/internal/models"
+	"log"
+	"time"
+)
+
+// CloseInactive closes the tickets resolved longer ago than their
+// organization's auto-close period without a customer reply and tells their
+// customers. It stops early when ctx is done.
+func CloseInactive(ctx context.Context, notify func(ticket *models.Ticket, text i18n.Message)) error {
+	list, err := db.GetTicketsToAutoClose(time.Now())
+	if err != nil {
+		return err
+	}
+
+	actor := Actor{Channel: ChannelSystem}
+	for _, t := range list {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := ChangeStatus(t, StatusClosed, actor); err != nil {
+			log.Printf("Error auto-closing ticket #%d: %v", t.ID, err)
+			continue
+		}
+		notify(t, i18n.M("bot.customer.auto_closed", t.ID))
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package tickets
+
+import (
+	"errors"
+	"helpdesk/internal/calendar"
+	"helpdesk/internal/models"
+	"helpdesk/internal/schedule"
+	"time"
+)
+
+// ErrSlotUnavailable means a slot is outside working hours, in the past or
+// already taken in the calendar.
+var ErrSlotUnavailable = errors.New("slot is not available")
+
+// ErrTicketResolved means the ticket was resolved or closed before the slot
+// was booked.
+var ErrTicketResolved = errors.New("ticket is resolved or closed")
+
+// slotStep is the granularity of offered slot start times.
+const slotStep = 30 * time.Minute
+
+func overlapsBusy(busy []calendar.Busy, start, end time.Time) bool {
+	for _, b := range busy {
+		if start.Before(b.End) && b.Start.Before(end) {
+			return true
+		}
+	}
+	return false
+}
+
+// fitsWorkingTime reports whether [start, start+d) lies within one
+// uninterrupted stretch of working time.
+func fitsWorkingTime(s *schedule.Schedule, start time.Time, d time.Duration) bool {
+	return s.IsOpen(start) && s.Add(start, d).Equal(start.Add(d))
+}
+
+// FreeSlots returns up to limit start times of free slots of length d within
+// the organization's working hours over the given number of days from now,
+// based on the organization calendar's free/busy data.
+func FreeSlots(orgID int, d time.Duration, days, limit int) ([]time.Time, error) {
+	s, err := schedule.ForOrganization(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	from := time.Now().Truncate(slotStep).Add(slotStep)
+	to := from.AddDate(0, 0, days)
+
+	provider, err := calendar.ForOrganization(orgID)
+	if err != nil {
+		return nil, err
+	}
+	busy, err := provider.FreeBusy(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var slots []time.Time
+	for cur := s.NextOpen(from); cur.Before(to) && len(slots) < limit; cur = s.NextOpen(cur) {
+		end := cur.Add(d)
+		if fitsWorkingTime(s, cur, d) && !overlapsBusy(busy, cur, end) {
+			slots = append(slots, cur.In(s.Location))
+			cur = end
+			continue
+		}
+		cur = cur.Add(slotStep)
+	}
+
+	return slots, nil
+}
+
+// BookSlot schedules an appointment in a slot picked by the customer after
+// checking that the ticket is still active and the slot still free.
+func BookSlot(ticket *models.Ticket, kind string, start time.Time, d time.Duration, actor Actor) (*models.TicketEvent, error) {
+	// The slots may have been offered before the ticket was resolved
+	if base := BaseStatus(ticket.OrganizationID, ticket.Status); base == StatusResolved || base == StatusClosed {
+		return nil, ErrTicketResolved
+	}
+
+	if !start.After(time.Now()) {
+		return nil, ErrSlotUnavailable
+	}
+
+	s, err := schedule.ForOrganization(ticket.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	if !fitsWorkingTime(s, start, d) {
+		return nil, ErrSlotUnavailable
+	}
+
+	provider, err := calendar.ForOrganization(ticket.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	busy, err := provider.FreeBusy(start, start.Add(d))
+	if err != nil {
+		return nil, err
+	}
+	if overlapsBusy(busy, start, start.Add(d)) {
+		return nil, ErrSlotUnavailable
+	}
+
+	return ScheduleAppointment(ticket, kind, start, d, actor)
+}
@@ -0,0 +1,70 @@
+package tickets
+
+import (
+	"errors"
+	"helpdesk/internal/db"
+	"helpdesk/internal/models"
+	"log"
+	"strconv"
+)
+
+var (
+	ErrInvalidScore = errors.New("score must be between 1 and 5")
+	ErrNotResolved  = errors.New("ticket is not resolved")
+)
+
+// Rate stores the customer's rating of a resolved or closed ticket, credited
+// to the ticket's agent. If the organization closes rated tickets, a resolved
+// ticket is closed; the result reports whether it was.
+func Rate(ticket *models.Ticket, score int, actor Actor) (closed bool, err error) {
+	if score < 1 || score > 5 {
+		return false, ErrInvalidScore
+	}
+	base := BaseStatus(ticket.OrganizationID, ticket.Status)
+	if base != StatusResolved && base != StatusClosed {
+		return false, ErrNotResolved
+	}
+
+	var before *string
+	if prev, err := db.GetTicketRating(ticket.ID); err != nil {
+		log.Printf("Error getting rating of ticket #%d: %v", ticket.ID, err)
+	} else if prev != nil {
+		s := strconv.Itoa(prev.Score)
+		before = &s
+	}
+
+	rating := &models.TicketRating{
+		TicketID:       ticket.ID,
+		OrganizationID: ticket.OrganizationID,
+		CustomerID:     ticket.CustomerID,
+		AgentID:        ticket.AssignedAgentID,
+		Score:          score,
+	}
+	if err := db.SaveTicketRating(rating); err != nil {
+		return false, err
+	}
+	after := strconv.Itoa(score)
+	record(ticket, actor, ActionRated, before, &after)
+
+	if base != StatusResolved {
+		return false, nil
+	}
+	org, err := db.GetOrganizationByID(ticket.OrganizationID)
+	if err != nil {
+		log.Printf("Error getting organization %d: %v", ticket.OrganizationID, err)
+		return false, nil
+	}
+	if !org.CSATAutoClose {
+		return false, nil
+	}
+	if err := ChangeStatus(ticket, StatusClosed, actor); err != nil {
+		log.Printf("Error closing rated ticket #%d: %v", ticket.ID, err)
+		return false, nil
+	}
+	return true, nil
+}
+
+// CommentRating adds the customer's comment to the ticket's rating.
+func CommentRating(ticket *models.Ticket, comment string) error {
+	return db.SetTicketRatingComment(ticket.ID, comment)
+}
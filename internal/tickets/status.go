@@ -0,0 +1,273 @@
+// Package tickets holds the ticket rules shared by the web interface and the
+// Telegram bot: the status lifecycle and the mutations that must be recorded.
+package tickets
+
+import (
+	"errors"
+	"fmt"
+	"helpdesk/internal/db"
+	"helpdesk/internal/i18n"
+	"helpdesk/internal/models"
+	"log"
+	"strconv"
+	"time"
+)
+
+// Channels a change can come from.
+const (
+	ChannelWeb      = "web"
+	ChannelTelegram = "telegram"
+	ChannelAPI      = "api"
+	ChannelSystem   = "system"
+)
+
+// Lifecycle stages. Custom statuses are mapped onto one of these.
+const (
+	StatusOpen       = "open"
+	StatusInProgress = "in_progress"
+	StatusResolved   = "resolved"
+	StatusClosed     = "closed"
+)
+
+var (
+	ErrUnknownStatus     = errors.New("unknown status")
+	ErrInvalidTransition = errors.New("status transition not allowed")
+	ErrStatusChanged     = errors.New("ticket status was changed by someone else")
+)
+
+// OnResolved is called when a ticket is moved to the resolved stage, e.g. to
+// ask the customer for a rating.
+var OnResolved func(ticket *models.Ticket)
+
+// OnReopened is called when a customer's message reopens their resolved
+// ticket, e.g. to let the customer know.
+var OnReopened func(ticket *models.Ticket)
+
+// Actor describes who is changing a ticket.
+type Actor struct {
+	UserID  *int
+	Role    string
+	Channel string
+}
+
+// The storage the status rules use. Tests replace them with stand-ins.
+var (
+	getTicketStatuses  = db.GetTicketStatuses
+	changeTicketStatus = db.ChangeTicketStatus
+	setTicketResolved  = db.SetTicketResolved
+)
+
+// builtinStatuses are available to every organization. Their labels come
+// from the message catalog, see StatusLabel.
+var builtinStatuses = []*models.TicketStatus{
+	{Code: StatusOpen, BaseStatus: StatusOpen},
+	{Code: StatusInProgress, BaseStatus: StatusInProgress},
+	{Code: StatusResolved, BaseStatus: StatusResolved},
+	{Code: StatusClosed, BaseStatus: StatusClosed},
+}
+
+// transitions lists the stages each stage may move to. Statuses sharing a
+// stage may always be switched between each other.
+var transitions = map[string][]string{
+	StatusOpen:       {StatusInProgress, StatusResolved, StatusClosed},
+	StatusInProgress: {StatusOpen, StatusResolved, StatusClosed},
+	StatusResolved:   {StatusOpen, StatusInProgress, StatusClosed},
+	StatusClosed:     {StatusOpen},
+}
+
+// IsBaseStatus reports whether s is one of the lifecycle stages.
+func IsBaseStatus(s string) bool {
+	_, ok := transitions[s]
+	return ok
+}
+
+// Statuses returns the built-in statuses followed by the organization's custom ones.
+func Statuses(orgID int) ([]*models.TicketStatus, error) {
+	custom, err := getTicketStatuses(orgID)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]*models.TicketStatus{}, builtinStatuses...), custom...), nil
+}
+
+func findStatus(orgID int, code string) (*models.TicketStatus, error) {
+	for _, s := range builtinStatuses {
+		if s.Code == code {
+			return s, nil
+		}
+	}
+
+	custom, err := getTicketStatuses(orgID)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range custom {
+		if s.Code == code {
+			return s, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnknownStatus, code)
+}
+
+// BaseStatus returns the lifecycle stage of a status code. Unknown codes are
+// returned unchanged so legacy values keep working.
+func BaseStatus(orgID int, code string) string {
+	s, err := findStatus(orgID, code)
+	if err != nil {
+		return code
+	}
+	return s.BaseStatus
+}
+
+// StatusLabel returns the human readable name of a status code in lang.
+// Custom statuses keep the label the organization gave them.
+func StatusLabel(orgID int, code, lang string) string {
+	s, err := findStatus(orgID, code)
+	if err != nil {
+		return code
+	}
+	if s.Label == "" {
+		return i18n.T(lang, "status."+s.Code)
+	}
+	return s.Label
+}
+
+// CanTransition checks whether actor may move a ticket from one status to another.
+func CanTransition(orgID int, from, to string, actor Actor) error {
+	target, err := findStatus(orgID, to)
+	if err != nil {
+		return err
+	}
+
+	fromBase := BaseStatus(orgID, from)
+	if fromBase == target.BaseStatus {
+		return nil
+	}
+
+	// Only staff may bring a closed ticket back
+	if fromBase == StatusClosed && actor.Role == "customer" {
+		return ErrInvalidTransition
+	}
+
+	for _, next := range transitions[fromBase] {
+		if next == target.BaseStatus {
+			return nil
+		}
+	}
+
+	// Tickets carrying a status that no longer exists may be moved anywhere
+	if !IsBaseStatus(fromBase) {
+		return nil
+	}
+
+	return ErrInvalidTransition
+}
+
+// AllowedStatuses returns the statuses a ticket in the given status can be moved
+// to by actor, including the current one.
+func AllowedStatuses(orgID int, from string, actor Actor) ([]*models.TicketStatus, error) {
+	all, err := Statuses(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	var allowed []*models.TicketStatus
+	for _, s := range all {
+		if s.Code == from || CanTransition(orgID, from, s.Code, actor) == nil {
+			allowed = append(allowed, s)
+		}
+	}
+	return allowed, nil
+}
+
+// ChangeStatus validates and applies a status change and records it in the
+// ticket's audit log. ticket.Status is updated on success.
+func ChangeStatus(ticket *models.Ticket, to string, actor Actor) error {
+	if ticket.Status == to {
+		return nil
+	}
+
+	if err := CanTransition(ticket.OrganizationID, ticket.Status, to, actor); err != nil {
+		return err
+	}
+
+	from := ticket.Status
+	event := &models.AuditEvent{
+		OrganizationID: ticket.OrganizationID,
+		TicketID:       &ticket.ID,
+		ActorID:        actor.UserID,
+		Channel:        actor.Channel,
+		Action:         ActionStatusChanged,
+		Before:         &from,
+		After:          &to,
+	}
+	ok, err := changeTicketStatus(ticket.ID, from, to, event)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrStatusChanged
+	}
+
+	ticket.Status = to
+	fromBase, toBase := BaseStatus(ticket.OrganizationID, from), BaseStatus(ticket.OrganizationID, to)
+	updateResolvedAt(ticket, fromBase, toBase)
+
+	if toBase == StatusResolved && fromBase != StatusResolved && OnResolved != nil {
+		OnResolved(ticket)
+	}
+	return nil
+}
+
+// updateResolvedAt stops the resolution timer when a ticket is resolved or
+// closed and restarts it when the ticket is reopened.
+func updateResolvedAt(ticket *models.Ticket, fromBase, toBase string) {
+	done := func(s string) bool { return s == StatusResolved || s == StatusClosed }
+
+	var resolvedAt *time.Time
+	switch {
+	case done(toBase) && !done(fromBase):
+		now := time.Now()
+		resolvedAt = &now
+	case !done(toBase) && done(fromBase):
+		resolvedAt = nil
+	default:
+		return
+	}
+
+	if err := setTicketResolved(ticket.ID, resolvedAt); err != nil {
+		log.Printf("Error updating resolution time for ticket #%d: %v", ticket.ID, err)
+		return
+	}
+	ticket.ResolvedAt = resolvedAt
+}
+
+// Assign sets the ticket's agent and moves an open ticket into work.
+func Assign(ticket *models.Ticket, agentID int, actor Actor) error {
+	if err := db.AssignTicket(ticket.ID, agentID); err != nil {
+		return err
+	}
+
+	var before *string
+	if ticket.AssignedAgentID != nil {
+		prev := strconv.Itoa(*ticket.AssignedAgentID)
+		before = &prev
+	}
+	after := strconv.Itoa(agentID)
+	ticket.AssignedAgentID = &agentID
+	record(ticket, actor, ActionAssigned, before, &after)
+
+	if BaseStatus(ticket.OrganizationID, ticket.Status) == StatusOpen {
+		return ChangeStatus(ticket, StatusInProgress, actor)
+	}
+	return nil
+}
+
+// StartWork moves an open ticket to in_progress, e.g. when an agent replies.
+func StartWork(ticket *models.Ticket, actor Actor) error {
+	if BaseStatus(ticket.OrganizationID, ticket.Status) != StatusOpen {
+		return nil
+	}
+	return ChangeStatus(ticket, StatusInProgress, actor)
+}
@@ -0,0 +1,208 @@
+package tickets
+
+import (
+	"errors"
+	"helpdesk/internal/models"
+	"testing"
+	"time"
+)
+
+// customStatuses are the statuses organization 1 adds to the built-in ones.
+var customStatuses = []*models.TicketStatus{
+	{Code: "waiting", Label: "Waiting for parts", BaseStatus: StatusInProgress},
+	{Code: "fixed_remotely", Label: "Fixed remotely", BaseStatus: StatusResolved},
+	{Code: "archived", Label: "Archived", BaseStatus: StatusClosed},
+}
+
+var (
+	customer = Actor{Role: "customer", Channel: ChannelTelegram}
+	agent    = Actor{Role: "agent", Channel: ChannelWeb}
+)
+
+// statusStore stands in for the database.
+type statusStore struct {
+	changes  []string
+	stale    bool // the ticket's status was changed by someone else
+	resolved []*time.Time
+}
+
+func setupStatuses(t *testing.T) *statusStore {
+	t.Helper()
+	origStatuses, origChange, origResolved, origOnResolved := getTicketStatuses, changeTicketStatus, setTicketResolved, OnResolved
+	t.Cleanup(func() {
+		getTicketStatuses, changeTicketStatus, setTicketResolved, OnResolved = origStatuses, origChange, origResolved, origOnResolved
+	})
+
+	store := &statusStore{}
+	getTicketStatuses = func(orgID int) ([]*models.TicketStatus, error) {
+		if orgID != 1 {
+			return nil, nil
+		}
+		return customStatuses, nil
+	}
+	changeTicketStatus = func(_ int, from, to string, event *models.AuditEvent) (bool, error) {
+		if store.stale {
+			return false, nil
+		}
+		if event.Before == nil || *event.Before != from || event.After == nil || *event.After != to || event.Action != ActionStatusChanged {
+			t.Errorf("audit event %+v does not describe %s -> %s", event, from, to)
+		}
+		store.changes = append(store.changes, from+" -> "+to)
+		return true, nil
+	}
+	setTicketResolved = func(_ int, at *time.Time) error {
+		store.resolved = append(store.resolved, at)
+		return nil
+	}
+	OnResolved = nil
+	return store
+}
+
+func TestCanTransition(t *testing.T) {
+	setupStatuses(t)
+
+	tests := []struct {
+		from, to string
+		actor    Actor
+		want     error
+	}{
+		// Built-in stages
+		{StatusOpen, StatusInProgress, agent, nil},
+		{StatusOpen, StatusResolved, agent, nil},
+		{StatusOpen, StatusClosed, customer, nil},
+		{StatusInProgress, StatusOpen, agent, nil},
+		{StatusResolved, StatusOpen, customer, nil},
+		{StatusResolved, StatusClosed, customer, nil},
+		{StatusResolved, StatusInProgress, agent, nil},
+
+		// Only staff reopen a closed ticket, and only to open
+		{StatusClosed, StatusOpen, customer, ErrInvalidTransition},
+		{StatusClosed, StatusOpen, agent, nil},
+		{StatusClosed, StatusInProgress, agent, ErrInvalidTransition},
+		{StatusClosed, StatusResolved, agent, ErrInvalidTransition},
+
+		// Custom statuses follow their stage
+		{StatusOpen, "waiting", agent, nil},
+		{"waiting", StatusInProgress, agent, nil},
+		{"waiting", StatusOpen, customer, nil},
+		{"fixed_remotely", StatusOpen, customer, nil},
+		{StatusResolved, "fixed_remotely", agent, nil},
+		{"archived", StatusOpen, customer, ErrInvalidTransition},
+		{"archived", StatusOpen, agent, nil},
+		{"archived", "waiting", agent, ErrInvalidTransition},
+		{StatusClosed, "archived", customer, nil},
+		{"archived", StatusClosed, customer, nil},
+
+		// Unknown targets are refused, unknown sources may go anywhere
+		{StatusOpen, "nonexistent", agent, ErrUnknownStatus},
+		{"legacy", StatusClosed, customer, nil},
+	}
+	for _, tt := range tests {
+		err := CanTransition(1, tt.from, tt.to, tt.actor)
+		if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+			t.Errorf("CanTransition(%s -> %s as %s) = %v, want %v", tt.from, tt.to, tt.actor.Role, err, tt.want)
+		}
+	}
+
+	// Another organization does not see organization 1's statuses
+	if err := CanTransition(2, StatusOpen, "waiting", agent); !errors.Is(err, ErrUnknownStatus) {
+		t.Errorf("CanTransition to another organization's status = %v, want ErrUnknownStatus", err)
+	}
+}
+
+func TestAllowedStatuses(t *testing.T) {
+	setupStatuses(t)
+
+	tests := []struct {
+		from  string
+		actor Actor
+		want  []string
+	}{
+		{StatusOpen, agent, []string{StatusOpen, StatusInProgress, StatusResolved, StatusClosed, "waiting", "fixed_remotely", "archived"}},
+		{StatusClosed, customer, []string{StatusClosed, "archived"}},
+		{StatusClosed, agent, []string{StatusOpen, StatusClosed, "archived"}},
+		{"archived", customer, []string{StatusClosed, "archived"}},
+	}
+	for _, tt := range tests {
+		list, err := AllowedStatuses(1, tt.from, tt.actor)
+		if err != nil {
+			t.Fatalf("AllowedStatuses(%s): %v", tt.from, err)
+		}
+		var got []string
+		for _, s := range list {
+			got = append(got, s.Code)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("AllowedStatuses(%s as %s) = %v, want %v", tt.from, tt.actor.Role, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("AllowedStatuses(%s as %s) = %v, want %v", tt.from, tt.actor.Role, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestChangeStatus(t *testing.T) {
+	tests := []struct {
+		name         string
+		from, to     string
+		actor        Actor
+		stale        bool
+		want         error
+		wantStatus   string
+		wantResolved []bool // calls to setTicketResolved, true for a time
+		wantNotified bool
+	}{
+		{name: "unchanged", from: StatusOpen, to: StatusOpen, actor: agent, wantStatus: StatusOpen},
+		{name: "resolve", from: StatusInProgress, to: StatusResolved, actor: agent,
+			wantStatus: StatusResolved, wantResolved: []bool{true}, wantNotified: true},
+		{name: "custom resolved", from: "waiting", to: "fixed_remotely", actor: agent,
+			wantStatus: "fixed_remotely", wantResolved: []bool{true}, wantNotified: true},
+		{name: "within the resolved stage", from: StatusResolved, to: "fixed_remotely", actor: agent,
+			wantStatus: "fixed_remotely"},
+		{name: "close resolved", from: StatusResolved, to: StatusClosed, actor: customer,
+			wantStatus: StatusClosed},
+		{name: "reopen", from: "fixed_remotely", to: StatusOpen, actor: customer,
+			wantStatus: StatusOpen, wantResolved: []bool{false}},
+		{name: "refused", from: StatusClosed, to: StatusOpen, actor: customer,
+			want: ErrInvalidTransition, wantStatus: StatusClosed},
+		{name: "changed meanwhile", from: StatusOpen, to: StatusResolved, actor: agent, stale: true,
+			want: ErrStatusChanged, wantStatus: StatusOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := setupStatuses(t)
+			store.stale = tt.stale
+			notified := 0
+			OnResolved = func(*models.Ticket) { notified++ }
+
+			ticket := &models.Ticket{ID: 5, OrganizationID: 1, Status: tt.from}
+			err := ChangeStatus(ticket, tt.to, tt.actor)
+			if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Fatalf("ChangeStatus = %v, want %v", err, tt.want)
+			}
+			if ticket.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", ticket.Status, tt.wantStatus)
+			}
+
+			changed := tt.want == nil && tt.from != tt.to
+			if changed != (len(store.changes) == 1) {
+				t.Errorf("stored changes = %v", store.changes)
+			}
+			if len(store.resolved) != len(tt.wantResolved) {
+				t.Fatalf("resolution time set %d times, want %d", len(store.resolved), len(tt.wantResolved))
+			}
+			for i, set := range tt.wantResolved {
+				if (store.resolved[i] != nil) != set {
+					t.Errorf("resolution time = %v, want set: %v", store.resolved[i], set)
+				}
+			}
+			if (notified == 1) != tt.wantNotified || notified > 1 {
+				t.Errorf("OnResolved called %d times", notified)
+			}
+		})
+	}
+}
@@ -6,8 +6,16 @@ import (
 	"helpdesk/internal/auth"
 	"helpdesk/internal/bot"
 	"helpdesk/internal/calendar"
+	"helpdesk/internal/calsync"
 	"helpdesk/internal/db"
+	"helpdesk/internal/digest"
 	"helpdesk/internal/handlers"
+	"helpdesk/internal/i18n"
+	"helpdesk/internal/jobs"
+	"helpdesk/internal/models"
+	"helpdesk/internal/secrets"
+	"helpdesk/internal/sla"
+	"helpdesk/internal/tickets"
 	"log"
 	"net/http"
 	"os"
@@ -25,6 +33,18 @@ func main() {
 		log.Printf("Warning: .env file not found: %v", err)
 	}
 
+	// Refuse insecure defaults in production
+	production := getEnv("APP_ENV", "development") == "production"
+	if err := auth.Init(production); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if err := secrets.Init(production); err != nil {
+		log.Fatalf("Invalid token encryption keys: %v", err)
+	}
+	if !secrets.Enabled() {
+		log.Println("Warning: TOKEN_ENCRYPTION_KEYS not set, OAuth tokens are stored unencrypted")
+	}
+
 	// Initialize database
 	if err := db.Init(); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
@@ -36,12 +56,29 @@ func main() {
 		log.Printf("Warning: Migration error (may be normal if tables exist): %v", err)
 	}
 
+	// Encrypt tokens stored before encryption was enabled or under a retired key
+	if n, err := db.RewrapGoogleCalendarTokens(); err != nil {
+		log.Printf("Warning: failed to re-encrypt OAuth tokens: %v", err)
+	} else if n > 0 {
+		log.Printf("Re-encrypted OAuth tokens of %d organization(s)", n)
+	}
+	if n, err := db.RewrapCalDAVPasswords(); err != nil {
+		log.Printf("Warning: failed to re-encrypt CalDAV passwords: %v", err)
+	} else if n > 0 {
+		log.Printf("Re-encrypted CalDAV passwords of %d organization(s)", n)
+	}
+
 	// Create uploads directory
 	uploadDir := getEnv("UPLOAD_DIR", "uploads")
 	if err := os.MkdirAll(uploadDir, 0755); err != nil {
 		log.Fatalf("Failed to create uploads directory: %v", err)
 	}
 
+	// Load message catalogs before the templates that use them
+	if err := i18n.Init(); err != nil {
+		log.Fatalf("Failed to load message catalogs: %v", err)
+	}
+
 	// Initialize templates
 	if err := handlers.InitTemplates(); err != nil {
 		log.Fatalf("Failed to initialize templates: %v", err)
@@ -49,6 +86,24 @@ func main() {
 
 	// Initialize Google Calendar
 	calendar.Init()
+	calendar.OnConnectionBroken = func(orgID int, reason string) {
+		name := fmt.Sprintf("#%d", orgID)
+		if org, err := db.GetOrganizationByID(orgID); err == nil {
+			name = org.Name
+		}
+		bot.NotifyAdmins(i18n.M("calendar.connection_broken", name, reason))
+	}
+
+	// Resolved tickets ask the customer for a rating
+	tickets.OnResolved = bot.RequestRating
+	tickets.OnReopened = func(ticket *models.Ticket) {
+		bot.NotifyCustomer(ticket, i18n.M("bot.customer.reopened_by_reply", ticket.ID))
+	}
+
+	// Initialize SLA settings
+	if err := sla.Init(); err != nil {
+		log.Fatalf("Failed to initialize SLA: %v", err)
+	}
 
 	// Initialize Telegram bot
 	if err := bot.Init(); err != nil {
@@ -62,6 +117,10 @@ func main() {
 		}()
 	}
 
+	// Background jobs, each run by one instance at a time
+	registerJobs()
+	jobs.Start()
+
 	// Setup HTTP router
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
@@ -71,6 +130,8 @@ func main() {
 	r.Get("/login", handlers.LoginHandler)
 	r.Post("/login", handlers.LoginHandler)
 	r.Get("/logout", handlers.LogoutHandler)
+	// Token-protected ICS feeds for calendar clients
+	r.Get("/calendar/agent/{token}.ics", handlers.AgentFeedHandler)
 
 	// Protected routes
 	r.Group(func(r chi.Router) {
@@ -104,8 +165,52 @@ func main() {
 		r.Post("/ticket/message", handlers.AddMessageHandler)
 		r.Post("/ticket/status", handlers.UpdateTicketStatusHandler)
 		r.Post("/ticket/assign", handlers.AssignTicketHandler)
-		r.Get("/auth/google", handlers.GoogleCalendarAuthHandler)
-		r.Get("/auth/google/callback", handlers.GoogleCalendarCallbackHandler)
+		r.Post("/ticket/priority", handlers.UpdateTicketPriorityHandler)
+		r.Post("/ticket/schedule", handlers.ScheduleAppointmentHandler)
+		r.Post("/ticket/appointment", handlers.UpdateAppointmentHandler)
+		r.Get("/settings/language", handlers.LanguageSettingsHandler)
+		r.Post("/settings/language", handlers.LanguageSettingsHandler)
+
+		// Agent settings
+		r.Group(func(r chi.Router) {
+			r.Use(handlers.RequireRole("agent"))
+			r.Get("/digest", handlers.DigestHandler)
+			r.Post("/digest", handlers.DigestHandler)
+			r.Get("/settings/feed", handlers.FeedSettingsHandler)
+			r.Post("/settings/feed", handlers.FeedSettingsHandler)
+		})
+
+		// Admin settings
+		r.Group(func(r chi.Router) {
+			r.Use(handlers.RequireRole("admin"))
+			r.Get("/settings/statuses", handlers.StatusSettingsHandler)
+			r.Post("/settings/statuses", handlers.StatusSettingsHandler)
+			r.Post("/settings/statuses/delete", handlers.DeleteStatusHandler)
+			r.Post("/settings/statuses/auto-close", handlers.AutoCloseSettingsHandler)
+			r.Get("/settings/sla", handlers.SLASettingsHandler)
+			r.Post("/settings/sla", handlers.SLASettingsHandler)
+			r.Get("/settings/hours", handlers.BusinessHoursSettingsHandler)
+			r.Post("/settings/hours", handlers.BusinessHoursSettingsHandler)
+			r.Post("/settings/holidays", handlers.AddHolidayHandler)
+			r.Post("/settings/holidays/delete", handlers.DeleteHolidayHandler)
+			r.Get("/settings/intake", handlers.IntakeSettingsHandler)
+			r.Post("/settings/intake", handlers.IntakeSettingsHandler)
+			r.Post("/settings/intake/delete", handlers.DeleteCategoryHandler)
+			r.Post("/settings/intake/questions", handlers.AddIntakeQuestionHandler)
+			r.Post("/settings/intake/questions/delete", handlers.DeleteIntakeQuestionHandler)
+			r.Get("/audit/export", handlers.AuditExportHandler)
+			r.Get("/reports/csat", handlers.CSATReportHandler)
+			r.Post("/reports/csat", handlers.CSATReportHandler)
+			r.Get("/reports/jobs", handlers.JobsHandler)
+			r.Get("/settings/calendar", handlers.CalendarSettingsHandler)
+			r.Post("/settings/calendar", handlers.CalendarSettingsHandler)
+			r.Post("/settings/calendar/disconnect", handlers.DisconnectCalendarHandler)
+			r.Post("/settings/calendar/provider", handlers.CalendarProviderHandler)
+			r.Post("/settings/calendar/caldav", handlers.CalDAVSettingsHandler)
+			r.Post("/settings/calendar/caldav/disconnect", handlers.DisconnectCalDAVHandler)
+			r.Get("/auth/google", handlers.GoogleCalendarAuthHandler)
+			r.Get("/auth/google/callback", handlers.GoogleCalendarCallbackHandler)
+		})
 	})
 
 	// Start HTTP server
@@ -133,17 +238,51 @@ func main() {
 
 	log.Println("Shutting down server...")
 
-	// Graceful shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	// Graceful shutdown: drain HTTP requests first, then let running jobs
+	// finish, each with its own deadline
+	httpCtx, cancelHTTP := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelHTTP()
+	if err := srv.Shutdown(httpCtx); err != nil {
+		log.Printf("HTTP server did not shut down cleanly: %v", err)
+	}
 
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+	jobsCtx, cancelJobs := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelJobs()
+	if err := jobs.Stop(jobsCtx); err != nil {
+		log.Printf("Background jobs did not stop in time: %v", err)
 	}
 
 	log.Println("Server exited")
 }
 
+// registerJobs sets up the periodic work. Each schedule is read from its
+// environment variable as a Go duration or a cron expression, see jobs.Parse.
+func registerJobs() {
+	list := []struct {
+		name, env, spec string
+		run             func(ctx context.Context) error
+	}{
+		{"sla_escalations", "SLA_CHECK_INTERVAL", "1m", func(ctx context.Context) error {
+			return sla.CheckEscalations(ctx, bot.NotifyOperators)
+		}},
+		{"calendar_sync", "CALENDAR_SYNC_INTERVAL", "5m", func(ctx context.Context) error {
+			return calsync.SyncAll(ctx, bot.NotifyCustomer)
+		}},
+		{"auto_close", "AUTO_CLOSE_CHECK_INTERVAL", "1h", func(ctx context.Context) error {
+			return tickets.CloseInactive(ctx, bot.NotifyCustomer)
+		}},
+		{"digests", "DIGEST_CHECK_INTERVAL", "5m", func(ctx context.Context) error {
+			return digest.SendDue(ctx, bot.SendDigest)
+		}},
+		{"job_runs_cleanup", "JOB_RUNS_CLEANUP_SCHEDULE", "@daily", jobs.CleanupRuns},
+	}
+	for _, j := range list {
+		if err := jobs.Register(j.name, getEnv(j.env, j.spec), j.run); err != nil {
+			log.Fatalf("Invalid %s: %v", j.env, err)
+		}
+	}
+}
+
 func loadEnv() error {
 	// Simple .env loader (in production, use godotenv or similar)
 	// For now, we rely on environment variables being set
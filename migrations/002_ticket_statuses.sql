@@ -0,0 +1,26 @@
+-- Custom per-organization ticket statuses. Each one belongs to a lifecycle
+-- stage (base_status) that decides which transitions are allowed.
+CREATE TABLE IF NOT EXISTS ticket_statuses (
+    id SERIAL PRIMARY KEY,
+    organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    code VARCHAR(50) NOT NULL,
+    label VARCHAR(255) NOT NULL,
+    base_status VARCHAR(50) NOT NULL, -- open, in_progress, resolved, closed
+    sort_order INTEGER DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (organization_id, code)
+);
+
+-- Every status change made through the ticket service
+CREATE TABLE IF NOT EXISTS ticket_status_history (
+    id SERIAL PRIMARY KEY,
+    ticket_id INTEGER NOT NULL REFERENCES tickets(id) ON DELETE CASCADE,
+    from_status VARCHAR(50),
+    to_status VARCHAR(50) NOT NULL,
+    changed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    channel VARCHAR(20) NOT NULL DEFAULT 'web', -- web, telegram, api, system
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_ticket_statuses_organization_id ON ticket_statuses(organization_id);
+CREATE INDEX IF NOT EXISTS idx_ticket_status_history_ticket_id ON ticket_status_history(ticket_id);
@@ -0,0 +1,16 @@
+-- Audit log of every ticket mutation made through the ticket service.
+-- Rows outlive their ticket so the log stays complete for compliance exports.
+CREATE TABLE IF NOT EXISTS audit_events (
+    id SERIAL PRIMARY KEY,
+    organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    ticket_id INTEGER REFERENCES tickets(id) ON DELETE SET NULL,
+    actor_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    channel VARCHAR(20) NOT NULL, -- web, telegram, api, system
+    action VARCHAR(50) NOT NULL, -- ticket_created, status_changed, priority_changed, assigned, message_added
+    before_value TEXT,
+    after_value TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_ticket_id ON audit_events(ticket_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_organization_created ON audit_events(organization_id, created_at);
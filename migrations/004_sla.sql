@@ -0,0 +1,24 @@
+-- SLA targets per organization and ticket priority. NULL minutes mean no target.
+CREATE TABLE IF NOT EXISTS sla_policies (
+    id SERIAL PRIMARY KEY,
+    organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    priority VARCHAR(50) NOT NULL, -- low, medium, high, urgent
+    first_response_minutes INTEGER,
+    resolution_minutes INTEGER,
+    business_hours BOOLEAN DEFAULT FALSE, -- count only the organization's working hours
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (organization_id, priority)
+);
+
+-- SLA timers on tickets
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS first_response_due_at TIMESTAMP;
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS resolution_due_at TIMESTAMP;
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS first_responded_at TIMESTAMP;
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS resolved_at TIMESTAMP;
+-- Set once operators were warned about a timer; cleared when due dates change
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS first_response_escalated_at TIMESTAMP;
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS resolution_escalated_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_tickets_first_response_due_at ON tickets(first_response_due_at);
+CREATE INDEX IF NOT EXISTS idx_tickets_resolution_due_at ON tickets(resolution_due_at);
@@ -0,0 +1,22 @@
+-- Working time of each organization's support team
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) DEFAULT 'UTC';
+
+-- One working interval per weekday (0 = Sunday ... 6 = Saturday), in the
+-- organization's timezone. Days without a row are days off. An organization
+-- without any rows is treated as working around the clock.
+CREATE TABLE IF NOT EXISTS business_hours (
+    id SERIAL PRIMARY KEY,
+    organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    weekday SMALLINT NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+    start_time TIME NOT NULL,
+    end_time TIME NOT NULL,
+    UNIQUE (organization_id, weekday)
+);
+
+CREATE TABLE IF NOT EXISTS holidays (
+    id SERIAL PRIMARY KEY,
+    organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    date DATE NOT NULL,
+    name VARCHAR(255),
+    UNIQUE (organization_id, date)
+);
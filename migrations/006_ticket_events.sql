@@ -0,0 +1,19 @@
+-- Appointments (on-site visits and calls) scheduled from a ticket into the
+-- organization's Google Calendar.
+CREATE TABLE IF NOT EXISTS ticket_events (
+    id SERIAL PRIMARY KEY,
+    ticket_id INTEGER NOT NULL REFERENCES tickets(id) ON DELETE CASCADE,
+    organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    google_event_id VARCHAR(1024),
+    kind VARCHAR(20) NOT NULL, -- visit, call
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'scheduled', -- scheduled, cancelled
+    agent_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_ticket_events_ticket_id ON ticket_events(ticket_id);
+CREATE INDEX IF NOT EXISTS idx_ticket_events_google_event_id ON ticket_events(google_event_id);
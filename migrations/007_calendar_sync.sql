@@ -0,0 +1,11 @@
+-- Incremental sync position in each organization's Google Calendar.
+CREATE TABLE IF NOT EXISTS calendar_sync_state (
+    organization_id INTEGER PRIMARY KEY REFERENCES organizations(id) ON DELETE CASCADE,
+    calendar_id VARCHAR(255) NOT NULL,
+    sync_token TEXT,
+    synced_at TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Messages written by the helpdesk itself, e.g. about calendar changes
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS is_system BOOLEAN DEFAULT FALSE;
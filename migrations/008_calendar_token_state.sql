@@ -0,0 +1,4 @@
+-- Set when Google rejected the refresh token (revoked or expired grant); the
+-- organization has to connect the calendar again.
+ALTER TABLE google_calendar_tokens ADD COLUMN IF NOT EXISTS broken_at TIMESTAMP;
+ALTER TABLE google_calendar_tokens ADD COLUMN IF NOT EXISTS broken_reason TEXT;
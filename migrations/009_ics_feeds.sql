@@ -0,0 +1,3 @@
+-- Secret token of the agent's personal iCalendar feed; NULL means no feed.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS ics_token VARCHAR(64);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_ics_token ON users(ics_token);
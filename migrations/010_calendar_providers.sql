@@ -0,0 +1,15 @@
+-- Calendar backend of each organization: google or caldav
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS calendar_provider VARCHAR(20) DEFAULT 'google';
+
+-- CalDAV calendar collection used by organizations with the caldav provider.
+-- The password is encrypted like the Google tokens.
+CREATE TABLE IF NOT EXISTS caldav_accounts (
+    organization_id INTEGER PRIMARY KEY REFERENCES organizations(id) ON DELETE CASCADE,
+    calendar_url TEXT NOT NULL,
+    username VARCHAR(255),
+    password TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- ticket_events.google_event_id now holds the event ID of whichever provider created it
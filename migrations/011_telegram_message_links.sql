@@ -0,0 +1,11 @@
+-- Bot messages that belong to a ticket, so that a Telegram reply to one of
+-- them (by an operator or by the customer) is routed to that ticket.
+CREATE TABLE IF NOT EXISTS telegram_message_links (
+    chat_id BIGINT NOT NULL,
+    message_id INTEGER NOT NULL,
+    ticket_id INTEGER NOT NULL REFERENCES tickets(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (chat_id, message_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_telegram_message_links_ticket ON telegram_message_links(ticket_id);
@@ -0,0 +1,8 @@
+-- Forum topic of each ticket in the organization's operators' Telegram group
+-- (organizations.telegram_chat_id).
+CREATE TABLE IF NOT EXISTS telegram_topics (
+    ticket_id INTEGER PRIMARY KEY REFERENCES tickets(id) ON DELETE CASCADE,
+    chat_id BIGINT NOT NULL,
+    thread_id INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
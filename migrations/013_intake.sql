@@ -0,0 +1,39 @@
+-- Ticket categories offered by the bot on /start
+CREATE TABLE IF NOT EXISTS ticket_categories (
+    id SERIAL PRIMARY KEY,
+    organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    sort_order INTEGER DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_ticket_categories_org ON ticket_categories(organization_id);
+
+-- Questions the bot asks for a category, in sort order.
+-- kind: text, choice (options, one per line), priority (sets the ticket priority), contact (phone via Telegram contact sharing)
+CREATE TABLE IF NOT EXISTS intake_questions (
+    id SERIAL PRIMARY KEY,
+    category_id INTEGER NOT NULL REFERENCES ticket_categories(id) ON DELETE CASCADE,
+    label VARCHAR(100) NOT NULL,
+    prompt TEXT NOT NULL,
+    kind VARCHAR(20) NOT NULL DEFAULT 'text',
+    options TEXT,
+    required BOOLEAN DEFAULT TRUE,
+    sort_order INTEGER DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_intake_questions_category ON intake_questions(category_id);
+
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS category_id INTEGER REFERENCES ticket_categories(id) ON DELETE SET NULL;
+
+-- Answers collected by the intake, copied so that they survive edits of the questions
+CREATE TABLE IF NOT EXISTS ticket_fields (
+    id SERIAL PRIMARY KEY,
+    ticket_id INTEGER NOT NULL REFERENCES tickets(id) ON DELETE CASCADE,
+    label VARCHAR(100) NOT NULL,
+    value TEXT NOT NULL,
+    sort_order INTEGER DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_ticket_fields_ticket ON ticket_fields(ticket_id);
@@ -0,0 +1,5 @@
+-- Interface language of users; NULL means the organization's default.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS language VARCHAR(8);
+
+-- Default language of the organization's users and of texts without a single reader
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS language VARCHAR(8) NOT NULL DEFAULT 'ru';
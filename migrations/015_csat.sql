@@ -0,0 +1,17 @@
+-- Customer satisfaction ratings, one per ticket; rating again replaces the score.
+-- agent_id is the ticket's agent at the time of the rating.
+CREATE TABLE IF NOT EXISTS ticket_ratings (
+    ticket_id INTEGER PRIMARY KEY REFERENCES tickets(id) ON DELETE CASCADE,
+    organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    customer_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    agent_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    score SMALLINT NOT NULL CHECK (score BETWEEN 1 AND 5),
+    comment TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_ticket_ratings_org ON ticket_ratings(organization_id, updated_at);
+
+-- Close a resolved ticket as soon as its customer rated it
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS csat_auto_close BOOLEAN NOT NULL DEFAULT FALSE;
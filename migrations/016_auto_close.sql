@@ -0,0 +1,4 @@
+-- Close tickets resolved this many days ago without a customer reply; 0 disables
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS auto_close_days INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_tickets_resolved_at ON tickets(resolved_at) WHERE resolved_at IS NOT NULL;
@@ -0,0 +1,14 @@
+-- History of background job runs; status is running, succeeded or failed.
+-- instance identifies the process (host:pid) that held the job's lock.
+CREATE TABLE IF NOT EXISTS job_runs (
+    id SERIAL PRIMARY KEY,
+    job_name VARCHAR(100) NOT NULL,
+    instance VARCHAR(255) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'running',
+    error TEXT,
+    started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_runs_started ON job_runs(started_at);
+CREATE INDEX IF NOT EXISTS idx_job_runs_job ON job_runs(job_name, started_at);
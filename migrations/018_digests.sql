@@ -0,0 +1,11 @@
+-- Operators' ticket digests sent by the bot. send_time is HH:MM in the
+-- organization's timezone, weekday (0 = Sunday) is used by weekly digests.
+CREATE TABLE IF NOT EXISTS digest_settings (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    frequency VARCHAR(16) NOT NULL DEFAULT 'off',
+    send_time VARCHAR(5) NOT NULL DEFAULT '09:00',
+    weekday SMALLINT NOT NULL DEFAULT 1 CHECK (weekday BETWEEN 0 AND 6),
+    sections TEXT[] NOT NULL DEFAULT '{}',
+    last_sent_at TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,10 @@
+-- Set once operators were told a timer has expired. The *_escalated_at
+-- columns keep marking the warning sent before that.
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS first_response_breach_notified_at TIMESTAMP;
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS resolution_breach_notified_at TIMESTAMP;
+
+-- Tickets already escalated after their due date got that notice as a breach
+UPDATE tickets SET first_response_breach_notified_at = first_response_escalated_at
+WHERE first_response_breach_notified_at IS NULL AND first_response_escalated_at > first_response_due_at;
+UPDATE tickets SET resolution_breach_notified_at = resolution_escalated_at
+WHERE resolution_breach_notified_at IS NULL AND resolution_escalated_at > resolution_due_at;
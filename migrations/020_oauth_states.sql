@@ -0,0 +1,9 @@
+-- Nonces of OAuth state parameters not used yet. A row is deleted when the
+-- state comes back, so each state can complete the flow once.
+CREATE TABLE IF NOT EXISTS oauth_states (
+    nonce VARCHAR(64) PRIMARY KEY,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_oauth_states_expires_at ON oauth_states(expires_at);
@@ -14,8 +14,9 @@ echo "Building..."
 export PATH=$PATH:/usr/local/go/bin
 go build -o $APP_DIR/helpdesk main.go
 
-echo "Copying templates and migrations..."
+echo "Copying templates, locales and migrations..."
 cp -r templates $APP_DIR/
+cp -r locales $APP_DIR/
 cp -r migrations $APP_DIR/
 
 echo "Restarting service..."